@@ -494,7 +494,7 @@ func testAnalyzer(t *testing.T, when spec.G, it spec.S) {
 						)
 
 						h.AssertMatch(t, output, "9999 3333 .+ \\.")
-						h.AssertMatch(t, output, "9999 3333 .+ committed")
+						h.AssertMatch(t, output, "9999 3333 .+ io.buildpacks.lifecycle.cache.metadata")
 						h.AssertMatch(t, output, "2222 3333 .+ staging")
 					})
 				})
@@ -3,6 +3,8 @@ package lifecycle
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/buildpacks/imgutil"
 	"github.com/pkg/errors"
@@ -54,19 +56,9 @@ func (a *Analyzer) Analyze(image imgutil.Image, cache Cache) (platform.AnalyzedM
 }
 
 func (a *Analyzer) analyzeLayers(appMeta platform.LayersMetadata, cache Cache) error {
-	// Create empty cache metadata in case a usable cache is not provided.
-	var cacheMeta platform.CacheMetadata
-	if cache != nil {
-		var err error
-		if !cache.Exists() {
-			a.Logger.Info("Layer cache not found")
-		}
-		cacheMeta, err = cache.RetrieveMetadata()
-		if err != nil {
-			return errors.Wrap(err, "retrieving cache metadata")
-		}
-	} else {
-		a.Logger.Debug("Usable cache not provided, using empty cache metadata.")
+	cacheMeta, err := a.cacheMetadata(cache)
+	if err != nil {
+		return err
 	}
 
 	for _, buildpack := range a.Buildpacks {
@@ -80,12 +72,8 @@ func (a *Analyzer) analyzeLayers(appMeta platform.LayersMetadata, cache Cache) e
 		appLayers := appMeta.MetadataForBuildpack(buildpack.ID).Layers
 		for name, layer := range appLayers {
 			identifier := fmt.Sprintf("%s:%s", buildpack.ID, name)
-			if !layer.Launch {
-				a.Logger.Debugf("Not restoring metadata for %q, marked as launch=false", identifier)
-				continue
-			}
-			if layer.Build && !layer.Cache {
-				a.Logger.Debugf("Not restoring metadata for %q, marked as build=true, cache=false", identifier)
+			if reason := skipImageLayerReason(layer); reason != "" {
+				a.Logger.Debugf("Not restoring metadata for %q, %s", identifier, reason)
 				continue
 			}
 			a.Logger.Infof("Restoring metadata for %q from app image", identifier)
@@ -99,13 +87,8 @@ func (a *Analyzer) analyzeLayers(appMeta platform.LayersMetadata, cache Cache) e
 		cachedLayers := cacheMeta.MetadataForBuildpack(buildpack.ID).Layers
 		for name, layer := range cachedLayers {
 			identifier := fmt.Sprintf("%s:%s", buildpack.ID, name)
-			if !layer.Cache {
-				a.Logger.Debugf("Not restoring %q from cache, marked as cache=false", identifier)
-				continue
-			}
-			// If launch=true, the metadata was restored from the app image or the layer is stale.
-			if layer.Launch {
-				a.Logger.Debugf("Not restoring %q from cache, marked as launch=true", identifier)
+			if reason := skipCacheLayerReason(layer); reason != "" {
+				a.Logger.Debugf("Not restoring %q from cache, %s", identifier, reason)
 				continue
 			}
 			a.Logger.Infof("Restoring metadata for %q from cache", identifier)
@@ -117,6 +100,135 @@ func (a *Analyzer) analyzeLayers(appMeta platform.LayersMetadata, cache Cache) e
 	return nil
 }
 
+// Explain reports what Analyze and the restorer would do with each buildpack layer, and why, without modifying the layers directory
+func (a *Analyzer) Explain(image imgutil.Image, cache Cache) (platform.AnalysisExplanation, error) {
+	var appMeta platform.LayersMetadata
+	// continue even if the label cannot be decoded
+	if err := DecodeLabel(image, platform.LayerMetadataLabel, &appMeta); err != nil {
+		appMeta = platform.LayersMetadata{}
+	}
+	explanation := platform.AnalysisExplanation{Layers: []platform.LayerExplanation{}}
+	if a.SkipLayers {
+		a.Logger.Infof("Skipping buildpack layer analysis")
+		return explanation, nil
+	}
+	cacheMeta, err := a.cacheMetadata(cache)
+	if err != nil {
+		return platform.AnalysisExplanation{}, err
+	}
+
+	for _, buildpack := range a.Buildpacks {
+		appLayers := appMeta.MetadataForBuildpack(buildpack.ID).Layers
+		cachedLayers := cacheMeta.MetadataForBuildpack(buildpack.ID).Layers
+		var names []string
+		for name := range appLayers {
+			names = append(names, name)
+		}
+		for name := range cachedLayers {
+			if _, ok := appLayers[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			explanation.Layers = append(explanation.Layers, explainLayer(buildpack.ID, name, appLayers, cachedLayers))
+		}
+	}
+	return explanation, nil
+}
+
+// explainLayer follows the decisions made by analyzeLayers and the restorer for a single layer
+func explainLayer(bpID, name string, appLayers, cachedLayers map[string]platform.BuildpackLayerMetadata) platform.LayerExplanation {
+	explanation := platform.LayerExplanation{Buildpack: bpID, Layer: name}
+	appLayer, inImage := appLayers[name]
+	cachedLayer, inCache := cachedLayers[name]
+	if inImage {
+		explanation.ImageSHA = appLayer.SHA
+	}
+	if inCache {
+		explanation.CacheSHA = cachedLayer.SHA
+	}
+
+	// metadata from the cache is written after, and replaces, metadata from the app image
+	var (
+		restored *platform.BuildpackLayerMetadata
+		source   string
+		skipped  []string
+	)
+	if inImage {
+		if reason := skipImageLayerReason(appLayer); reason != "" {
+			skipped = append(skipped, "app image "+reason)
+		} else {
+			restored, source = &appLayer, "app image"
+		}
+	}
+	if inCache {
+		if reason := skipCacheLayerReason(cachedLayer); reason != "" {
+			skipped = append(skipped, "cache "+reason)
+		} else {
+			restored, source = &cachedLayer, "cache"
+		}
+	}
+
+	switch {
+	case restored == nil:
+		explanation.Decision = platform.LayerSkipped
+		explanation.Reason = "metadata not restored: " + strings.Join(skipped, ", ")
+	case !restored.Cache:
+		explanation.Decision = platform.LayerRestoredFromImage
+		explanation.Reason = "metadata restored from app image, layer is marked as cache=false and is reused from the app image"
+	case !inCache:
+		explanation.Decision = platform.LayerRemoved
+		explanation.Reason = fmt.Sprintf("metadata restored from %s, layer is marked as cache=true but is not in the cache", source)
+	case restored.SHA != cachedLayer.SHA:
+		explanation.Decision = platform.LayerSHAMismatch
+		explanation.Reason = fmt.Sprintf("metadata restored from %s, layer sha does not match the cached layer sha", source)
+	default:
+		explanation.Decision = platform.LayerRestorableFromCache
+		explanation.Reason = fmt.Sprintf("metadata restored from %s, data is restorable from the cache", source)
+	}
+	return explanation
+}
+
+// skipImageLayerReason is why metadata for layer is not restored from the app image, or empty if it is restored
+func skipImageLayerReason(layer platform.BuildpackLayerMetadata) string {
+	if !layer.Launch {
+		return "marked as launch=false"
+	}
+	if layer.Build && !layer.Cache {
+		return "marked as build=true, cache=false"
+	}
+	return ""
+}
+
+// skipCacheLayerReason is why metadata for layer is not restored from the cache, or empty if it is restored
+func skipCacheLayerReason(layer platform.BuildpackLayerMetadata) string {
+	if !layer.Cache {
+		return "marked as cache=false"
+	}
+	// If launch=true, the metadata was restored from the app image or the layer is stale.
+	if layer.Launch {
+		return "marked as launch=true"
+	}
+	return ""
+}
+
+// cacheMetadata retrieves the cache metadata, or empty metadata if a usable cache is not provided
+func (a *Analyzer) cacheMetadata(cache Cache) (platform.CacheMetadata, error) {
+	if cache == nil {
+		a.Logger.Debug("Usable cache not provided, using empty cache metadata.")
+		return platform.CacheMetadata{}, nil
+	}
+	if !cache.Exists() {
+		a.Logger.Info("Layer cache not found")
+	}
+	cacheMeta, err := retrieveCacheMetadata(cache, a.Logger)
+	if err != nil {
+		return platform.CacheMetadata{}, errors.Wrap(err, "retrieving cache metadata")
+	}
+	return cacheMeta, nil
+}
+
 func (a *Analyzer) getImageIdentifier(image imgutil.Image) (*platform.ImageIdentifier, error) {
 	if !image.Found() {
 		a.Logger.Infof("Previous image with name %q not found", image.Name())
@@ -559,4 +559,100 @@ func testAnalyzer(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 	})
+
+	when("#Explain", func() {
+		var image *fakes.Image
+
+		it.Before(func() {
+			image = fakes.NewImage("image-repo-name", "", local.IDIdentifier{
+				ImageID: "s0m3D1g3sT",
+			})
+			metadata := h.MustReadFile(t, filepath.Join("testdata", "analyzer", "app_metadata.json"))
+			h.AssertNil(t, image.SetLabel("io.buildpacks.lifecycle.metadata", string(metadata)))
+		})
+
+		it.After(func() {
+			h.AssertNil(t, image.Cleanup())
+		})
+
+		decisions := func(explanation platform.AnalysisExplanation) map[string]platform.LayerDecision {
+			got := map[string]platform.LayerDecision{}
+			for _, layer := range explanation.Layers {
+				got[layer.Buildpack+":"+layer.Layer] = layer.Decision
+			}
+			return got
+		}
+
+		when("cache exists", func() {
+			it.Before(func() {
+				metadata := h.MustReadFile(t, filepath.Join("testdata", "analyzer", "cache_metadata.json"))
+				var cacheMetadata platform.CacheMetadata
+				h.AssertNil(t, json.Unmarshal(metadata, &cacheMetadata))
+				h.AssertNil(t, testCache.SetMetadata(cacheMetadata))
+				h.AssertNil(t, testCache.Commit())
+			})
+
+			it("explains the decision for each layer", func() {
+				explanation, err := analyzer.Explain(image, testCache)
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, decisions(explanation), map[string]platform.LayerDecision{
+					"metadata.buildpack:cache":                   platform.LayerRestorableFromCache,
+					"metadata.buildpack:cache-false":             platform.LayerSkipped,
+					"metadata.buildpack:launch":                  platform.LayerRestoredFromImage,
+					"metadata.buildpack:launch-build":            platform.LayerSkipped,
+					"metadata.buildpack:launch-build-cache":      platform.LayerSHAMismatch,
+					"metadata.buildpack:launch-cache":            platform.LayerSHAMismatch,
+					"metadata.buildpack:launch-cache-not-in-app": platform.LayerSkipped,
+					"metadata.buildpack:launch-false":            platform.LayerSkipped,
+					"no.cache.buildpack:some-layer":              platform.LayerRestoredFromImage,
+				})
+			})
+
+			it("includes the reason and shas for each layer", func() {
+				explanation, err := analyzer.Explain(image, testCache)
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, explanation.Layers[4], platform.LayerExplanation{
+					Buildpack: "metadata.buildpack",
+					Layer:     "launch-build-cache",
+					Decision:  platform.LayerSHAMismatch,
+					Reason:    "metadata restored from app image, layer sha does not match the cached layer sha",
+					ImageSHA:  "launch-build-cache-sha",
+					CacheSHA:  "launch-build-cache-old-sha",
+				})
+				h.AssertEq(t, explanation.Layers[1].Reason, "metadata not restored: cache marked as cache=false")
+			})
+
+			it("does not modify the layers directory", func() {
+				_, err := analyzer.Explain(image, testCache)
+				h.AssertNil(t, err)
+
+				files, err := ioutil.ReadDir(layerDir)
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(files), 0)
+			})
+		})
+
+		when("cache is empty", func() {
+			it("explains that cached layers will be removed", func() {
+				explanation, err := analyzer.Explain(image, testCache)
+				h.AssertNil(t, err)
+
+				got := decisions(explanation)
+				h.AssertEq(t, got["metadata.buildpack:launch-cache"], platform.LayerRemoved)
+				h.AssertEq(t, got["metadata.buildpack:launch-build-cache"], platform.LayerRemoved)
+			})
+		})
+
+		when("skip-layers is true", func() {
+			it("explains nothing", func() {
+				analyzer.SkipLayers = true
+
+				explanation, err := analyzer.Explain(image, testCache)
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(explanation.Layers), 0)
+			})
+		})
+	})
 }
@@ -14,9 +14,11 @@ type PathInfo struct {
 }
 
 // AddFilesToArchive writes entries describing all files to the provided TarWriter
+// A file with more than one link is written once, later links to it are written as hard links
 func AddFilesToArchive(tw TarWriter, files []PathInfo) error {
+	links := hardlinks{}
 	for _, file := range files {
-		if err := AddFileToArchive(tw, file.Path, file.Info); err != nil {
+		if err := addFileToArchive(tw, file.Path, file.Info, links); err != nil {
 			return err
 		}
 	}
@@ -25,24 +27,29 @@ func AddFilesToArchive(tw TarWriter, files []PathInfo) error {
 
 // AddFileToArchive writes an entry describing the file at path with the given os.FileInfo to the provided TarWriter
 func AddFileToArchive(tw TarWriter, path string, fi os.FileInfo) error {
+	return addFileToArchive(tw, path, fi, nil)
+}
+
+// hardlinks maps the key of each file with more than one link to the path it was first written with
+type hardlinks map[string]string
+
+func addFileToArchive(tw TarWriter, path string, fi os.FileInfo, links hardlinks) error {
 	if fi.Mode()&os.ModeSocket != 0 {
 		return nil
 	}
-	header, err := tar.FileInfoHeader(fi, "")
+	header, err := FileHeader(path, fi)
 	if err != nil {
 		return err
 	}
-	header.Name = path
-
-	if fi.Mode()&os.ModeSymlink != 0 {
-		var err error
-		target, err := os.Readlink(path)
-		if err != nil {
-			return err
+	if key, ok := hardlinkKey(fi); ok && links != nil {
+		if target, ok := links[key]; ok {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = target
+			header.Size = 0
+			return tw.WriteHeader(header)
 		}
-		header.Linkname = target
+		links[key] = path
 	}
-	addSysAttributes(header, fi)
 	if err := tw.WriteHeader(header); err != nil {
 		return err
 	}
@@ -59,14 +66,37 @@ func AddFileToArchive(tw TarWriter, path string, fi os.FileInfo) error {
 	return nil
 }
 
+// FileHeader returns the header AddFileToArchive writes for the file at path with the given os.FileInfo
+func FileHeader(path string, fi os.FileInfo) (*tar.Header, error) {
+	header, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return nil, err
+	}
+	header.Name = path
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		header.Linkname = target
+	}
+	if err := addSysAttributes(header, path, fi); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
 // AddDirToArchive walks dir writes entries describing dir and all of its children files to the provided TarWriter
+// A file with more than one link is written once, later links to it are written as hard links
 func AddDirToArchive(tw TarWriter, dir string) error {
 	dir = filepath.Clean(dir)
 
+	links := hardlinks{}
 	return filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		return AddFileToArchive(tw, file, fi)
+		return addFileToArchive(tw, file, fi, links)
 	})
 }
@@ -0,0 +1,110 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"golang.org/x/sys/unix"
+
+	"github.com/buildpacks/lifecycle/archive"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestArchiveLinux(t *testing.T) {
+	spec.Run(t, "linux", testArchiveLinux, spec.Report(report.Terminal{}))
+}
+
+func testArchiveLinux(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "archive-linux-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("files have extended attributes", func() {
+		var path string
+
+		it.Before(func() {
+			path = filepath.Join(tmpDir, "some-file")
+			h.AssertNil(t, ioutil.WriteFile(path, []byte("some-content"), 0644))
+			if err := unix.Setxattr(path, "user.some-attr", []byte("some-value"), 0); err != nil {
+				t.Skipf("extended attributes are not supported: %s", err)
+			}
+		})
+
+		it("adds them to the header", func() {
+			fi, err := os.Stat(path)
+			h.AssertNil(t, err)
+
+			hdr, err := archive.FileHeader(path, fi)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, hdr.PAXRecords["SCHILY.xattr.user.some-attr"], "some-value")
+		})
+
+		it("sets them on extracted files", func() {
+			ftr := &fakeTarReader{}
+			ftr.pushHeader(&tar.Header{
+				Name:       "extracted-file",
+				Typeflag:   tar.TypeReg,
+				Mode:       0644,
+				PAXRecords: map[string]string{"SCHILY.xattr.user.some-attr": "some-value"},
+			})
+			tr := archive.NewNormalizingTarReader(ftr)
+			tr.PrependDir(tmpDir)
+
+			h.AssertNil(t, archive.Extract(tr, tmpDir))
+
+			buf := make([]byte, 64)
+			n, err := unix.Getxattr(filepath.Join(tmpDir, "extracted-file"), "user.some-attr", buf)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(buf[:n]), "some-value")
+		})
+	})
+
+	it("extracts named pipes", func() {
+		ftr := &fakeTarReader{}
+		ftr.pushHeader(&tar.Header{
+			Name:     "some-fifo",
+			Typeflag: tar.TypeFifo,
+			Mode:     0640,
+		})
+		tr := archive.NewNormalizingTarReader(ftr)
+		tr.PrependDir(tmpDir)
+
+		h.AssertNil(t, archive.Extract(tr, tmpDir))
+
+		fi, err := os.Lstat(filepath.Join(tmpDir, "some-fifo"))
+		h.AssertNil(t, err)
+		h.AssertEq(t, fi.Mode(), os.ModeNamedPipe|0640)
+	})
+
+	it("keeps holes in sparse files", func() {
+		f, err := os.Open(filepath.Join("testdata", "sparse.tar"))
+		h.AssertNil(t, err)
+		defer f.Close()
+		tr := archive.NewNormalizingTarReader(tar.NewReader(f))
+		tr.PrependDir(tmpDir)
+
+		h.AssertNil(t, archive.Extract(tr, tmpDir))
+
+		fi, err := os.Stat(filepath.Join(tmpDir, "sparse-file"))
+		h.AssertNil(t, err)
+		h.AssertEq(t, fi.Size(), int64(1024*1024))
+		if blocks := fi.Sys().(*syscall.Stat_t).Blocks; blocks*512 >= fi.Size() {
+			t.Fatalf("expected sparse file to have holes, %d blocks allocated", blocks)
+		}
+	})
+}
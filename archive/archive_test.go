@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -136,6 +137,44 @@ func testWrite(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 		}
+
+		when("there are hard links", func() {
+			var srcDir string
+
+			it.Before(func() {
+				if runtime.GOOS == "windows" {
+					t.Skip("hard links are not preserved on windows")
+				}
+				srcDir = filepath.Join(tmpDir, "src")
+				h.AssertNil(t, os.Mkdir(srcDir, 0755))
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(srcDir, "a-file"), []byte("some-content"), 0644))
+				h.AssertNil(t, os.Link(filepath.Join(srcDir, "a-file"), filepath.Join(srcDir, "b-link")))
+			})
+
+			it("writes the contents once and later links as hard links", func() {
+				h.AssertNil(t, archive.AddDirToArchive(tw, srcDir))
+				h.AssertNil(t, file.Close())
+
+				file, err := os.Open(file.Name())
+				h.AssertNil(t, err)
+				defer file.Close()
+				tr := tar.NewReader(file)
+
+				_, err = tr.Next() // src dir
+				h.AssertNil(t, err)
+				header, err := tr.Next()
+				h.AssertNil(t, err)
+				h.AssertEq(t, header.Typeflag, byte(tar.TypeReg))
+				h.AssertEq(t, header.Size, int64(len("some-content")))
+
+				header, err = tr.Next()
+				h.AssertNil(t, err)
+				h.AssertEq(t, header.Name, filepath.ToSlash(filepath.Join(srcDir, "b-link")))
+				h.AssertEq(t, header.Typeflag, byte(tar.TypeLink))
+				h.AssertEq(t, header.Linkname, filepath.ToSlash(filepath.Join(srcDir, "a-file")))
+				h.AssertEq(t, header.Size, int64(0))
+			})
+		})
 	})
 }
 
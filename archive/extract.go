@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -15,8 +16,15 @@ type PathMode struct {
 	Mode os.FileMode
 }
 
-// Extract reads all entries from TarReader and extracts them to the filesystem
-func Extract(tr TarReader) error {
+// Extract reads all entries from TarReader and extracts them to the filesystem.
+// Entries must be within the root directory and are never written through symlinks, including symlinks created by
+// earlier entries; directories that are parents of root are skipped.
+func Extract(tr TarReader, root string) error {
+	extractRoot, err := newExtractRoot(root)
+	if err != nil {
+		return err
+	}
+
 	// Avoid umask from changing the file permissions in the tar file.
 	umask := setUmask(0)
 	defer setUmask(umask)
@@ -39,6 +47,13 @@ func Extract(tr TarReader) error {
 			return errors.Wrap(err, "error extracting from archive")
 		}
 
+		if hdr.Typeflag == tar.TypeDir && extractRoot.isParent(filepath.Clean(hdr.Name)) {
+			continue
+		}
+		if err := checkEntry(extractRoot, hdr); err != nil {
+			return err
+		}
+
 		switch hdr.Typeflag {
 		case tar.TypeDir:
 			if _, err := os.Stat(hdr.Name); os.IsNotExist(err) {
@@ -49,31 +64,113 @@ func Extract(tr TarReader) error {
 				return errors.Wrapf(err, "failed to create directory %q", hdr.Name)
 			}
 			dirsFound[hdr.Name] = true
-
-		case tar.TypeReg, tar.TypeRegA:
-			dirPath := filepath.Dir(hdr.Name)
-			if !dirsFound[dirPath] {
-				if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-					if err := os.MkdirAll(dirPath, applyUmask(os.ModePerm, umask)); err != nil {
-						return errors.Wrapf(err, "failed to create parent dir %q for file %q", dirPath, hdr.Name)
-					}
-					dirsFound[dirPath] = true
-				}
+			if err := setXattrs(hdr); err != nil {
+				return err
 			}
 
-			if err := writeFile(tr, hdr.Name, hdr.FileInfo().Mode(), buf); err != nil {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+			if err := ensureParentDir(hdr.Name, dirsFound, umask); err != nil {
+				return err
+			}
+			if err := replace(hdr.Name); err != nil {
+				return errors.Wrapf(err, "failed to write file %q", hdr.Name)
+			}
+			write := writeFile
+			if isSparse(hdr) {
+				write = writeSparseFile
+			}
+			if err := write(tr, hdr.Name, hdr.FileInfo().Mode(), buf); err != nil {
 				return errors.Wrapf(err, "failed to write file %q", hdr.Name)
 			}
+			if err := setXattrs(hdr); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if err := ensureParentDir(hdr.Name, dirsFound, umask); err != nil {
+				return err
+			}
+			if err := replace(hdr.Name); err != nil {
+				return errors.Wrapf(err, "failed to remove existing file %q", hdr.Name)
+			}
+			if err := os.Link(hdr.Linkname, hdr.Name); err != nil {
+				return errors.Wrapf(err, "failed to create hard link %q to %q", hdr.Name, hdr.Linkname)
+			}
 		case tar.TypeSymlink:
 			if err := createSymlink(hdr); err != nil {
 				return errors.Wrapf(err, "failed to create symlink %q with target %q", hdr.Name, hdr.Linkname)
 			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if err := ensureParentDir(hdr.Name, dirsFound, umask); err != nil {
+				return err
+			}
+			if err := replace(hdr.Name); err != nil {
+				return errors.Wrapf(err, "failed to remove existing file %q", hdr.Name)
+			}
+			if err := createDevice(hdr); err != nil {
+				return errors.Wrapf(err, "failed to create device %q", hdr.Name)
+			}
+			if err := setXattrs(hdr); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("unknown file type in tar %d", hdr.Typeflag)
 		}
 	}
 }
 
+// checkEntry returns an error if extracting hdr could modify files outside of root
+func checkEntry(root *extractRoot, hdr *tar.Header) error {
+	name := filepath.Clean(hdr.Name)
+	if hdr.Typeflag == tar.TypeDir && name == root.dir {
+		return nil
+	}
+	if err := root.check(name); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeDir {
+		if fi, err := os.Lstat(name); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("refusing to extract through symlink %q", name)
+		}
+	}
+	if hdr.Typeflag == tar.TypeLink {
+		target := filepath.Clean(hdr.Linkname)
+		if err := root.check(target); err != nil {
+			return errors.Wrapf(err, "hard link %q", name)
+		}
+		if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("refusing to create hard link %q to symlink %q", name, target)
+		}
+	}
+	return nil
+}
+
+func ensureParentDir(path string, dirsFound map[string]bool, umask int) error {
+	dirPath := filepath.Dir(path)
+	if dirsFound[dirPath] {
+		return nil
+	}
+	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(dirPath, applyUmask(os.ModePerm, umask)); err != nil {
+			return errors.Wrapf(err, "failed to create parent dir %q for file %q", dirPath, path)
+		}
+		dirsFound[dirPath] = true
+	}
+	return nil
+}
+
+// isSparse is true for entries written by GNU tar for sparse files, archive/tar reads the holes in them as zeros
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
 func applyUmask(mode os.FileMode, umask int) os.FileMode {
 	return os.FileMode(int(mode) &^ umask)
 }
@@ -91,3 +188,50 @@ func writeFile(in io.Reader, path string, mode os.FileMode, buf []byte) (err err
 	_, err = io.CopyBuffer(fh, in, buf)
 	return err
 }
+
+// writeSparseFile writes in like writeFile, skipping blocks of zeros so that they are left as holes in the file
+func writeSparseFile(in io.Reader, path string, mode os.FileMode, buf []byte) (err error) {
+	fh, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := fh.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	var size int64
+	block := buf[:sparseBlockSize]
+	for {
+		n, readErr := io.ReadFull(in, block)
+		if n > 0 {
+			if isZero(block[:n]) {
+				_, err = fh.Seek(int64(n), io.SeekCurrent)
+			} else {
+				_, err = fh.Write(block[:n])
+			}
+			if err != nil {
+				return err
+			}
+			size += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			// a file ending in a hole needs its size set explicitly
+			return fh.Truncate(size)
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+const sparseBlockSize = 4096
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package archive_test
 
 import (
 	"archive/tar"
+	"bytes"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -129,7 +130,7 @@ func testExtract(t *testing.T, when spec.G, it spec.S) {
 		})
 
 		it("extracts a tar file", func() {
-			h.AssertNil(t, archive.Extract(tr))
+			h.AssertNil(t, archive.Extract(tr, tmpDir))
 
 			for _, pathMode := range pathModes {
 				extractedFile := filepath.Join(tmpDir, pathMode.Path)
@@ -146,7 +147,7 @@ func testExtract(t *testing.T, when spec.G, it spec.S) {
 			h.AssertNil(t, err)
 			h.AssertNil(t, file.Close())
 
-			h.AssertError(t, archive.Extract(tr), "failed to create directory")
+			h.AssertError(t, archive.Extract(tr, tmpDir), "failed to create directory")
 		})
 
 		it("doesn't alter permissions of existing folders", func() {
@@ -154,7 +155,7 @@ func testExtract(t *testing.T, when spec.G, it spec.S) {
 			// Update permissions in case umask was applied.
 			h.AssertNil(t, os.Chmod(filepath.Join(tmpDir, "root"), 0744))
 
-			h.AssertNil(t, archive.Extract(tr))
+			h.AssertNil(t, archive.Extract(tr, tmpDir))
 			fileInfo, err := os.Stat(filepath.Join(tmpDir, "root"))
 			h.AssertNil(t, err)
 
@@ -165,5 +166,131 @@ func testExtract(t *testing.T, when spec.G, it spec.S) {
 				h.AssertEq(t, fileInfo.Mode(), os.ModeDir+0777)
 			}
 		})
+
+		it("extracts hard links to files in the archive", func() {
+			ftr.hdrs = append(ftr.hdrs, &tar.Header{
+				Name:     "root/standarddir/hardlink",
+				Typeflag: tar.TypeLink,
+				Linkname: "root/standarddir/somefile",
+			})
+			h.AssertNil(t, archive.Extract(tr, tmpDir))
+
+			target, err := os.Stat(filepath.Join(tmpDir, "root", "standarddir", "somefile"))
+			h.AssertNil(t, err)
+			link, err := os.Stat(filepath.Join(tmpDir, "root", "standarddir", "hardlink"))
+			h.AssertNil(t, err)
+			if !os.SameFile(target, link) {
+				t.Fatalf("expected hard link to be the same file as its target")
+			}
+		})
+	})
+
+	when("the archive contains entries that escape the root", func() {
+		var root, outside string
+
+		it.Before(func() {
+			root = filepath.Join(tmpDir, "root")
+			outside = filepath.Join(tmpDir, "outside")
+			h.AssertNil(t, os.Mkdir(root, 0755))
+			h.AssertNil(t, os.Mkdir(outside, 0755))
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(outside, "some-file"), []byte("some-data"), 0644))
+		})
+
+		it("skips directories that are parents of the root", func() {
+			ftr.hdrs = []*tar.Header{
+				{Name: ".", Typeflag: tar.TypeDir, Mode: int64(os.ModeDir | 0700)},
+				{Name: "root", Typeflag: tar.TypeDir, Mode: int64(os.ModeDir | 0755)},
+				{Name: "root/some-file", Typeflag: tar.TypeReg, Mode: 0644},
+			}
+
+			h.AssertNil(t, archive.Extract(tr, root))
+
+			h.AssertPathExists(t, filepath.Join(root, "some-file"))
+		})
+
+		it("refuses paths outside of the root", func() {
+			ftr.hdrs = []*tar.Header{
+				{Name: "root/../outside/escaped-file", Typeflag: tar.TypeReg, Mode: 0644},
+			}
+
+			h.AssertError(t, archive.Extract(tr, root), "refusing to extract")
+
+			h.AssertPathDoesNotExist(t, filepath.Join(outside, "escaped-file"))
+		})
+
+		it("refuses to extract through symlinks created by earlier entries", func() {
+			ftr.hdrs = []*tar.Header{
+				{Name: "root/some-link", Typeflag: tar.TypeSymlink, Linkname: filepath.Join("..", "outside")},
+				{Name: "root/some-link/escaped-file", Typeflag: tar.TypeReg, Mode: 0644},
+			}
+
+			h.AssertError(t, archive.Extract(tr, root), "refusing to extract through symlink")
+
+			h.AssertPathDoesNotExist(t, filepath.Join(outside, "escaped-file"))
+		})
+
+		it("refuses to create directories through symlinks", func() {
+			ftr.hdrs = []*tar.Header{
+				{Name: "root/some-link", Typeflag: tar.TypeSymlink, Linkname: filepath.Join("..", "outside")},
+				{Name: "root/some-link", Typeflag: tar.TypeDir, Mode: int64(os.ModeDir | 0777)},
+			}
+
+			h.AssertError(t, archive.Extract(tr, root), "refusing to extract through symlink")
+		})
+
+		it("replaces symlinks instead of writing through them", func() {
+			ftr.hdrs = []*tar.Header{
+				{Name: "root/some-link", Typeflag: tar.TypeSymlink, Linkname: filepath.Join("..", "outside", "some-file")},
+				{Name: "root/some-link", Typeflag: tar.TypeReg, Mode: 0644},
+			}
+
+			h.AssertNil(t, archive.Extract(tr, root))
+
+			contents, err := ioutil.ReadFile(filepath.Join(outside, "some-file"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "some-data")
+			fi, err := os.Lstat(filepath.Join(root, "some-link"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, fi.Mode().IsRegular(), true)
+		})
+
+		it("refuses hard links to files outside of the root", func() {
+			ftr.hdrs = []*tar.Header{
+				{Name: "root/some-hardlink", Typeflag: tar.TypeLink, Linkname: "outside/some-file"},
+			}
+
+			h.AssertError(t, archive.Extract(tr, root), "refusing to extract")
+
+			h.AssertPathDoesNotExist(t, filepath.Join(root, "some-hardlink"))
+		})
+
+		it("refuses hard links to symlinks", func() {
+			ftr.hdrs = []*tar.Header{
+				{Name: "root/some-link", Typeflag: tar.TypeSymlink, Linkname: filepath.Join("..", "outside", "some-file")},
+				{Name: "root/some-hardlink", Typeflag: tar.TypeLink, Linkname: "root/some-link"},
+			}
+
+			h.AssertError(t, archive.Extract(tr, root), "refusing to create hard link")
+		})
+	})
+
+	when("the archive contains sparse files", func() {
+		it("extracts them", func() {
+			f, err := os.Open(filepath.Join("testdata", "sparse.tar"))
+			h.AssertNil(t, err)
+			defer f.Close()
+			sparseReader := archive.NewNormalizingTarReader(tar.NewReader(f))
+			sparseReader.PrependDir(tmpDir)
+
+			h.AssertNil(t, archive.Extract(sparseReader, tmpDir))
+
+			contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "sparse-file"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(contents), 1024*1024)
+			h.AssertEq(t, string(contents[512*1024:512*1024+len("some-data")]), "some-data")
+			if !bytes.Equal(contents[:512*1024], make([]byte, 512*1024)) {
+				t.Fatalf("expected hole to read as zeros")
+			}
+		})
 	})
 }
@@ -20,10 +20,13 @@ type NormalizingTarReader struct {
 	excludedPaths []string
 }
 
-// Strip removes leading directories for any subsequently read *tar.Header
+// Strip removes leading directories for any subsequently read *tar.Header, including the targets of hard links
 func (tr *NormalizingTarReader) Strip(prefix string) {
 	tr.headerOpts = append(tr.headerOpts, func(header *tar.Header) *tar.Header {
 		header.Name = strings.TrimPrefix(header.Name, prefix)
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = strings.TrimPrefix(header.Linkname, prefix)
+		}
 		return header
 	})
 }
@@ -37,9 +40,13 @@ func (tr *NormalizingTarReader) ExcludePaths(paths []string) {
 
 // PrependDir will set the Name of any subsequently read *tar.Header the result of filepath.Join of dir and the
 //  original Name
+// Targets of hard links are relative to the root of the archive, so dir is prepended to them as well
 func (tr *NormalizingTarReader) PrependDir(dir string) {
 	tr.headerOpts = append(tr.headerOpts, func(hdr *tar.Header) *tar.Header {
 		hdr.Name = filepath.Join(dir, hdr.Name)
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = filepath.Join(dir, hdr.Linkname)
+		}
 		return hdr
 	})
 }
@@ -71,5 +78,8 @@ func (tr *NormalizingTarReader) Next() (*tar.Header, error) {
 		return tr.Next() // If entire path is stripped move on to the next entry
 	}
 	hdr.Name = filepath.FromSlash(hdr.Name)
+	if hdr.Typeflag == tar.TypeLink {
+		hdr.Linkname = filepath.FromSlash(hdr.Linkname)
+	}
 	return hdr, nil
 }
@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"io"
 	"math/rand"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
@@ -54,6 +55,14 @@ func testNormalizingTarReader(t *testing.T, when spec.G, it spec.S) {
 					h.AssertEq(t, hdr.Name, `/path`)
 				}
 			})
+
+			it("removes leading dirs from hard link targets", func() {
+				ftr.pushHeader(&tar.Header{Name: "/some/link", Typeflag: tar.TypeLink, Linkname: "/some/path"})
+				ntr.Strip("/some")
+				hdr, err := ntr.Next()
+				h.AssertNil(t, err)
+				h.AssertEq(t, hdr.Linkname, filepath.FromSlash("/path"))
+			})
 		})
 
 		when("#PrependDir", func() {
@@ -67,6 +76,22 @@ func testNormalizingTarReader(t *testing.T, when spec.G, it spec.S) {
 					h.AssertEq(t, hdr.Name, `/super-dir/some/path`)
 				}
 			})
+
+			it("prepends the dir to hard link targets", func() {
+				ftr.pushHeader(&tar.Header{Name: "/some/link", Typeflag: tar.TypeLink, Linkname: "/some/path"})
+				ntr.PrependDir("/super-dir")
+				hdr, err := ntr.Next()
+				h.AssertNil(t, err)
+				h.AssertEq(t, hdr.Linkname, filepath.FromSlash("/super-dir/some/path"))
+			})
+
+			it("does not prepend the dir to symlink targets", func() {
+				ftr.pushHeader(&tar.Header{Name: "/some/link", Typeflag: tar.TypeSymlink, Linkname: "../path"})
+				ntr.PrependDir("/super-dir")
+				hdr, err := ntr.Next()
+				h.AssertNil(t, err)
+				h.AssertEq(t, hdr.Linkname, "../path")
+			})
 		})
 
 		when("#Exclude", func() {
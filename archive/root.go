@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// extractRoot confines extracted entries to a directory
+type extractRoot struct {
+	dir      string
+	safeDirs map[string]bool // directories within dir that are known not to be symlinks
+}
+
+func newExtractRoot(dir string) (*extractRoot, error) {
+	if dir == "" {
+		return nil, errors.New("extraction root must not be empty")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &extractRoot{dir: dir, safeDirs: map[string]bool{dir: true}}, nil
+}
+
+// contains is true when path is dir or within it
+func (r *extractRoot) contains(path string) bool {
+	rel, err := filepath.Rel(r.dir, path)
+	return err == nil && filepath.IsAbs(path) && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isParent is true when path is a parent directory of dir
+func (r *extractRoot) isParent(path string) bool {
+	rel, err := filepath.Rel(path, r.dir)
+	return err == nil && filepath.IsAbs(path) && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// check returns an error unless path is within dir and none of the directories between dir and path are symlinks,
+// so that writing to path cannot modify files outside of dir
+func (r *extractRoot) check(path string) error {
+	if !r.contains(path) || path == r.dir {
+		return errors.Errorf("refusing to extract %q outside of %q", path, r.dir)
+	}
+	return r.checkDir(filepath.Dir(path))
+}
+
+func (r *extractRoot) checkDir(dir string) error {
+	if r.safeDirs[dir] {
+		return nil
+	}
+	if err := r.checkDir(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return errors.Errorf("refusing to extract through symlink %q", dir)
+	}
+	r.safeDirs[dir] = true
+	return nil
+}
+
+// replace removes the file at path unless it is a directory, so that it is replaced rather than written through
+func replace(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return errors.Errorf("refusing to replace directory %q", path)
+	}
+	return os.Remove(path)
+}
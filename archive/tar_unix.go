@@ -4,7 +4,9 @@ package archive
 
 import (
 	"archive/tar"
+	"fmt"
 	"os"
+	"syscall"
 
 	"golang.org/x/sys/unix"
 )
@@ -17,5 +19,30 @@ func createSymlink(hdr *tar.Header) error {
 	return os.Symlink(hdr.Linkname, hdr.Name)
 }
 
-func addSysAttributes(hdr *tar.Header, fi os.FileInfo) {
+// createDevice creates the character device, block device or named pipe described by hdr
+func createDevice(hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	}
+	return unix.Mknod(hdr.Name, mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+}
+
+// hardlinkKey identifies a regular file that has more than one link
+func hardlinkKey(fi os.FileInfo) (string, bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || !fi.Mode().IsRegular() || stat.Nlink < 2 {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino), true
+}
+
+// addSysAttributes adds PAXRecords containing extended attributes
+func addSysAttributes(hdr *tar.Header, path string, fi os.FileInfo) error {
+	return readXattrs(hdr, path)
 }
@@ -48,9 +48,20 @@ func createSymlink(hdr *tar.Header) error {
 	return syscall.CreateSymbolicLink(name, target, flags)
 }
 
+// createDevice fails, device files and named pipes cannot be created on Windows
+func createDevice(hdr *tar.Header) error {
+	return errors.New("device files are not supported on Windows")
+}
+
+// hardlinkKey does not identify any files, hard links are not preserved on Windows
+func hardlinkKey(fi os.FileInfo) (string, bool) {
+	return "", false
+}
+
 // addSysAttributes adds PAXRecords containing file attributes
-func addSysAttributes(hdr *tar.Header, fi os.FileInfo) {
+func addSysAttributes(hdr *tar.Header, path string, fi os.FileInfo) error {
 	attrs := fi.Sys().(*syscall.Win32FileAttributeData).FileAttributes
 	hdr.PAXRecords = map[string]string{}
 	hdr.PAXRecords[hdrFileAttributes] = strconv.FormatUint(uint64(attrs), 10)
+	return nil
 }
@@ -20,12 +20,21 @@ type TarWriter interface {
 
 // NormalizingTarWriter normalizes any written *tar.Header before passing it through to the wrapped TarWriter
 // NormalizingTarWriter always normalizes ModTime, Uname, and Gname
+// and removes extended attributes other than file capabilities
 // Other modifications can be enabled by invoking options on the NormalizingTarWriter
 type NormalizingTarWriter struct {
 	TarWriter
 	headerOpts []HeaderOpt
+	xattrs     bool
 }
 
+const (
+	// paxXattrPrefix prefixes the PAX records of extended attributes, as written by archive/tar and GNU tar
+	paxXattrPrefix = "SCHILY.xattr."
+	// xattrCapability holds the file capabilities of an executable, e.g. cap_net_bind_service
+	xattrCapability = "security.capability"
+)
+
 type HeaderOpt func(header *tar.Header) *tar.Header
 
 // WithUID sets Uid of any subsequently written *tar.Header to uid
@@ -52,9 +61,14 @@ func (tw *NormalizingTarWriter) WithModTime(modTime time.Time) {
 	})
 }
 
+// WithXattrs preserves all extended attributes of any subsequently written *tar.Header
+func (tw *NormalizingTarWriter) WithXattrs() {
+	tw.xattrs = true
+}
+
 // NewNormalizingTarWriter creates a NormalizingTarWriter that wraps the provided TarWriter
 func NewNormalizingTarWriter(tw TarWriter) *NormalizingTarWriter {
-	return &NormalizingTarWriter{tw, []HeaderOpt{}}
+	return &NormalizingTarWriter{TarWriter: tw, headerOpts: []HeaderOpt{}}
 }
 
 // WriteHeader writes the header to the wrapped TarWriter after applying standard and configured modifications
@@ -64,8 +78,22 @@ func (tw *NormalizingTarWriter) WriteHeader(hdr *tar.Header) error {
 	for _, opt := range tw.headerOpts {
 		hdr = opt(hdr)
 	}
-	hdr.Name = filepath.ToSlash(strings.TrimPrefix(hdr.Name, filepath.VolumeName(hdr.Name)))
+	hdr.Name = normalizePath(hdr.Name)
+	if hdr.Typeflag == tar.TypeLink {
+		hdr.Linkname = normalizePath(hdr.Linkname)
+	}
 	hdr.Uname = ""
 	hdr.Gname = ""
+	if !tw.xattrs {
+		for key := range hdr.PAXRecords {
+			if strings.HasPrefix(key, paxXattrPrefix) && key != paxXattrPrefix+xattrCapability {
+				delete(hdr.PAXRecords, key)
+			}
+		}
+	}
 	return tw.TarWriter.WriteHeader(hdr)
 }
+
+func normalizePath(path string) string {
+	return filepath.ToSlash(strings.TrimPrefix(path, filepath.VolumeName(path)))
+}
@@ -40,6 +40,21 @@ func testNormalizingTarWriter(t *testing.T, when spec.G, it spec.S) {
 			h.AssertEq(t, ftw.getLastHeader().Gname, "")
 		})
 
+		it("removes extended attributes other than file capabilities", func() {
+			h.AssertNil(t, ntw.WriteHeader(&tar.Header{
+				PAXRecords: map[string]string{
+					"SCHILY.xattr.security.capability": "some-capability",
+					"SCHILY.xattr.security.selinux":    "some-label",
+					"SCHILY.xattr.user.some-attr":      "some-value",
+					"MSWINDOWS.fileattr":               "32",
+				},
+			}))
+			h.AssertEq(t, ftw.getLastHeader().PAXRecords, map[string]string{
+				"SCHILY.xattr.security.capability": "some-capability",
+				"MSWINDOWS.fileattr":               "32",
+			})
+		})
+
 		when("windows", func() {
 			it.Before(func() {
 				if runtime.GOOS != "windows" {
@@ -53,6 +68,31 @@ func testNormalizingTarWriter(t *testing.T, when spec.G, it spec.S) {
 				}))
 				h.AssertEq(t, ftw.getLastHeader().Name, "/some/file/path")
 			})
+
+			it("converts path separators of hard link targets", func() {
+				h.AssertNil(t, ntw.WriteHeader(&tar.Header{
+					Name:     `c:\some\link`,
+					Typeflag: tar.TypeLink,
+					Linkname: `c:\some\file\path`,
+				}))
+				h.AssertEq(t, ftw.getLastHeader().Linkname, "/some/file/path")
+			})
+		})
+
+		when("#WithXattrs", func() {
+			it("preserves all extended attributes", func() {
+				ntw.WithXattrs()
+				h.AssertNil(t, ntw.WriteHeader(&tar.Header{
+					PAXRecords: map[string]string{
+						"SCHILY.xattr.security.capability": "some-capability",
+						"SCHILY.xattr.user.some-attr":      "some-value",
+					},
+				}))
+				h.AssertEq(t, ftw.getLastHeader().PAXRecords, map[string]string{
+					"SCHILY.xattr.security.capability": "some-capability",
+					"SCHILY.xattr.user.some-attr":      "some-value",
+				})
+			})
 		})
 
 		when("#WithUID", func() {
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs adds a PAX record for each extended attribute of the file at path
+func readXattrs(hdr *tar.Header, path string) error {
+	names, err := listXattrs(path)
+	if err != nil {
+		return errors.Wrapf(err, "listing extended attributes of %q", path)
+	}
+	for _, name := range names {
+		value, err := getXattr(path, name)
+		if err == unix.ENODATA {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "reading extended attribute %q of %q", name, path)
+		}
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
+		}
+		hdr.PAXRecords[paxXattrPrefix+name] = string(value)
+	}
+	return nil
+}
+
+// setXattrs sets the extended attributes in the PAX records of hdr on the extracted file.
+// Attributes are optional, those the filesystem or user cannot set are skipped.
+func setXattrs(hdr *tar.Header) error {
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, paxXattrPrefix)
+		err := unix.Lsetxattr(hdr.Name, name, []byte(value), 0)
+		if err == unix.EPERM || err == unix.EACCES || err == unix.ENOTSUP {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "setting extended attribute %q of %q", name, hdr.Name)
+		}
+	}
+	return nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err == unix.ENOTSUP || size == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Lgetxattr(path, name, buf); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package archive
+
+import (
+	"archive/tar"
+)
+
+// readXattrs does nothing, extended attributes are only preserved on Linux
+func readXattrs(hdr *tar.Header, path string) error {
+	return nil
+}
+
+// setXattrs does nothing, extended attributes are only preserved on Linux
+func setXattrs(hdr *tar.Header) error {
+	return nil
+}
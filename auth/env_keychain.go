@@ -1,19 +1,15 @@
 package auth
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
 
-	"github.com/go-logr/logr"
 	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/authn/k8schain"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
-	"k8s.io/klog/v2"
 )
 
 const EnvRegistryAuth = "CNB_REGISTRY_AUTH"
@@ -24,23 +20,7 @@ const EnvRegistryAuth = "CNB_REGISTRY_AUTH"
 // the docker config.json file
 // a credential provider for all of the major public clouds via k8schain
 func DefaultKeychain(images ...string) (authn.Keychain, error) {
-	envKeychain, err := EnvKeychain(EnvRegistryAuth)
-	if err != nil {
-		return nil, err
-	}
-
-	klog.SetLogger(logr.Discard())
-	// this adds a credential provider-like keychain for public cloud providers
-	clusterNodeChain, err := k8schain.NewNoClient(context.TODO()) // note: context is not used in the NewNoClient path
-	if err != nil {
-		return nil, err
-	}
-
-	return authn.NewMultiKeychain(
-		envKeychain,
-		InMemoryKeychain(authn.DefaultKeychain, images...),
-		clusterNodeChain,
-	), nil
+	return PlatformKeychain("", "", nil, images...)
 }
 
 // ResolvedKeychain is an implementation of authn.Keychain that stores credentials in memory.
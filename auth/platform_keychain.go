@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/k8schain"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// PlatformAuthDir is the directory within the platform directory that holds registry auth files.
+// Auth files directly in this directory apply to every phase,
+// auth files in a subdirectory named after a phase (e.g. <platform>/auth/exporter) apply only to that phase.
+const PlatformAuthDir = "auth"
+
+// CacheAuthDir is the subdirectory of the platform auth directory that holds the auth file for the cache image,
+// which may be on a different registry, with different credentials, from the app image.
+const CacheAuthDir = "cache"
+
+// EnvCacheRegistryAuth holds credentials for the cache image, in the same format as CNB_REGISTRY_AUTH
+const EnvCacheRegistryAuth = "CNB_CACHE_REGISTRY_AUTH"
+
+// platformAuthFiles are the accepted names of auth files, in dockerconfigjson format.
+// '.dockerconfigjson' is the key used by Kubernetes secrets of type kubernetes.io/dockerconfigjson.
+var platformAuthFiles = []string{".dockerconfigjson", "config.json"}
+
+type Logger interface {
+	Debugf(fmt string, v ...interface{})
+}
+
+// PlatformKeychain returns a keychain containing authentication configuration for the given images
+// from the following sources, if they exist, in order of precedence:
+// the CNB_REGISTRY_AUTH environment variable
+// the platform auth file for the given phase
+// the platform auth file for all phases
+// the docker config.json file
+// a credential provider for all of the major public clouds via k8schain
+// The source of the credentials used for each registry is logged, with secrets redacted.
+func PlatformKeychain(platformDir, phase string, logger Logger, images ...string) (authn.Keychain, error) {
+	envKeychain, err := EnvKeychain(EnvRegistryAuth)
+	if err != nil {
+		return nil, err
+	}
+	sources := []credentialSource{{name: EnvRegistryAuth, keychain: envKeychain}}
+
+	for _, path := range PlatformAuthFiles(platformDir, phase) {
+		fileKeychain, err := AuthFileKeychain(path, images...)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, credentialSource{name: fmt.Sprintf("platform auth file '%s'", path), keychain: fileKeychain})
+	}
+
+	klog.SetLogger(logr.Discard())
+	// this adds a credential provider-like keychain for public cloud providers
+	clusterNodeChain, err := k8schain.NewNoClient(context.TODO()) // note: context is not used in the NewNoClient path
+	if err != nil {
+		return nil, err
+	}
+
+	sources = append(sources,
+		credentialSource{name: "docker config", keychain: InMemoryKeychain(authn.DefaultKeychain, images...)},
+		credentialSource{name: "cloud provider credentials", keychain: clusterNodeChain},
+	)
+	return &sourcedKeychain{sources: sources, logger: logger, logged: map[string]bool{}}, nil
+}
+
+// PlatformAuthFiles returns the paths of the existing platform auth files that apply to the given phase,
+// the phase specific file first
+func PlatformAuthFiles(platformDir, phase string) []string {
+	if platformDir == "" {
+		return nil
+	}
+	var paths []string
+	dirs := []string{filepath.Join(platformDir, PlatformAuthDir)}
+	if phase != "" {
+		dirs = append([]string{filepath.Join(platformDir, PlatformAuthDir, phase)}, dirs...)
+	}
+	for _, dir := range dirs {
+		if path, ok := authFileIn(dir); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// authFileIn returns the path of the auth file in dir, if there is one
+func authFileIn(dir string) (string, bool) {
+	for _, file := range platformAuthFiles {
+		path := filepath.Join(dir, file)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// CacheKeychain returns a keychain for the cache image containing authentication configuration
+// from the following sources, if they exist, in order of precedence:
+// the CNB_CACHE_REGISTRY_AUTH environment variable
+// the platform auth file for the cache image (e.g. <platform>/auth/cache/config.json)
+// the given keychain, used for the other images of the phase
+func CacheKeychain(platformDir string, logger Logger, keychain authn.Keychain, cacheImage string) (authn.Keychain, error) {
+	envKeychain, err := EnvKeychain(EnvCacheRegistryAuth)
+	if err != nil {
+		return nil, err
+	}
+	sources := []credentialSource{{name: EnvCacheRegistryAuth, keychain: envKeychain}}
+
+	if platformDir != "" {
+		if path, ok := authFileIn(filepath.Join(platformDir, PlatformAuthDir, CacheAuthDir)); ok {
+			fileKeychain, err := AuthFileKeychain(path, cacheImage)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, credentialSource{name: fmt.Sprintf("platform auth file '%s'", path), keychain: fileKeychain})
+		}
+	}
+
+	sources = append(sources, credentialSource{name: "phase credentials", keychain: keychain})
+	return &sourcedKeychain{sources: sources, logger: logger, logged: map[string]bool{}}, nil
+}
+
+// AuthFileKeychain returns a keychain holding the credentials for the given images from the dockerconfigjson file at path.
+// Credentials are resolved when the keychain is created, including those from credential helpers named in the file,
+// as the file may not be readable once privileges are dropped.
+// Identity tokens are preserved so that registries which reject basic auth can use the OAuth2 refresh token flow.
+func AuthFileKeychain(path string, images ...string) (authn.Keychain, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening auth file '%s'", path)
+	}
+	defer f.Close()
+	cf, err := config.LoadFromReader(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing auth file '%s'", path)
+	}
+
+	keychain := &configKeychain{auths: map[string]authn.AuthConfig{}}
+	for _, image := range images {
+		ref, err := name.ParseReference(image, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+		registry := ref.Context().RegistryStr()
+		if _, ok := keychain.auths[registry]; ok {
+			continue
+		}
+		authConfig, err := authConfigFromFile(cf, registry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving credentials for registry '%s' from auth file '%s'", registry, path)
+		}
+		if authConfig != (authn.AuthConfig{}) {
+			keychain.auths[registry] = authConfig
+		}
+	}
+	return keychain, nil
+}
+
+func authConfigFromFile(cf *configfile.ConfigFile, registry string) (authn.AuthConfig, error) {
+	key := registry
+	if key == name.DefaultRegistry {
+		key = authn.DefaultAuthKey
+	}
+	cfg, err := cf.GetAuthConfig(key)
+	if err != nil {
+		return authn.AuthConfig{}, err
+	}
+	return authn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}, nil
+}
+
+// configKeychain is an implementation of authn.Keychain that stores resolved auth configs in memory.
+type configKeychain struct {
+	auths map[string]authn.AuthConfig
+}
+
+func (k *configKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	if authConfig, ok := k.auths[resource.RegistryStr()]; ok {
+		return authn.FromConfig(authConfig), nil
+	}
+	return authn.Anonymous, nil
+}
+
+type credentialSource struct {
+	name     string
+	keychain authn.Keychain
+}
+
+// sourcedKeychain resolves credentials from the first source that has credentials for a registry
+// and logs the source used the first time each registry is resolved
+type sourcedKeychain struct {
+	sources []credentialSource
+	logger  Logger
+
+	mu     sync.Mutex
+	logged map[string]bool
+}
+
+func (k *sourcedKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	registry := resource.RegistryStr()
+	for _, source := range k.sources {
+		authenticator, err := source.keychain.Resolve(resource)
+		if err != nil {
+			return nil, err
+		}
+		if authenticator == authn.Anonymous {
+			continue
+		}
+		k.log(registry, func() string {
+			authConfig, err := authenticator.Authorization()
+			if err != nil {
+				return fmt.Sprintf("Using credentials from %s for registry '%s'", source.name, registry)
+			}
+			return fmt.Sprintf("Using %s from %s for registry '%s'", DescribeAuthConfig(authConfig), source.name, registry)
+		})
+		return authenticator, nil
+	}
+	k.log(registry, func() string {
+		return fmt.Sprintf("No credentials found for registry '%s', using anonymous access", registry)
+	})
+	return authn.Anonymous, nil
+}
+
+func (k *sourcedKeychain) log(registry string, msg func() string) {
+	if k.logger == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.logged[registry] {
+		return
+	}
+	k.logged[registry] = true
+	k.logger.Debugf("%s", msg())
+}
+
+// DescribeAuthConfig describes the kind of credentials in authConfig without revealing any secrets
+func DescribeAuthConfig(authConfig *authn.AuthConfig) string {
+	switch {
+	case authConfig.IdentityToken != "":
+		return "identity token <redacted>"
+	case authConfig.RegistryToken != "":
+		return "bearer token <redacted>"
+	case authConfig.Username != "":
+		return fmt.Sprintf("username '%s' and password <redacted>", authConfig.Username)
+	case authConfig.Auth != "":
+		if decoded, err := base64.StdEncoding.DecodeString(authConfig.Auth); err == nil {
+			if parts := strings.SplitN(string(decoded), ":", 2); len(parts) == 2 {
+				return fmt.Sprintf("username '%s' and password <redacted>", parts[0])
+			}
+		}
+		return "basic auth <redacted>"
+	default:
+		return "empty credentials"
+	}
+}
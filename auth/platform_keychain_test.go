@@ -0,0 +1,259 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/auth"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestPlatformKeychain(t *testing.T) {
+	spec.Run(t, "PlatformKeychain", testPlatformKeychain, spec.Report(report.Terminal{}))
+}
+
+func testPlatformKeychain(t *testing.T, when spec.G, it spec.S) {
+	var platformDir string
+
+	it.Before(func() {
+		var err error
+		platformDir, err = ioutil.TempDir("", "lifecycle.platform")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(platformDir))
+	})
+
+	writeAuthFile := func(path string, auths map[string]authn.AuthConfig) {
+		t.Helper()
+		contents, err := json.Marshal(map[string]interface{}{"auths": auths})
+		h.AssertNil(t, err)
+		h.AssertNil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		h.AssertNil(t, ioutil.WriteFile(path, contents, 0600))
+	}
+
+	resolve := func(keychain authn.Keychain, registry string) *authn.AuthConfig {
+		t.Helper()
+		reg, err := name.NewRegistry(registry, name.WeakValidation)
+		h.AssertNil(t, err)
+		authenticator, err := keychain.Resolve(reg)
+		h.AssertNil(t, err)
+		authConfig, err := authenticator.Authorization()
+		h.AssertNil(t, err)
+		return authConfig
+	}
+
+	when("#PlatformAuthFiles", func() {
+		it("returns the phase specific file before the file for all phases", func() {
+			writeAuthFile(filepath.Join(platformDir, "auth", "config.json"), nil)
+			writeAuthFile(filepath.Join(platformDir, "auth", "exporter", ".dockerconfigjson"), nil)
+
+			h.AssertEq(t, auth.PlatformAuthFiles(platformDir, "exporter"), []string{
+				filepath.Join(platformDir, "auth", "exporter", ".dockerconfigjson"),
+				filepath.Join(platformDir, "auth", "config.json"),
+			})
+			h.AssertEq(t, auth.PlatformAuthFiles(platformDir, "analyzer"), []string{
+				filepath.Join(platformDir, "auth", "config.json"),
+			})
+		})
+
+		it("returns nothing when there are no auth files", func() {
+			h.AssertEq(t, len(auth.PlatformAuthFiles(platformDir, "exporter")), 0)
+		})
+	})
+
+	when("#AuthFileKeychain", func() {
+		var authFile string
+
+		it.Before(func() {
+			authFile = filepath.Join(platformDir, "auth", ".dockerconfigjson")
+			writeAuthFile(authFile, map[string]authn.AuthConfig{
+				"some-registry.com":           {Username: "user", Password: "password"},
+				"https://index.docker.io/v1/": {Auth: "dXNlcjpwYXNzd29yZA=="},
+				"token-registry.com":          {IdentityToken: "some-refresh-token"},
+			})
+		})
+
+		it("resolves credentials for the registries of the given images", func() {
+			keychain, err := auth.AuthFileKeychain(authFile, "some-registry.com/some/image", "some/image", "token-registry.com/image")
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, resolve(keychain, "some-registry.com"), &authn.AuthConfig{Username: "user", Password: "password"})
+			h.AssertEq(t, resolve(keychain, "index.docker.io"), &authn.AuthConfig{Username: "user", Password: "password"})
+			h.AssertEq(t, resolve(keychain, "token-registry.com"), &authn.AuthConfig{IdentityToken: "some-refresh-token"})
+		})
+
+		it("does not resolve registries without images", func() {
+			keychain, err := auth.AuthFileKeychain(authFile, "some/image")
+			h.AssertNil(t, err)
+
+			reg, err := name.NewRegistry("some-registry.com", name.WeakValidation)
+			h.AssertNil(t, err)
+			authenticator, err := keychain.Resolve(reg)
+			h.AssertNil(t, err)
+			h.AssertEq(t, authenticator, authn.Anonymous)
+		})
+
+		when("the file is not valid json", func() {
+			it("errors", func() {
+				h.AssertNil(t, ioutil.WriteFile(authFile, []byte("not-json"), 0600))
+
+				_, err := auth.AuthFileKeychain(authFile)
+				h.AssertError(t, err, "parsing auth file")
+			})
+		})
+	})
+
+	when("#PlatformKeychain", func() {
+		var (
+			logHandler *memory.Handler
+			logger     *log.Logger
+		)
+
+		it.Before(func() {
+			logHandler = memory.New()
+			logger = &log.Logger{Handler: logHandler, Level: log.DebugLevel}
+
+			writeAuthFile(filepath.Join(platformDir, "auth", "config.json"), map[string]authn.AuthConfig{
+				"some-registry.com":  {Username: "all-phases-user", Password: "all-phases-password"},
+				"other-registry.com": {Username: "other-user", Password: "other-password"},
+			})
+			writeAuthFile(filepath.Join(platformDir, "auth", "exporter", "config.json"), map[string]authn.AuthConfig{
+				"some-registry.com": {Username: "exporter-user", Password: "exporter-password"},
+			})
+		})
+
+		it("prefers the phase specific auth file", func() {
+			keychain, err := auth.PlatformKeychain(platformDir, "exporter", logger, "some-registry.com/image", "other-registry.com/image")
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, resolve(keychain, "some-registry.com").Username, "exporter-user")
+			h.AssertEq(t, resolve(keychain, "other-registry.com").Username, "other-user")
+
+			keychain, err = auth.PlatformKeychain(platformDir, "analyzer", logger, "some-registry.com/image")
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, resolve(keychain, "some-registry.com").Username, "all-phases-user")
+		})
+
+		it("logs the source of the credentials for each registry without secrets", func() {
+			keychain, err := auth.PlatformKeychain(platformDir, "exporter", logger, "some-registry.com/image")
+			h.AssertNil(t, err)
+
+			resolve(keychain, "some-registry.com")
+			resolve(keychain, "some-registry.com")
+			resolve(keychain, "unknown-registry.com")
+
+			logs := h.AllLogs(logHandler)
+			h.AssertStringContains(t, logs, fmt.Sprintf(
+				"Using username 'exporter-user' and password <redacted> from platform auth file '%s' for registry 'some-registry.com'",
+				filepath.Join(platformDir, "auth", "exporter", "config.json"),
+			))
+			h.AssertStringContains(t, logs, "No credentials found for registry 'unknown-registry.com', using anonymous access")
+			h.AssertStringDoesNotContain(t, logs, "exporter-password")
+			h.AssertEq(t, strings.Count(logs, "for registry 'some-registry.com'"), 1)
+		})
+	})
+
+	when("#CacheKeychain", func() {
+		var phaseKeychain authn.Keychain
+
+		it.Before(func() {
+			writeAuthFile(filepath.Join(platformDir, "auth", "config.json"), map[string]authn.AuthConfig{
+				"some-registry.com":  {Username: "app-user", Password: "app-password"},
+				"cache-registry.com": {Username: "app-user", Password: "app-password"},
+			})
+			var err error
+			phaseKeychain, err = auth.PlatformKeychain(platformDir, "exporter", nil, "some-registry.com/image", "cache-registry.com/cache")
+			h.AssertNil(t, err)
+		})
+
+		it("prefers the cache auth file", func() {
+			writeAuthFile(filepath.Join(platformDir, "auth", "cache", "config.json"), map[string]authn.AuthConfig{
+				"cache-registry.com": {Username: "cache-user", Password: "cache-password"},
+			})
+
+			keychain, err := auth.CacheKeychain(platformDir, nil, phaseKeychain, "cache-registry.com/cache")
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, resolve(keychain, "cache-registry.com").Username, "cache-user")
+		})
+
+		it("prefers CNB_CACHE_REGISTRY_AUTH", func() {
+			h.AssertNil(t, os.Setenv(auth.EnvCacheRegistryAuth, `{"cache-registry.com": "Basic Y2FjaGUtZW52LXVzZXI6cGFzc3dvcmQ="}`))
+			defer os.Unsetenv(auth.EnvCacheRegistryAuth)
+
+			keychain, err := auth.CacheKeychain(platformDir, nil, phaseKeychain, "cache-registry.com/cache")
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, resolve(keychain, "cache-registry.com").Auth, "Y2FjaGUtZW52LXVzZXI6cGFzc3dvcmQ=")
+		})
+
+		it("falls back to the credentials of the phase", func() {
+			keychain, err := auth.CacheKeychain(platformDir, nil, phaseKeychain, "cache-registry.com/cache")
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, resolve(keychain, "cache-registry.com").Username, "app-user")
+		})
+	})
+
+	when("a registry rejects basic auth", func() {
+		var server *httptest.Server
+
+		it.Before(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/token":
+					h.AssertNil(t, r.ParseForm())
+					if r.Method != http.MethodPost || r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "some-refresh-token" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write([]byte(`{"access_token": "some-access-token"}`))
+				case r.Header.Get("Authorization") == "Bearer some-access-token":
+					w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+					w.Header().Set("Docker-Content-Digest", "sha256:a27a27006b74a056bed5d9edcebc394783880abe8691a8c87c78b7cffa6fa5ad")
+					w.Header().Set("Content-Length", "2")
+				default:
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="some-service"`, server.URL))
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		it("exchanges the identity token from the auth file for an access token", func() {
+			registry := strings.TrimPrefix(server.URL, "http://")
+			writeAuthFile(filepath.Join(platformDir, "auth", "config.json"), map[string]authn.AuthConfig{
+				registry: {IdentityToken: "some-refresh-token"},
+			})
+			keychain, err := auth.PlatformKeychain(platformDir, "analyzer", nil, registry+"/some/image")
+			h.AssertNil(t, err)
+
+			ref, err := name.ParseReference(registry+"/some/image", name.WeakValidation)
+			h.AssertNil(t, err)
+			_, err = remote.Head(ref, remote.WithAuthFromKeychain(keychain))
+			h.AssertNil(t, err)
+		})
+	})
+}
@@ -3,7 +3,9 @@ package lifecycle
 import (
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 
 	"github.com/buildpacks/lifecycle/api"
@@ -42,6 +44,9 @@ type Builder struct {
 	Out, Err       io.Writer
 	Logger         Logger
 	BuildpackStore BuildpackStore
+	DebugDir       string
+	RedactPatterns []*regexp.Regexp
+	DebugShell     *buildpack.DebugShell
 }
 
 func (b *Builder) Build() (*platform.BuildMetadata, error) {
@@ -49,6 +54,15 @@ func (b *Builder) Build() (*platform.BuildMetadata, error) {
 	if err != nil {
 		return nil, err
 	}
+	var debugDir string
+	if b.DebugDir != "" {
+		if debugDir, err = filepath.Abs(b.DebugDir); err != nil {
+			return nil, err
+		}
+		if err := removeBuildSnapshots(debugDir); err != nil {
+			return nil, err
+		}
+	}
 
 	processMap := newProcessMap()
 	plan := b.Plan
@@ -56,12 +70,15 @@ func (b *Builder) Build() (*platform.BuildMetadata, error) {
 	var slices []layers.Slice
 	var labels []buildpack.Label
 
-	for _, bp := range b.Group.Group {
+	for i, bp := range b.Group.Group {
 		bpTOML, err := b.BuildpackStore.Lookup(bp.ID, bp.Version)
 		if err != nil {
 			return nil, err
 		}
 
+		if debugDir != "" {
+			config.DebugPath = buildSnapshotPath(debugDir, i, bp.ID)
+		}
 		bpPlan := plan.Find(bp.ID)
 		br, err := bpTOML.Build(bpPlan, config)
 		if err != nil {
@@ -127,16 +144,38 @@ func (b *Builder) BuildConfig() (buildpack.BuildConfig, error) {
 	}
 
 	return buildpack.BuildConfig{
-		Env:         b.Env,
-		AppDir:      appDir,
-		PlatformDir: platformDir,
-		LayersDir:   layersDir,
-		Out:         b.Out,
-		Err:         b.Err,
-		Logger:      b.Logger,
+		Env:            b.Env,
+		AppDir:         appDir,
+		PlatformDir:    platformDir,
+		LayersDir:      layersDir,
+		Out:            b.Out,
+		Err:            b.Err,
+		Logger:         b.Logger,
+		RedactPatterns: b.RedactPatterns,
+		DebugShell:     b.DebugShell,
 	}, nil
 }
 
+// buildSnapshotPath returns the file the snapshot of the build invocation of the buildpack at index in the group is written to,
+// the index orders the files and keeps buildpacks with the same escaped ID apart
+func buildSnapshotPath(debugDir string, index int, bpID string) string {
+	return filepath.Join(debugDir, fmt.Sprintf("%d-%s.toml", index, launch.EscapeID(bpID)))
+}
+
+// removeBuildSnapshots removes the snapshots written by a previous build
+func removeBuildSnapshots(debugDir string) error {
+	paths, err := filepath.Glob(filepath.Join(debugDir, "[0-9]*-*.toml"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type processMap struct {
 	typeToProcess map[string]launch.Process
 	defaultType   string
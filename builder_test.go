@@ -646,6 +646,35 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 					})
 				})
 			})
+
+			when("there is a debug directory", func() {
+				var debugDir string
+
+				it.Before(func() {
+					debugDir = filepath.Join(layersDir, ".debug", "build")
+					builder.DebugDir = debugDir
+					builder.Group.Group[1].ID = "some/B"
+					h.AssertNil(t, os.MkdirAll(debugDir, 0755))
+					h.Mkfile(t, "", filepath.Join(debugDir, "2-old.toml"))
+				})
+
+				it("gives each buildpack invocation its own snapshot file", func() {
+					bpA := testmock.NewMockBuildpack(mockCtrl)
+					buildpackStore.EXPECT().Lookup("A", "v1").Return(bpA, nil)
+					configA := config
+					configA.DebugPath = filepath.Join(debugDir, "0-A.toml")
+					bpA.EXPECT().Build(gomock.Any(), configA).Return(buildpack.BuildResult{}, nil)
+					bpB := testmock.NewMockBuildpack(mockCtrl)
+					buildpackStore.EXPECT().Lookup("some/B", "v2").Return(bpB, nil)
+					configB := config
+					configB.DebugPath = filepath.Join(debugDir, "1-some_B.toml")
+					bpB.EXPECT().Build(gomock.Any(), configB).Return(buildpack.BuildResult{}, nil)
+
+					_, err := builder.Build()
+					h.AssertNil(t, err)
+					h.AssertPathDoesNotExist(t, filepath.Join(debugDir, "2-old.toml"))
+				})
+			})
 		})
 
 		when("building fails", func() {
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -34,6 +35,13 @@ type BuildConfig struct {
 	Out         io.Writer
 	Err         io.Writer
 	Logger      Logger
+
+	// DebugPath, when set, is the file a snapshot of the invocation of the build executable is written to
+	DebugPath string
+	// RedactPatterns match the names of environment variables redacted from snapshots, defaulting to DefaultRedactPatterns
+	RedactPatterns []*regexp.Regexp
+	// DebugShell, when set, is run when a build executable fails
+	DebugShell *DebugShell
 }
 
 type BuildResult struct {
@@ -79,7 +87,7 @@ func (b *Descriptor) Build(bpPlan Plan, config BuildConfig) (BuildResult, error)
 		return BuildResult{}, err
 	}
 
-	if err := b.runBuildCmd(bpLayersDir, bpPlanPath, config); err != nil {
+	if err := b.runBuildCmd(bpLayersDir, bpPlanPath, bpPlan, config); err != nil {
 		return BuildResult{}, err
 	}
 
@@ -163,7 +171,7 @@ func WriteTOML(path string, data interface{}) error {
 	return toml.NewEncoder(f).Encode(data)
 }
 
-func (b *Descriptor) runBuildCmd(bpLayersDir, bpPlanPath string, config BuildConfig) error {
+func (b *Descriptor) runBuildCmd(bpLayersDir, bpPlanPath string, bpPlan Plan, config BuildConfig) error {
 	cmd := exec.Command(
 		filepath.Join(b.Dir, "bin", "build"),
 		bpLayersDir,
@@ -185,7 +193,22 @@ func (b *Descriptor) runBuildCmd(bpLayersDir, bpPlanPath string, config BuildCon
 	}
 	cmd.Env = append(cmd.Env, EnvBuildpackDir+"="+b.Dir)
 
+	if config.DebugPath != "" {
+		if err := b.writeBuildSnapshot(cmd.Args, cmd.Dir, cmd.Env, bpPlan, config); err != nil {
+			return err
+		}
+	}
+
 	if err := cmd.Run(); err != nil {
+		if config.DebugShell != nil {
+			config.DebugShell.Run(Failure{
+				Buildpack: GroupBuildpack{ID: b.Buildpack.ID, Version: b.Buildpack.Version},
+				Phase:     "build",
+				Cmd:       cmd,
+				ArgNames:  []string{"layers dir", "platform dir", "plan path"},
+				Err:       err,
+			}, config.Logger)
+		}
 		return NewLifecycleError(err, ErrTypeBuildpack)
 	}
 	return nil
@@ -302,6 +325,10 @@ func (b *Descriptor) readOutputFiles(bpLayersDir, bpPlanPath string, bpPlanIn Pl
 		return BuildResult{}, err
 	}
 
+	if err := validateHealthChecks(launchTOML.Processes); err != nil {
+		return BuildResult{}, err
+	}
+
 	// set data from launch.toml
 	br.Labels = append([]Label{}, launchTOML.Labels...)
 	for i := range launchTOML.Processes {
@@ -343,6 +370,18 @@ func validateNoMultipleDefaults(processes []launch.Process) error {
 	return nil
 }
 
+func validateHealthChecks(processes []launch.Process) error {
+	for _, process := range processes {
+		if process.HealthCheck == nil {
+			continue
+		}
+		if err := process.HealthCheck.Validate(); err != nil {
+			return fmt.Errorf("invalid health check for process type '%s': %s", process.Type, err)
+		}
+	}
+	return nil
+}
+
 func validateBOM(bom []BOMEntry, bpAPI string) error {
 	if api.MustParse(bpAPI).Compare(api.MustParse("0.5")) < 0 {
 		for _, entry := range bom {
@@ -322,6 +322,22 @@ func testBuild(t *testing.T, when spec.G, it spec.S) {
 							t.Fatalf("Unexpected metadata:\n%s\n", s)
 						}
 					})
+
+					it("should include health checks", func() {
+						h.Mkfile(t,
+							`[[processes]]`+"\n"+
+								`type = "web"`+"\n"+
+								`command = "some-cmd"`+"\n"+
+								`[processes.health-check]`+"\n"+
+								`type = "http"`+"\n"+
+								`path = "/healthz"`+"\n"+
+								`interval = "10s"`+"\n",
+							filepath.Join(appDir, "launch-A-v1.toml"),
+						)
+						br, err := bpTOML.Build(buildpack.Plan{}, config)
+						h.AssertNil(t, err)
+						h.AssertEq(t, br.Processes[0].HealthCheck, &launch.HealthCheck{Type: "http", Path: "/healthz", Interval: "10s"})
+					})
 				})
 
 				it("should include slices", func() {
@@ -366,6 +382,33 @@ func testBuild(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("building succeeds with a debug path", func() {
+			it.Before(func() {
+				mockEnv.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1", "SOME_API_TOKEN=some-token"), nil)
+				config.DebugPath = filepath.Join(layersDir, ".debug", "build", "0-A.toml")
+			})
+
+			it("should write a snapshot of the invocation with secrets redacted", func() {
+				plan := buildpack.Plan{Entries: []buildpack.Require{{Name: "some-dep"}}}
+				if _, err := bpTOML.Build(plan, config); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				var snapshot buildpack.BuildSnapshot
+				_, err := toml.DecodeFile(filepath.Join(layersDir, ".debug", "build", "0-A.toml"), &snapshot)
+				h.AssertNil(t, err)
+				h.AssertEq(t, snapshot.Buildpack, buildpack.GroupBuildpack{ID: "A", Version: "v1"})
+				h.AssertEq(t, snapshot.WorkingDir, appDir)
+				h.AssertEq(t, snapshot.Args[:3], []string{
+					filepath.Join(bpTOML.Dir, "bin", "build"),
+					filepath.Join(layersDir, "A"),
+					platformDir,
+				})
+				h.AssertContains(t, snapshot.Env, "TEST_ENV=Av1", "SOME_API_TOKEN=<redacted>", "CNB_BUILDPACK_DIR="+bpTOML.Dir)
+				h.AssertEq(t, snapshot.Plan, plan)
+			})
+		})
+
 		when("building succeeds with a clear env", func() {
 			it.Before(func() {
 				mockEnv.EXPECT().List().Return(append(os.Environ(), "TEST_ENV=cleared"))
@@ -592,6 +635,25 @@ func testBuild(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("a process declares an invalid health check", func() {
+				it.Before(func() {
+					mockEnv.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil)
+				})
+
+				it("should error", func() {
+					h.Mkfile(t,
+						`[[processes]]`+"\n"+
+							`type = "some-type"`+"\n"+
+							`command = "some-cmd"`+"\n"+
+							`[processes.health-check]`+"\n"+
+							`type = "exec"`+"\n",
+						filepath.Join(appDir, "launch-A-v1.toml"),
+					)
+					_, err := bpTOML.Build(buildpack.Plan{}, config)
+					h.AssertError(t, err, "invalid health check for process type 'some-type': exec health checks require a command")
+				})
+			})
+
 			when("the launch, cache and build flags are in the top level", func() {
 				it("should error", func() {
 					mockEnv.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil)
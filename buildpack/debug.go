@@ -0,0 +1,65 @@
+package buildpack
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const redacted = "<redacted>"
+
+// DefaultRedactPatterns match the names of environment variables whose values are redacted from build snapshots
+var DefaultRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(secret|token|passw(or)?d|credential|auth|private|api_?key|access_?key)`),
+}
+
+// BuildSnapshot records how the build executable of a buildpack was invoked
+type BuildSnapshot struct {
+	Buildpack  GroupBuildpack `toml:"buildpack"`
+	Args       []string       `toml:"args"`
+	WorkingDir string         `toml:"working-dir"`
+	Env        []string       `toml:"env"`
+	Plan       Plan           `toml:"plan"`
+}
+
+// RedactEnv returns a copy of env with the values of variables whose names match any of patterns redacted
+func RedactEnv(env []string, patterns []*regexp.Regexp) []string {
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 && matchesAny(parts[0], patterns) {
+			kv = parts[0] + "=" + redacted
+		}
+		out = append(out, kv)
+	}
+	return out
+}
+
+func matchesAny(name string, patterns []*regexp.Regexp) bool {
+	for _, p := range patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Descriptor) writeBuildSnapshot(args []string, workingDir string, env []string, bpPlan Plan, config BuildConfig) error {
+	patterns := config.RedactPatterns
+	if patterns == nil {
+		patterns = DefaultRedactPatterns
+	}
+	snapshot := BuildSnapshot{
+		Buildpack:  GroupBuildpack{ID: b.Buildpack.ID, Version: b.Buildpack.Version},
+		Args:       args,
+		WorkingDir: workingDir,
+		Env:        RedactEnv(env, patterns),
+		Plan:       bpPlan,
+	}
+	config.Logger.Debugf("Writing build snapshot for buildpack '%s' to '%s'", b.Buildpack.ID, config.DebugPath)
+	if err := WriteTOML(config.DebugPath, snapshot); err != nil {
+		return errors.Wrapf(err, "write build snapshot '%s'", config.DebugPath)
+	}
+	return nil
+}
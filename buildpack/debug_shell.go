@@ -0,0 +1,70 @@
+package buildpack
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const EnvDebugCommand = "CNB_DEBUG_COMMAND"
+
+// Failure describes a buildpack executable that failed
+type Failure struct {
+	Buildpack GroupBuildpack
+	Phase     string // detect or build
+	Cmd       *exec.Cmd
+	ArgNames  []string // describe each argument of Cmd after the executable
+	Output    []byte   // output of Cmd, when it was captured
+	Err       error
+}
+
+// DebugShell runs an interactive shell when a buildpack executable fails.
+// The shell has the environment, working directory and arguments the executable had,
+// and runs before any files given to the executable are cleaned up.
+type DebugShell struct {
+	Path string
+	In   io.Reader
+	Out  io.Writer
+	Err  io.Writer
+
+	mu sync.Mutex
+}
+
+// Run runs the shell for the failure and waits for it to exit.
+// Only one shell runs at a time, as buildpacks may be detected concurrently.
+func (s *DebugShell) Run(f Failure, logger Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(f.Output) > 0 {
+		fmt.Fprintf(s.Err, "======== Output: %s ========\n%s\n", f.Buildpack, f.Output)
+	}
+	fmt.Fprintf(s.Err, "Buildpack '%s' failed to %s: %s\n", f.Buildpack, f.Phase, f.Err)
+	fmt.Fprintf(s.Err, "Starting a debug shell with the environment of its %s executable\n", f.Phase)
+	fmt.Fprintf(s.Err, "  %-13s %s\n", "executable:", f.Cmd.Path)
+	fmt.Fprintf(s.Err, "  %-13s %s\n", "working dir:", f.Cmd.Dir)
+	for i, arg := range f.Cmd.Args[1:] {
+		name := fmt.Sprintf("arg %d", i+1)
+		if i < len(f.ArgNames) {
+			name = f.ArgNames[i]
+		}
+		fmt.Fprintf(s.Err, "  %-13s %s\n", name+":", arg)
+	}
+	fmt.Fprintf(s.Err, "Run $%s to run the executable again, exit the shell to continue\n", EnvDebugCommand)
+
+	shell := exec.Command(s.Path)
+	shell.Dir = f.Cmd.Dir
+	shell.Env = append(append([]string{}, f.Cmd.Env...), EnvDebugCommand+"="+strings.Join(f.Cmd.Args, " "))
+	shell.Stdin = s.In
+	shell.Stdout = s.Out
+	shell.Stderr = s.Err
+	if err := shell.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			logger.Debugf("Debug shell exited: %s", err)
+			return
+		}
+		logger.Warnf("Unable to start debug shell '%s': %s", s.Path, err)
+	}
+}
@@ -0,0 +1,99 @@
+// +build linux darwin
+
+package buildpack_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/buildpack"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestDebugShell(t *testing.T) {
+	spec.Run(t, "DebugShell", testDebugShell, spec.Report(report.Terminal{}))
+}
+
+func testDebugShell(t *testing.T, when spec.G, it spec.S) {
+	var (
+		shell      *buildpack.DebugShell
+		stdout     *bytes.Buffer
+		stderr     *bytes.Buffer
+		tmpDir     string
+		logHandler *memory.Handler
+		logger     *log.Logger
+		failure    buildpack.Failure
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.debug-shell")
+		h.AssertNil(t, err)
+		tmpDir, err = filepath.EvalSymlinks(tmpDir)
+		h.AssertNil(t, err)
+
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+		logHandler = memory.New()
+		logger = &log.Logger{Handler: logHandler}
+		shell = &buildpack.DebugShell{
+			Path: "/bin/sh",
+			In:   strings.NewReader(`echo "$SOME_VAR"; echo "$CNB_DEBUG_COMMAND"; pwd` + "\n"),
+			Out:  stdout,
+			Err:  stderr,
+		}
+
+		cmd := exec.Command("/cnb/buildpacks/A/v1/bin/build", "/layers/A", "/platform", "/tmp/plan.toml")
+		cmd.Dir = tmpDir
+		cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "SOME_VAR=some-value"}
+		failure = buildpack.Failure{
+			Buildpack: buildpack.GroupBuildpack{ID: "A", Version: "v1"},
+			Phase:     "build",
+			Cmd:       cmd,
+			ArgNames:  []string{"layers dir", "platform dir", "plan path"},
+			Output:    []byte("some-output"),
+			Err:       errors.New("exit status 1"),
+		}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("runs a shell with the environment and working directory of the failed executable", func() {
+		shell.Run(failure, logger)
+
+		h.AssertEq(t, stdout.String(), "some-value\n"+
+			"/cnb/buildpacks/A/v1/bin/build /layers/A /platform /tmp/plan.toml\n"+
+			tmpDir+"\n",
+		)
+	})
+
+	it("describes the failure", func() {
+		shell.Run(failure, logger)
+
+		h.AssertStringContains(t, stderr.String(), "some-output")
+		h.AssertStringContains(t, stderr.String(), "Buildpack 'A@v1' failed to build: exit status 1")
+		h.AssertStringContains(t, stderr.String(), "working dir:  "+tmpDir)
+		h.AssertStringContains(t, stderr.String(), "layers dir:   /layers/A")
+		h.AssertStringContains(t, stderr.String(), "plan path:    /tmp/plan.toml")
+	})
+
+	it("warns when the shell cannot be started", func() {
+		shell.Path = filepath.Join(tmpDir, "missing-shell")
+		shell.Run(failure, logger)
+
+		h.AssertEq(t, len(logHandler.Entries), 1)
+		h.AssertStringContains(t, logHandler.Entries[0].Message, "Unable to start debug shell")
+	})
+}
@@ -16,6 +16,9 @@ import (
 
 const EnvBuildpackDir = "CNB_BUILDPACK_DIR"
 
+// codeDetectFail is the exit code of a detect executable that did not pass, as opposed to one that errored
+const codeDetectFail = 100
+
 type Logger interface {
 	Debug(msg string)
 	Debugf(fmt string, v ...interface{})
@@ -36,6 +39,9 @@ type DetectConfig struct {
 	AppDir      string
 	PlatformDir string
 	Logger      Logger
+
+	// DebugShell, when set, is run when a detect executable errors
+	DebugShell *DebugShell
 }
 
 func (b *Descriptor) Detect(config *DetectConfig) DetectRun {
@@ -74,12 +80,23 @@ func (b *Descriptor) Detect(config *DetectConfig) DetectRun {
 	cmd.Env = append(cmd.Env, EnvBuildpackDir+"="+b.Dir)
 
 	if err := cmd.Run(); err != nil {
+		run := DetectRun{Code: -1, Err: err, Output: out.Bytes()}
 		if err, ok := err.(*exec.ExitError); ok {
 			if status, ok := err.Sys().(syscall.WaitStatus); ok {
-				return DetectRun{Code: status.ExitStatus(), Output: out.Bytes()}
+				run = DetectRun{Code: status.ExitStatus(), Output: out.Bytes()}
 			}
 		}
-		return DetectRun{Code: -1, Err: err, Output: out.Bytes()}
+		if config.DebugShell != nil && run.Code != codeDetectFail {
+			config.DebugShell.Run(Failure{
+				Buildpack: GroupBuildpack{ID: b.Buildpack.ID, Version: b.Buildpack.Version},
+				Phase:     "detect",
+				Cmd:       cmd,
+				ArgNames:  []string{"platform dir", "plan path"},
+				Output:    run.Output,
+				Err:       err,
+			}, config.Logger)
+		}
+		return run
 	}
 	var t DetectRun
 	if _, err := toml.DecodeFile(planPath, &t); err != nil {
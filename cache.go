@@ -1,21 +1,44 @@
 package lifecycle
 
 import (
+	"sort"
+
 	"github.com/pkg/errors"
 
+	"github.com/buildpacks/lifecycle/layers"
 	"github.com/buildpacks/lifecycle/platform"
 )
 
+// ErrCorruptCacheMetadata is wrapped by the error a Cache returns when its metadata cannot be decoded
+var ErrCorruptCacheMetadata = errors.New("cache metadata is corrupt")
+
+// ErrLayerNotFound is wrapped by the error a Cache returns when a layer it is asked to retrieve does not exist
+var ErrLayerNotFound = errors.New("layer is missing from cache")
+
 func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 	var err error
 	if !cacheStore.Exists() {
 		e.Logger.Info("Layer cache not found")
 	}
-	origMeta, err := cacheStore.RetrieveMetadata()
+	origMeta, err := retrieveCacheMetadata(cacheStore, e.Logger)
 	if err != nil {
 		return errors.Wrap(err, "metadata for previous cache")
 	}
+	// layers quarantined by the restorer are not reused, so that the corrupt blobs are replaced
+	quarantined, err := readQuarantinedLayers(layersDir)
+	if err != nil {
+		e.Logger.Warnf("Failed to read quarantined layers: %s", err)
+	}
+	for _, sha := range quarantined {
+		if err := cacheStore.QuarantineLayer(sha); err != nil {
+			return errors.Wrap(err, "quarantining layer")
+		}
+	}
+
 	meta := platform.CacheMetadata{}
+	if len(e.appIndex) > 0 {
+		meta.AppIndex = e.cacheAppIndex(cacheStore, origMeta.AppIndex)
+	}
 
 	for _, bp := range e.Buildpacks {
 		bpDir, err := readBuildpackLayersDir(layersDir, bp, e.Logger)
@@ -40,10 +63,17 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 				continue
 			}
 			origLayerMetadata := origMeta.MetadataForBuildpack(bp.ID).Layers[layer.name()]
-			if lmd.SHA, err = e.addOrReuseCacheLayer(cacheStore, &layer, origLayerMetadata.SHA); err != nil {
+			cacheLayer, reused, err := e.addOrReuseCacheLayer(cacheStore, &layer, origLayerMetadata.SHA)
+			if err != nil {
 				e.Logger.Warnf("Failed to cache layer '%s': %s", layer.Identifier(), err)
 				continue
 			}
+			lmd.SHA = cacheLayer.Digest
+			if reused {
+				e.metrics.add(bp.ID, lmd.LayerMetadataFile, platform.CacheMetrics{CacheReused: 1, CacheReusedBytes: fileSize(cacheLayer.TarPath)})
+			} else {
+				e.metrics.add(bp.ID, lmd.LayerMetadataFile, platform.CacheMetrics{CacheAdded: 1, CacheAddedBytes: fileSize(cacheLayer.TarPath)})
+			}
 			bpMD.Layers[layer.name()] = lmd
 		}
 		meta.Buildpacks = append(meta.Buildpacks, bpMD)
@@ -59,17 +89,121 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 	return nil
 }
 
-func (e *Exporter) addOrReuseCacheLayer(cache Cache, layerDir layerDir, previousSHA string) (string, error) {
+// addOrReuseCacheLayer returns the layer created from layerDir and whether it was reused from the previous cache
+func (e *Exporter) addOrReuseCacheLayer(cache Cache, layerDir layerDir, previousSHA string) (layers.Layer, bool, error) {
 	layer, err := e.LayerFactory.DirLayer(layerDir.Identifier(), layerDir.Path())
 	if err != nil {
-		return "", errors.Wrapf(err, "creating layer '%s'", layerDir.Identifier())
+		return layers.Layer{}, false, errors.Wrapf(err, "creating layer '%s'", layerDir.Identifier())
 	}
 	if layer.Digest == previousSHA {
 		e.Logger.Infof("Reusing cache layer '%s'\n", layer.ID)
 		e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
-		return layer.Digest, cache.ReuseLayer(previousSHA)
+		err := cache.ReuseLayer(previousSHA)
+		if err == nil {
+			return layer, true, nil
+		}
+		e.Logger.Warnf("Failed to reuse cache layer '%s': %s", layer.ID, err)
 	}
 	e.Logger.Infof("Adding cache layer '%s'\n", layer.ID)
 	e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
-	return layer.Digest, cache.AddLayerFile(layer.TarPath, layer.Digest)
+	return layer, false, cache.AddLayerFile(layer.TarPath, layer.Digest)
+}
+
+// cacheAppIndex adds the index of the exported app layers to the cache and returns its digest,
+// or an empty digest when it could not be cached
+func (e *Exporter) cacheAppIndex(cacheStore Cache, previousSHA string) string {
+	layer, err := e.LayerFactory.AppIndexLayer(e.appIndex)
+	if err != nil {
+		e.Logger.Warnf("Failed to cache app layer index: %s", err)
+		return ""
+	}
+	if layer.Digest == previousSHA {
+		if err := cacheStore.ReuseLayer(previousSHA); err == nil {
+			e.Logger.Debugf("Reusing app layer index with SHA: %s\n", layer.Digest)
+			return layer.Digest
+		}
+	}
+	if err := cacheStore.AddLayerFile(layer.TarPath, layer.Digest); err != nil {
+		e.Logger.Warnf("Failed to cache app layer index: %s", err)
+		return ""
+	}
+	e.Logger.Debugf("Adding app layer index with SHA: %s\n", layer.Digest)
+	return layer.Digest
+}
+
+// RetrieveAppIndex returns the index of the app layers of the last export from the cache,
+// or no index when the cache does not contain one
+func RetrieveAppIndex(cacheStore Cache, meta platform.CacheMetadata, logger Logger) []layers.SliceIndex {
+	if meta.AppIndex == "" {
+		return nil
+	}
+	rc, err := cacheStore.RetrieveLayer(meta.AppIndex)
+	if err != nil {
+		logger.Warnf("Failed to retrieve app layer index from cache: %s", err)
+		return nil
+	}
+	defer rc.Close()
+	r, err := layers.Decompress(rc)
+	if err != nil {
+		logger.Warnf("Failed to read app layer index from cache: %s", err)
+		return nil
+	}
+	defer r.Close()
+	index, err := layers.ReadAppIndex(r)
+	if err != nil {
+		logger.Warnf("Failed to read app layer index from cache: %s", err)
+		return nil
+	}
+	return index
+}
+
+// retrieveCacheMetadata returns the metadata of the cache, or empty metadata when it is corrupt
+func retrieveCacheMetadata(cacheStore Cache, logger Logger) (platform.CacheMetadata, error) {
+	meta, err := cacheStore.RetrieveMetadata()
+	if errors.Is(err, ErrCorruptCacheMetadata) {
+		logger.Warnf("Ignoring cache metadata: %s", err)
+		return platform.CacheMetadata{}, nil
+	}
+	return meta, err
+}
+
+// VerifyCache checks that each layer in the cache metadata can be retrieved and matches its digest.
+// It returns the digests of the layers that failed verification.
+func VerifyCache(cacheStore Cache, logger Logger) ([]string, error) {
+	meta, err := cacheStore.RetrieveMetadata()
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieving cache metadata")
+	}
+	var failed []string
+	for _, bp := range meta.Buildpacks {
+		var names []string
+		for name := range bp.Layers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sha := bp.Layers[name].SHA
+			identifier := bp.ID + ":" + name
+			rc, err := cacheStore.RetrieveLayer(sha)
+			if err != nil {
+				logger.Errorf("Layer '%s' could not be retrieved: %s", identifier, err)
+				failed = append(failed, sha)
+				continue
+			}
+			err = layers.VerifyDigest(rc, sha)
+			rc.Close()
+			var mismatch *layers.DigestMismatchError
+			if errors.As(err, &mismatch) {
+				logger.Errorf("Layer '%s' is corrupt: %s", identifier, err)
+				failed = append(failed, sha)
+				continue
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "verifying layer '%s'", identifier)
+			}
+			logger.Infof("Verified layer '%s'", identifier)
+			logger.Debugf("Layer '%s' SHA: %s", identifier, sha)
+		}
+	}
+	return failed, nil
 }
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+// ErrBlobNotFound is wrapped by the error a BlobStore returns when an object does not exist
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores objects by key, it is implemented for each object storage protocol supported by BlobCache
+type BlobStore interface {
+	Exists(key string) (bool, error)
+	Get(key string) (io.ReadCloser, error)
+	Put(key string, r io.Reader, size int64) error
+}
+
+const (
+	blobMetadataKey = "metadata.json"
+	blobLayersKey   = "blobs"
+)
+
+// BlobCache is a cache in an object store. Layers are stored as objects keyed by their diffID,
+// so layers that are added more than once or reused are only uploaded once.
+// The metadata object is written by Commit, layers that are no longer referenced by it are left
+// for the retention policies of the object store to remove.
+// Reused layers are not uploaded again, so a rule expiring objects by age also removes layers that are still
+// referenced; they are restored as cache misses and uploaded again by the next export.
+type BlobCache struct {
+	committed bool
+	name      string
+	store     BlobStore
+	retry     lifecycle.Retry
+
+	exists   bool
+	metadata *platform.CacheMetadata // metadata is written on commit
+
+	mu          sync.Mutex
+	quarantined map[string]bool
+}
+
+// NewBlobCache returns a cache backed by store, name identifies the cache in logs.
+// Requests to the store are retried according to retry.
+func NewBlobCache(name string, store BlobStore, retry lifecycle.Retry) (*BlobCache, error) {
+	c := &BlobCache{name: name, store: store, retry: retry}
+	if err := c.retry.Do("reading cache metadata", func() error {
+		var err error
+		c.exists, err = store.Exists(blobMetadataKey)
+		return err
+	}); err != nil {
+		return nil, errors.Wrapf(err, "accessing cache '%s'", name)
+	}
+	return c, nil
+}
+
+// NewBlobCacheFromURL returns a cache backed by the object store at rawURL, the URL scheme selects the protocol.
+// Supported URLs are:
+// s3://<bucket>/<prefix>[?endpoint=<endpoint URL>&region=<region>] for S3 compatible object stores
+func NewBlobCacheFromURL(rawURL string, retry lifecycle.Retry) (*BlobCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing cache URL '%s'", rawURL)
+	}
+	var store BlobStore
+	switch u.Scheme {
+	case "s3":
+		store, err = NewS3Store(u, S3CredentialsFromEnv())
+	default:
+		err = fmt.Errorf("unsupported scheme '%s', supported schemes are: s3", u.Scheme)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating store for cache URL '%s'", rawURL)
+	}
+	return NewBlobCache(rawURL, store, retry)
+}
+
+func (c *BlobCache) Exists() bool {
+	return c.exists
+}
+
+func (c *BlobCache) Name() string {
+	return c.name
+}
+
+func (c *BlobCache) SetMetadata(metadata platform.CacheMetadata) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	c.metadata = &metadata
+	return nil
+}
+
+func (c *BlobCache) RetrieveMetadata() (platform.CacheMetadata, error) {
+	if !c.exists {
+		return platform.CacheMetadata{}, nil
+	}
+	var data []byte
+	if err := c.retry.Do("reading cache metadata", func() error {
+		rc, err := c.store.Get(blobMetadataKey)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		data, err = ioutil.ReadAll(rc)
+		return err
+	}); err != nil {
+		if errors.Is(err, ErrBlobNotFound) {
+			return platform.CacheMetadata{}, nil
+		}
+		return platform.CacheMetadata{}, errors.Wrapf(err, "reading metadata of cache '%s'", c.name)
+	}
+	var meta platform.CacheMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return platform.CacheMetadata{}, errors.Wrapf(lifecycle.ErrCorruptCacheMetadata, "decoding metadata of cache '%s': %s", c.name, err)
+	}
+	return meta, nil
+}
+
+func (c *BlobCache) AddLayerFile(tarPath string, diffID string) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	key, err := layerKey(diffID)
+	if err != nil {
+		return err
+	}
+	if !c.isQuarantined(diffID) {
+		var exists bool
+		if err := c.retry.Do("caching layer", func() error {
+			exists, err = c.store.Exists(key)
+			return err
+		}); err == nil && exists {
+			// don't waste time uploading an identical layer
+			return nil
+		}
+	}
+	return c.retry.Do("caching layer", func() error {
+		f, err := os.Open(tarPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return c.store.Put(key, f, fi.Size())
+	})
+}
+
+func (c *BlobCache) ReuseLayer(diffID string) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	if c.isQuarantined(diffID) {
+		return errors.Errorf("layer with SHA '%s' is quarantined", diffID)
+	}
+	key, err := layerKey(diffID)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	if err := c.retry.Do("reusing layer", func() error {
+		exists, err = c.store.Exists(key)
+		return err
+	}); err != nil {
+		return errors.Wrapf(err, "reusing layer (%s)", diffID)
+	}
+	if !exists {
+		return errors.Wrapf(ErrBlobNotFound, "reusing layer (%s)", diffID)
+	}
+	return nil
+}
+
+func (c *BlobCache) RetrieveLayer(diffID string) (io.ReadCloser, error) {
+	if c.isQuarantined(diffID) {
+		return nil, errors.Errorf("layer with SHA '%s' is quarantined", diffID)
+	}
+	key, err := layerKey(diffID)
+	if err != nil {
+		return nil, err
+	}
+	var rc io.ReadCloser
+	if err := c.retry.Do("retrieving layer", func() error {
+		rc, err = c.store.Get(key)
+		return err
+	}); err != nil {
+		if errors.Is(err, ErrBlobNotFound) {
+			return nil, errors.Wrapf(lifecycle.ErrLayerNotFound, "retrieving layer (%s): %s", diffID, err)
+		}
+		return nil, errors.Wrapf(err, "retrieving layer (%s)", diffID)
+	}
+	return rc, nil
+}
+
+// QuarantineLayer prevents a corrupt layer from being retrieved or reused by this cache.
+// The layer is not removed from the object store, it is left out of the new cache metadata
+// and replaced when it is added again.
+func (c *BlobCache) QuarantineLayer(diffID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.quarantined == nil {
+		c.quarantined = map[string]bool{}
+	}
+	c.quarantined[diffID] = true
+	return nil
+}
+
+func (c *BlobCache) isQuarantined(diffID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quarantined[diffID]
+}
+
+func (c *BlobCache) Commit() error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	if c.metadata != nil {
+		data, err := json.Marshal(c.metadata)
+		if err != nil {
+			return errors.Wrap(err, "serializing metadata")
+		}
+		if err := c.retry.Do("saving cache metadata", func() error {
+			return c.store.Put(blobMetadataKey, bytes.NewReader(data), int64(len(data)))
+		}); err != nil {
+			return errors.Wrapf(err, "saving metadata of cache '%s'", c.name)
+		}
+		c.exists = true
+	}
+	c.committed = true
+	return nil
+}
+
+// layerKey is the key of the object holding the layer with diffID, e.g. blobs/sha256/<hex>
+func layerKey(diffID string) (string, error) {
+	parts := strings.SplitN(diffID, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(diffID, "/\\") {
+		return "", errors.Errorf("invalid layer diffID '%s'", diffID)
+	}
+	return path.Join(blobLayersKey, parts[0], parts[1]), nil
+}
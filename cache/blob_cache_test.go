@@ -0,0 +1,332 @@
+package cache_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/cache"
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestBlobCache(t *testing.T) {
+	spec.Run(t, "BlobCache", testBlobCache, spec.Report(report.Terminal{}))
+}
+
+func testBlobCache(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir           string
+		store            *h.ObjectStore
+		cacheURL         string
+		subject          *cache.BlobCache
+		testLayerTarPath string
+		testLayerSHA     string
+		testLayerKey     string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.blob-cache")
+		h.AssertNil(t, err)
+
+		h.AssertNil(t, os.Setenv("AWS_ACCESS_KEY_ID", "some-access-key"))
+		h.AssertNil(t, os.Setenv("AWS_SECRET_ACCESS_KEY", "some-secret-key"))
+		store = h.NewObjectStore("some-access-key", "some-secret-key")
+		cacheURL = store.URL("some-bucket", "some/prefix")
+
+		subject, err = cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{})
+		h.AssertNil(t, err)
+
+		testLayerTarPath = filepath.Join(tmpDir, "some-layer.tar")
+		h.AssertNil(t, ioutil.WriteFile(testLayerTarPath, []byte("dummy data"), 0666))
+		testLayerSHA = "sha256:" + h.ComputeSHA256ForFile(t, testLayerTarPath)
+		testLayerKey = "some-bucket/some/prefix/blobs/sha256/" + strings.TrimPrefix(testLayerSHA, "sha256:")
+	})
+
+	it.After(func() {
+		store.Close()
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	assertLayer := func(contents string) {
+		t.Helper()
+		rc, err := subject.RetrieveLayer(testLayerSHA)
+		h.AssertNil(t, err)
+		defer rc.Close()
+		data, err := ioutil.ReadAll(rc)
+		h.AssertNil(t, err)
+		h.AssertEq(t, string(data), contents)
+	}
+
+	when("#NewBlobCacheFromURL", func() {
+		it("does not exist until it is committed", func() {
+			h.AssertEq(t, subject.Exists(), false)
+			h.AssertEq(t, subject.Name(), cacheURL)
+		})
+
+		it("fails for unsupported schemes", func() {
+			_, err := cache.NewBlobCacheFromURL("ftp://some-host/some/prefix", lifecycle.Retry{})
+			h.AssertError(t, err, "unsupported scheme 'ftp'")
+		})
+
+		it("does not exist when the store denies reading the metadata", func() {
+			// S3 denies reading a missing object when the credentials may not list the bucket
+			store.FailNext(http.MethodHead, "metadata.json", 1, http.StatusForbidden)
+
+			subject, err := cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{})
+			h.AssertNil(t, err)
+			h.AssertEq(t, subject.Exists(), false)
+		})
+
+		it("fails to commit when the store rejects the access key", func() {
+			h.AssertNil(t, os.Setenv("AWS_ACCESS_KEY_ID", "other-access-key"))
+
+			subject, err := cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{})
+			h.AssertNil(t, err)
+			h.AssertNil(t, subject.SetMetadata(platform.CacheMetadata{}))
+			h.AssertError(t, subject.Commit(), "InvalidAccessKeyId")
+		})
+
+		it("fails to commit when the signature does not match", func() {
+			h.AssertNil(t, os.Setenv("AWS_SECRET_ACCESS_KEY", "other-secret-key"))
+
+			subject, err := cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{})
+			h.AssertNil(t, err)
+			h.AssertNil(t, subject.SetMetadata(platform.CacheMetadata{}))
+			h.AssertError(t, subject.Commit(), "SignatureDoesNotMatch")
+		})
+
+		it("retries transient failures", func() {
+			store.FailNext(http.MethodHead, "metadata.json", 2, http.StatusServiceUnavailable)
+
+			_, err := cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{Retries: 2, Backoff: time.Millisecond})
+			h.AssertNil(t, err)
+			h.AssertEq(t, store.Requests(http.MethodHead, "metadata.json"), 4)
+		})
+	})
+
+	when("#RetrieveMetadata", func() {
+		when("the store contains valid metadata", func() {
+			it.Before(func() {
+				store.SetObject("some-bucket/some/prefix/metadata.json", []byte(`{"buildpacks": [{"key": "bp.id", "version": "1.2.3", "layers": {"some-layer": {"sha": "some-sha", "cache": true}}}]}`))
+				var err error
+				subject, err = cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{})
+				h.AssertNil(t, err)
+			})
+
+			it("returns the metadata", func() {
+				h.AssertEq(t, subject.Exists(), true)
+				meta, err := subject.RetrieveMetadata()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(meta.Buildpacks), 1)
+				h.AssertEq(t, meta.Buildpacks[0].ID, "bp.id")
+				h.AssertEq(t, meta.Buildpacks[0].Layers["some-layer"].SHA, "some-sha")
+			})
+		})
+
+		when("the store contains invalid metadata", func() {
+			it.Before(func() {
+				store.SetObject("some-bucket/some/prefix/metadata.json", []byte("garbage"))
+				var err error
+				subject, err = cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{})
+				h.AssertNil(t, err)
+			})
+
+			it("returns a corrupt metadata error", func() {
+				_, err := subject.RetrieveMetadata()
+				if !errors.Is(err, lifecycle.ErrCorruptCacheMetadata) {
+					t.Fatalf("expected corrupt cache metadata error, got: %v", err)
+				}
+			})
+		})
+
+		when("the store does not contain metadata", func() {
+			it("returns empty metadata", func() {
+				meta, err := subject.RetrieveMetadata()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(meta.Buildpacks), 0)
+			})
+		})
+	})
+
+	when("#RetrieveLayer", func() {
+		when("layer does not exist", func() {
+			it("returns an error", func() {
+				_, err := subject.RetrieveLayer(testLayerSHA)
+				if !errors.Is(err, lifecycle.ErrLayerNotFound) {
+					t.Fatalf("expected layer not found error, got: %v", err)
+				}
+			})
+		})
+
+		when("layer is quarantined", func() {
+			it.Before(func() {
+				store.SetObject(testLayerKey, []byte("dummy data"))
+				h.AssertNil(t, subject.QuarantineLayer(testLayerSHA))
+			})
+
+			it("returns an error", func() {
+				_, err := subject.RetrieveLayer(testLayerSHA)
+				h.AssertError(t, err, "is quarantined")
+			})
+
+			it("cannot be reused", func() {
+				h.AssertError(t, subject.ReuseLayer(testLayerSHA), "is quarantined")
+			})
+		})
+	})
+
+	when("#Commit", func() {
+		var newMetadata platform.CacheMetadata
+
+		it.Before(func() {
+			newMetadata = platform.CacheMetadata{
+				Buildpacks: []platform.BuildpackLayersMetadata{{
+					ID:     "new.bp.id",
+					Layers: map[string]platform.BuildpackLayerMetadata{"some-layer": {LayerMetadata: platform.LayerMetadata{SHA: testLayerSHA}}},
+				}},
+			}
+		})
+
+		it("writes the metadata and layers to the store", func() {
+			h.AssertNil(t, subject.AddLayerFile(testLayerTarPath, testLayerSHA))
+			h.AssertNil(t, subject.SetMetadata(newMetadata))
+			h.AssertNil(t, subject.Commit())
+
+			h.AssertEq(t, subject.Exists(), true)
+			meta, err := subject.RetrieveMetadata()
+			h.AssertNil(t, err)
+			h.AssertEq(t, meta, newMetadata)
+			assertLayer("dummy data")
+
+			data, ok := store.Object(testLayerKey)
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, string(data), "dummy data")
+		})
+
+		it("does not write metadata until commit", func() {
+			h.AssertNil(t, subject.SetMetadata(newMetadata))
+
+			_, ok := store.Object("some-bucket/some/prefix/metadata.json")
+			h.AssertEq(t, ok, false)
+		})
+
+		it("does not upload layers that are already in the store", func() {
+			store.SetObject(testLayerKey, []byte("dummy data"))
+
+			h.AssertNil(t, subject.AddLayerFile(testLayerTarPath, testLayerSHA))
+			h.AssertEq(t, store.Requests(http.MethodPut, "blobs/sha256"), 0)
+		})
+
+		it("retries checking whether layers are already in the store", func() {
+			subject, err := cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{Retries: 2, Backoff: time.Millisecond})
+			h.AssertNil(t, err)
+			store.SetObject(testLayerKey, []byte("dummy data"))
+			store.FailNext(http.MethodHead, "blobs/sha256", 2, http.StatusServiceUnavailable)
+
+			h.AssertNil(t, subject.AddLayerFile(testLayerTarPath, testLayerSHA))
+			h.AssertEq(t, store.Requests(http.MethodPut, "blobs/sha256"), 0)
+		})
+
+		it("replaces quarantined layers that are already in the store", func() {
+			store.SetObject(testLayerKey, []byte("corrupt data"))
+			h.AssertNil(t, subject.QuarantineLayer(testLayerSHA))
+
+			h.AssertNil(t, subject.AddLayerFile(testLayerTarPath, testLayerSHA))
+			data, ok := store.Object(testLayerKey)
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, string(data), "dummy data")
+		})
+
+		when("layers are larger than the part size of the store", func() {
+			it.Before(func() {
+				u, err := url.Parse(cacheURL)
+				h.AssertNil(t, err)
+				s3Store, err := cache.NewS3Store(u, cache.S3CredentialsFromEnv())
+				h.AssertNil(t, err)
+				s3Store.PartSize = 4
+				subject, err = cache.NewBlobCache(cacheURL, s3Store, lifecycle.Retry{})
+				h.AssertNil(t, err)
+				store.SetMaxBodySize(4)
+			})
+
+			it("uploads them in parts", func() {
+				h.AssertNil(t, subject.AddLayerFile(testLayerTarPath, testLayerSHA))
+				h.AssertNil(t, subject.SetMetadata(newMetadata))
+				h.AssertNil(t, subject.Commit())
+
+				assertLayer("dummy data")
+				h.AssertEq(t, store.Requests(http.MethodPut, "blobs/sha256"), 3)
+				meta, err := subject.RetrieveMetadata()
+				h.AssertNil(t, err)
+				h.AssertEq(t, meta, newMetadata)
+			})
+
+			it("aborts the upload when a part fails", func() {
+				store.FailNext(http.MethodPut, "blobs/sha256", 1, http.StatusInternalServerError)
+
+				h.AssertError(t, subject.AddLayerFile(testLayerTarPath, testLayerSHA), "uploading part 1")
+				h.AssertEq(t, store.Requests(http.MethodDelete, "uploadId="), 1)
+				_, ok := store.Object(testLayerKey)
+				h.AssertEq(t, ok, false)
+			})
+		})
+
+		it("reuses layers that are in the store", func() {
+			store.SetObject(testLayerKey, []byte("dummy data"))
+
+			h.AssertNil(t, subject.ReuseLayer(testLayerSHA))
+			h.AssertNil(t, subject.Commit())
+			assertLayer("dummy data")
+		})
+
+		it("fails to reuse layers that are not in the store", func() {
+			err := subject.ReuseLayer(testLayerSHA)
+			if !errors.Is(err, cache.ErrBlobNotFound) {
+				t.Fatalf("expected blob not found error, got: %v", err)
+			}
+		})
+
+		it("retries transient failures", func() {
+			subject, err := cache.NewBlobCacheFromURL(cacheURL, lifecycle.Retry{Retries: 2, Backoff: time.Millisecond})
+			h.AssertNil(t, err)
+			store.FailNext(http.MethodPut, "blobs/sha256", 2, http.StatusServiceUnavailable)
+			store.FailNext(http.MethodPut, "metadata.json", 2, http.StatusInternalServerError)
+
+			h.AssertNil(t, subject.AddLayerFile(testLayerTarPath, testLayerSHA))
+			h.AssertNil(t, subject.SetMetadata(newMetadata))
+			h.AssertNil(t, subject.Commit())
+
+			_, ok := store.Object(testLayerKey)
+			h.AssertEq(t, ok, true)
+			_, ok = store.Object("some-bucket/some/prefix/metadata.json")
+			h.AssertEq(t, ok, true)
+		})
+
+		when("modified after commit", func() {
+			it.Before(func() {
+				h.AssertNil(t, subject.Commit())
+			})
+
+			it("fails", func() {
+				h.AssertError(t, subject.SetMetadata(newMetadata), "cache cannot be modified after commit")
+				h.AssertError(t, subject.AddLayerFile(testLayerTarPath, testLayerSHA), "cache cannot be modified after commit")
+				h.AssertError(t, subject.ReuseLayer(testLayerSHA), "cache cannot be modified after commit")
+				h.AssertError(t, subject.Commit(), "cache cannot be modified after commit")
+			})
+		})
+	})
+}
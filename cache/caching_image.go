@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/buildpacks/imgutil"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/pkg/errors"
 )
 
@@ -23,6 +24,17 @@ func NewCachingImage(image imgutil.Image, cache *VolumeCache) imgutil.Image {
 	}
 }
 
+// SetHealthcheck sets the health check of the wrapped image
+func (c *cachingImage) SetHealthcheck(config *v1.HealthConfig) error {
+	hcImage, ok := c.Image.(interface {
+		SetHealthcheck(config *v1.HealthConfig) error
+	})
+	if !ok {
+		return errors.Errorf("image type %T does not support health checks", c.Image)
+	}
+	return hcImage.SetHealthcheck(config)
+}
+
 func (c *cachingImage) AddLayer(path string) error {
 	f, err := os.Open(path)
 	if err != nil {
@@ -5,3 +5,5 @@ import (
 )
 
 var errCacheCommitted = errors.New("cache cannot be modified after commit")
+
+var errCacheReadOnly = errors.New("cache is read-only")
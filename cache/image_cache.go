@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"runtime"
+	"sync"
 
 	"github.com/buildpacks/imgutil"
 	"github.com/buildpacks/imgutil/remote"
 	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle"
@@ -21,6 +26,13 @@ type ImageCache struct {
 	committed bool
 	origImage imgutil.Image
 	newImage  imgutil.Image
+	retry     lifecycle.Retry
+
+	// origLayers provides the compressed layer blobs of the original image, imgutil only provides uncompressed layers
+	origLayers v1.Image
+
+	mu          sync.Mutex
+	quarantined map[string]bool
 }
 
 func NewImageCache(origImage imgutil.Image, newImage imgutil.Image) *ImageCache {
@@ -30,27 +42,60 @@ func NewImageCache(origImage imgutil.Image, newImage imgutil.Image) *ImageCache
 	}
 }
 
-func NewImageCacheFromName(name string, keychain authn.Keychain) (*ImageCache, error) {
-	origImage, err := remote.NewImage(
-		name,
-		keychain,
-		remote.FromBaseImage(name),
-		remote.WithDefaultPlatform(imgutil.Platform{OS: runtime.GOOS}),
+// NewImageCacheFromName returns a cache backed by the image with the given name.
+// Reading the existing cache image and committing the new cache image are retried according to retry.
+func NewImageCacheFromName(name string, keychain authn.Keychain, retry lifecycle.Retry) (*ImageCache, error) {
+	var (
+		origImage  imgutil.Image
+		origLayers v1.Image
 	)
-	if err != nil {
+	if err := retry.Do("reading cache image", func() error {
+		var err error
+		origImage, err = remote.NewImage(
+			name,
+			keychain,
+			remote.FromBaseImage(name),
+			remote.WithDefaultPlatform(imgutil.Platform{OS: runtime.GOOS}),
+		)
+		if err != nil || !origImage.Found() {
+			return err
+		}
+		origLayers, err = compressedLayers(origImage, keychain)
+		return err
+	}); err != nil {
 		return nil, fmt.Errorf("accessing cache image %q: %v", name, err)
 	}
-	emptyImage, err := remote.NewImage(
-		name,
-		keychain,
-		remote.WithPreviousImage(name),
-		remote.WithDefaultPlatform(imgutil.Platform{OS: runtime.GOOS}),
-	)
-	if err != nil {
+	var emptyImage imgutil.Image
+	if err := retry.Do("reading cache image", func() error {
+		var err error
+		emptyImage, err = remote.NewImage(
+			name,
+			keychain,
+			remote.WithPreviousImage(name),
+			remote.WithDefaultPlatform(imgutil.Platform{OS: runtime.GOOS}),
+		)
+		return err
+	}); err != nil {
 		return nil, fmt.Errorf("creating new cache image %q: %v", name, err)
 	}
 
-	return NewImageCache(origImage, emptyImage), nil
+	cache := NewImageCache(origImage, emptyImage)
+	cache.retry = retry
+	cache.origLayers = origLayers
+	return cache, nil
+}
+
+// compressedLayers reads the image that was found by digest so that its layer blobs can be streamed as stored
+func compressedLayers(image imgutil.Image, keychain authn.Keychain) (v1.Image, error) {
+	id, err := image.Identifier()
+	if err != nil {
+		return nil, err
+	}
+	digestID, ok := id.(remote.DigestIdentifier)
+	if !ok {
+		return nil, errors.Errorf("unexpected identifier '%s'", id)
+	}
+	return ggcrremote.Image(digestID.Digest, ggcrremote.WithAuthFromKeychain(keychain))
 }
 
 func (c *ImageCache) Exists() bool {
@@ -75,7 +120,7 @@ func (c *ImageCache) SetMetadata(metadata platform.CacheMetadata) error {
 func (c *ImageCache) RetrieveMetadata() (platform.CacheMetadata, error) {
 	var meta platform.CacheMetadata
 	if err := lifecycle.DecodeLabel(c.origImage, MetadataLabel, &meta); err != nil {
-		return platform.CacheMetadata{}, nil
+		return platform.CacheMetadata{}, errors.Wrapf(lifecycle.ErrCorruptCacheMetadata, "%s", err)
 	}
 	return meta, nil
 }
@@ -91,11 +136,77 @@ func (c *ImageCache) ReuseLayer(diffID string) error {
 	if c.committed {
 		return errCacheCommitted
 	}
+	if c.isQuarantined(diffID) {
+		return errors.Errorf("layer with SHA '%s' is quarantined", diffID)
+	}
 	return c.newImage.ReuseLayer(diffID)
 }
 
+// RetrieveLayer returns the layer as it is stored in the cache image, which may be compressed.
+// Callers decompress it with layers.Decompress, and verify it against diffID with layers.ExtractVerified or layers.VerifyDigest.
 func (c *ImageCache) RetrieveLayer(diffID string) (io.ReadCloser, error) {
-	return c.origImage.GetLayer(diffID)
+	if c.isQuarantined(diffID) {
+		return nil, errors.Errorf("layer with SHA '%s' is quarantined", diffID)
+	}
+	if c.origLayers == nil {
+		rc, err := c.origImage.GetLayer(diffID)
+		if err != nil {
+			return nil, errors.Wrapf(lifecycle.ErrLayerNotFound, "layer with SHA '%s' not found: %s", diffID, err)
+		}
+		return rc, nil
+	}
+
+	hash, err := v1.NewHash(diffID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse layer SHA '%s'", diffID)
+	}
+	configFile, err := c.origLayers.ConfigFile()
+	if err != nil {
+		return nil, errors.Wrap(err, "read cache image config")
+	}
+	if !hasDiffID(configFile, hash) {
+		return nil, errors.Wrapf(lifecycle.ErrLayerNotFound, "layer with SHA '%s' not found", diffID)
+	}
+	layer, err := c.origLayers.LayerByDiffID(hash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get layer with SHA '%s'", diffID)
+	}
+	rc, err := layer.Compressed()
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+		return nil, errors.Wrapf(lifecycle.ErrLayerNotFound, "blob of layer with SHA '%s' not found", diffID)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get layer with SHA '%s'", diffID)
+	}
+	return rc, nil
+}
+
+func hasDiffID(configFile *v1.ConfigFile, diffID v1.Hash) bool {
+	for _, d := range configFile.RootFS.DiffIDs {
+		if d == diffID {
+			return true
+		}
+	}
+	return false
+}
+
+// QuarantineLayer prevents a corrupt layer from being retrieved or reused by this cache.
+// The layer is not removed from the original cache image, it is left out of the new cache image.
+func (c *ImageCache) QuarantineLayer(diffID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.quarantined == nil {
+		c.quarantined = map[string]bool{}
+	}
+	c.quarantined[diffID] = true
+	return nil
+}
+
+func (c *ImageCache) isQuarantined(diffID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quarantined[diffID]
 }
 
 func (c *ImageCache) Commit() error {
@@ -106,7 +217,9 @@ func (c *ImageCache) Commit() error {
 	// Check if the cache image exists prior to saving the new cache at that same location
 	origImgExists := c.origImage.Found()
 
-	if err := c.newImage.Save(); err != nil {
+	if err := c.retry.Do("saving cache image", func() error {
+		return c.newImage.Save()
+	}); err != nil {
 		return errors.Wrapf(err, "saving image '%s'", c.newImage.Name())
 	}
 	c.committed = true
@@ -118,6 +231,8 @@ func (c *ImageCache) Commit() error {
 		}
 	}
 	c.origImage = c.newImage
+	// layers of the committed image are read through imgutil
+	c.origLayers = nil
 
 	return nil
 }
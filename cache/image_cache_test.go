@@ -1,21 +1,28 @@
 package cache_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/buildpacks/imgutil/fakes"
 	"github.com/buildpacks/imgutil/local"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/pkg/errors"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
+	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/buildpack/layertypes"
 	"github.com/buildpacks/lifecycle/cache"
+	"github.com/buildpacks/lifecycle/layers"
 	"github.com/buildpacks/lifecycle/platform"
 	h "github.com/buildpacks/lifecycle/testhelpers"
 )
@@ -105,9 +112,11 @@ func testImageCache(t *testing.T, when spec.G, it spec.S) {
 				h.AssertNil(t, fakeOriginalImage.SetLabel("io.buildpacks.lifecycle.cache.metadata", "garbage"))
 			})
 
-			it("returns empty metadata", func() {
+			it("returns a corrupt metadata error", func() {
 				meta, err := subject.RetrieveMetadata()
-				h.AssertNil(t, err)
+				if !errors.Is(err, lifecycle.ErrCorruptCacheMetadata) {
+					t.Fatalf("expected corrupt metadata error, got: %v", err)
+				}
 				h.AssertEq(t, len(meta.Buildpacks), 0)
 			})
 		})
@@ -142,6 +151,23 @@ func testImageCache(t *testing.T, when spec.G, it spec.S) {
 			it("returns an error", func() {
 				_, err := subject.RetrieveLayer("some_nonexistent_sha")
 				h.AssertError(t, err, "failed to get layer with sha 'some_nonexistent_sha'")
+				h.AssertEq(t, errors.Is(err, lifecycle.ErrLayerNotFound), true)
+			})
+		})
+
+		when("layer is quarantined", func() {
+			it.Before(func() {
+				h.AssertNil(t, fakeOriginalImage.AddLayer(testLayerTarPath))
+				h.AssertNil(t, subject.QuarantineLayer(testLayerSHA))
+			})
+
+			it("returns an error", func() {
+				_, err := subject.RetrieveLayer(testLayerSHA)
+				h.AssertError(t, err, "is quarantined")
+			})
+
+			it("cannot be reused", func() {
+				h.AssertError(t, subject.ReuseLayer(testLayerSHA), "is quarantined")
 			})
 		})
 	})
@@ -321,4 +347,86 @@ func testImageCache(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 	})
+	when("#NewImageCacheFromName", func() {
+		var (
+			registry *h.FaultyRegistry
+			retry    lifecycle.Retry
+		)
+
+		it.Before(func() {
+			registry = h.NewFaultyRegistry()
+			retry = lifecycle.Retry{Retries: 2, Backoff: time.Millisecond}
+		})
+
+		it.After(func() {
+			registry.Close()
+		})
+
+		it("retries transient failures reading the cache image and committing the new cache image", func() {
+			cacheName := registry.Host() + "/some/cache"
+			registry.FailNext(http.MethodGet, "/manifests/", 2, http.StatusServiceUnavailable)
+
+			imageCache, err := cache.NewImageCacheFromName(cacheName, authn.DefaultKeychain, retry)
+			h.AssertNil(t, err)
+			h.AssertNil(t, imageCache.AddLayerFile(testLayerTarPath, testLayerSHA))
+
+			registry.FailNext(http.MethodPut, "/manifests/", 2, http.StatusServiceUnavailable)
+			h.AssertNil(t, imageCache.Commit())
+
+			rc, err := imageCache.RetrieveLayer(testLayerSHA)
+			h.AssertNil(t, err)
+			h.AssertNil(t, rc.Close())
+		})
+
+		when("the cache image exists", func() {
+			var (
+				cacheName  string
+				imageCache *cache.ImageCache
+			)
+
+			it.Before(func() {
+				cacheName = registry.Host() + "/some/cache"
+				committed, err := cache.NewImageCacheFromName(cacheName, authn.DefaultKeychain, retry)
+				h.AssertNil(t, err)
+				h.AssertNil(t, committed.AddLayerFile(testLayerTarPath, testLayerSHA))
+				h.AssertNil(t, committed.Commit())
+
+				imageCache, err = cache.NewImageCacheFromName(cacheName, authn.DefaultKeychain, retry)
+				h.AssertNil(t, err)
+			})
+
+			it("retrieves the layer as it is stored in the registry", func() {
+				rc, err := imageCache.RetrieveLayer(testLayerSHA)
+				h.AssertNil(t, err)
+				defer rc.Close()
+
+				blob, err := ioutil.ReadAll(rc)
+				h.AssertNil(t, err)
+				h.AssertEq(t, blob[:2], []byte{0x1f, 0x8b})
+				h.AssertNil(t, layers.VerifyDigest(bytes.NewReader(blob), testLayerSHA))
+			})
+
+			it("returns layer not found when the layer is not in the cache image", func() {
+				_, err := imageCache.RetrieveLayer("sha256:" + strings.Repeat("0", 64))
+				h.AssertEq(t, errors.Is(err, lifecycle.ErrLayerNotFound), true)
+			})
+
+			it("returns layer not found when the registry no longer has the layer blob", func() {
+				// reads the config before the blob requests start failing
+				_, err := imageCache.RetrieveLayer("sha256:" + strings.Repeat("0", 64))
+				h.AssertEq(t, errors.Is(err, lifecycle.ErrLayerNotFound), true)
+				registry.FailNext(http.MethodGet, "/blobs/", 1, http.StatusNotFound)
+
+				_, err = imageCache.RetrieveLayer(testLayerSHA)
+				h.AssertEq(t, errors.Is(err, lifecycle.ErrLayerNotFound), true)
+			})
+		})
+
+		it("does not retry when retries are disabled", func() {
+			registry.FailNext(http.MethodGet, "/manifests/", 1, http.StatusServiceUnavailable)
+
+			_, err := cache.NewImageCacheFromName(registry.Host()+"/some/cache", authn.DefaultKeychain, lifecycle.Retry{})
+			h.AssertNotNil(t, err)
+		})
+	})
 }
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const lockRetryInterval = 100 * time.Millisecond
+
+// errLocked is returned when a lock is held by another process
+var errLocked = errors.New("locked by another process")
+
+// lock is an advisory lock on a file, it is released when the process exits
+type lock struct {
+	file *os.File
+}
+
+// tryLock takes the lock on the file at path without waiting, creating the file if needed.
+// An exclusive lock conflicts with any other lock, a shared lock only conflicts with an exclusive lock.
+func tryLock(path string, exclusive bool) (*lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &lock{file: f}, nil
+}
+
+// tryLockExisting takes the lock on the existing file at path without waiting or writing to the file system
+func tryLockExisting(path string, exclusive bool) (*lock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &lock{file: f}, nil
+}
+
+// waitLock takes the lock on the file at path, waiting up to timeout for other processes to release it.
+// A timeout of zero fails immediately and a negative timeout waits indefinitely.
+func waitLock(path string, exclusive bool, timeout time.Duration) (*lock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		l, err := tryLock(path, exclusive)
+		if err != errLocked {
+			return l, err
+		}
+		if timeout >= 0 && !time.Now().Before(deadline) {
+			return nil, err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (l *lock) release() error {
+	if l == nil {
+		return nil
+	}
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
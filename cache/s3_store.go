@@ -0,0 +1,315 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultS3Region  = "us-east-1"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3SigningAlg     = "AWS4-HMAC-SHA256"
+	s3TimeFormat     = "20060102T150405Z"
+	s3DateFormat     = "20060102"
+	s3ErrorBodyLimit = 1024
+	s3MaxParts       = 10000
+	s3PartSize       = 64 * 1024 * 1024
+)
+
+// S3Credentials sign requests to an S3 compatible object store, requests are anonymous when AccessKeyID is empty
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3CredentialsFromEnv reads credentials from the standard AWS environment variables
+func S3CredentialsFromEnv() S3Credentials {
+	return S3Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// S3Store is a BlobStore in a bucket of an S3 compatible object store.
+// Objects are addressed by path (<endpoint>/<bucket>/<prefix>/<key>) so that stores other than AWS S3 are supported.
+type S3Store struct {
+	// PartSize is the size above which objects are uploaded in parts, S3 rejects single uploads over 5 GiB
+	// and parts other than the last under 5 MiB
+	PartSize int64
+
+	endpoint    *url.URL
+	bucket      string
+	prefix      string
+	region      string
+	credentials S3Credentials
+	client      *http.Client
+}
+
+// NewS3Store returns a store for a URL of the form s3://<bucket>/<prefix>[?endpoint=<endpoint URL>&region=<region>].
+// The region defaults to AWS_REGION or us-east-1, and the endpoint defaults to the AWS S3 endpoint of the region.
+func NewS3Store(u *url.URL, credentials S3Credentials) (*S3Store, error) {
+	if u.Host == "" {
+		return nil, errors.New("missing bucket")
+	}
+	query := u.Query()
+	region := query.Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = defaultS3Region
+	}
+	rawEndpoint := query.Get("endpoint")
+	if rawEndpoint == "" {
+		rawEndpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	endpoint, err := url.Parse(rawEndpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing endpoint '%s'", rawEndpoint)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, errors.Errorf("endpoint '%s' must be an http or https URL", rawEndpoint)
+	}
+	return &S3Store{
+		PartSize:    s3PartSize,
+		endpoint:    endpoint,
+		bucket:      u.Host,
+		prefix:      strings.Trim(u.Path, "/"),
+		region:      region,
+		credentials: credentials,
+		client:      http.DefaultClient,
+	}, nil
+}
+
+// Exists returns whether the object with key exists.
+// S3 denies a HEAD request for a missing object when the credentials may not list the bucket,
+// and the response has no body to tell it apart from other denials, so a denied HEAD request is reported as not found.
+// Credentials that are rejected altogether fail the next Get or Put instead.
+func (s *S3Store) Exists(key string) (bool, error) {
+	resp, err := s.do(http.MethodHead, key, nil, nil, 0)
+	if errors.Is(err, ErrBlobNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Put(key string, r io.Reader, size int64) error {
+	if s.PartSize > 0 && size > s.PartSize {
+		return s.putMultipart(key, r, size)
+	}
+	resp, err := s.do(http.MethodPut, key, nil, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// putMultipart uploads the object with key in parts, the upload is aborted if a part cannot be uploaded
+func (s *S3Store) putMultipart(key string, r io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0)
+	if err != nil {
+		return errors.Wrap(err, "initiating multipart upload")
+	}
+	var initiated s3InitiateMultipartUploadResult
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return errors.Wrapf(err, "decoding multipart upload of '%s'", key)
+	}
+	uploadID := initiated.UploadID
+
+	if err := s.uploadParts(key, uploadID, r, size); err != nil {
+		if resp, abortErr := s.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *S3Store) uploadParts(key, uploadID string, r io.Reader, size int64) error {
+	partSize := s.PartSize
+	if minPartSize := (size + s3MaxParts - 1) / s3MaxParts; partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	var complete s3CompleteMultipartUpload
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		n := partSize
+		if size-offset < n {
+			n = size - offset
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(http.MethodPut, key, query, io.LimitReader(r, n), n)
+		if err != nil {
+			return errors.Wrapf(err, "uploading part %d", number)
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, s3CompletedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return errors.Wrap(err, "completing multipart upload")
+	}
+	defer resp.Body.Close()
+	// a completion that fails after the response has started is reported in the body of a successful response
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, s3ErrorBodyLimit))
+	if bytes.Contains(msg, []byte("<Error>")) {
+		return errors.Errorf("completing multipart upload of '%s': %s", key, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// do sends a signed request for the object with key and returns the response if it succeeded
+func (s *S3Store) do(method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	objectURL := *s.endpoint
+	objectURL.Path = strings.TrimSuffix(objectURL.Path, "/") + "/" + strings.Join(nonEmpty(s.bucket, s.prefix, key), "/")
+	objectURL.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, objectURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s '%s'", method, key)
+	}
+	if resp.StatusCode == http.StatusNotFound || (method == http.MethodHead && resp.StatusCode == http.StatusForbidden) {
+		resp.Body.Close()
+		return nil, errors.Wrapf(ErrBlobNotFound, "%s '%s'", method, key)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, s3ErrorBodyLimit))
+		return nil, errors.Errorf("%s '%s': unexpected status code %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to req.
+// The payload is not signed so that layers can be streamed without reading them twice.
+func (s *S3Store) sign(req *http.Request) {
+	if s.credentials.AccessKeyID == "" {
+		return
+	}
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedBody)
+	signS3Request(req, s.credentials, s.region, time.Now().UTC())
+}
+
+// signS3Request signs req at time now, with the host and x-amz-* headers and the payload hash in the X-Amz-Content-Sha256 header
+func signS3Request(req *http.Request, credentials S3Credentials, region string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := strings.Join([]string{now.Format(s3DateFormat), region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{s3SigningAlg, now.Format(s3TimeFormat), scope, hexSHA256(canonicalRequest)}, "\n")
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{now.Format(s3DateFormat), region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlg, credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func nonEmpty(parts ...string) []string {
+	var out []string
+	for _, part := range parts {
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
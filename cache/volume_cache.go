@@ -3,46 +3,96 @@ package cache
 import (
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/platform"
 )
 
+const DefaultLockTimeout = time.Minute
+
+// VolumeCache is a cache in a directory that may be shared by concurrent lifecycles.
+// Each lifecycle stages layers in its own staging directory. Commit moves the staging directory
+// to a new generation and atomically points the committed symlink at it, generations are removed
+// once no lifecycle is reading them. Changes to the directory are guarded by an advisory lock.
 type VolumeCache struct {
 	committed    bool
 	dir          string
-	backupDir    string
 	stagingDir   string
-	committedDir string
+	committedDir string // committedDir is the generation read by this lifecycle
+	lockTimeout  time.Duration
+	readOnly     bool
+
+	stagingLock *lock // held while staging, so the staging dir is not removed as stale
+	readLock    *lock // held on the committed generation, so it is not removed while read
+
+	mu          sync.Mutex
+	quarantined map[string]bool
+}
+
+type VolumeCacheOption func(*VolumeCache)
+
+// WithLockTimeout sets how long to wait for another lifecycle to release the cache lock.
+// A timeout of zero fails immediately and a negative timeout waits indefinitely.
+func WithLockTimeout(timeout time.Duration) VolumeCacheOption {
+	return func(c *VolumeCache) {
+		c.lockTimeout = timeout
+	}
+}
+
+// WithReadOnly opens the cache without writing to the directory: nothing is staged, stale directories are
+// not removed and a committed directory written by an earlier lifecycle is not migrated.
+// The committed generation is only locked for reading, the cache cannot be modified or committed.
+func WithReadOnly() VolumeCacheOption {
+	return func(c *VolumeCache) {
+		c.readOnly = true
+	}
 }
 
-func NewVolumeCache(dir string) (*VolumeCache, error) {
+func NewVolumeCache(dir string, opts ...VolumeCacheOption) (*VolumeCache, error) {
 	if _, err := os.Stat(dir); err != nil {
 		return nil, err
 	}
 
 	c := &VolumeCache{
-		dir:          dir,
-		backupDir:    filepath.Join(dir, "committed-backup"),
-		stagingDir:   filepath.Join(dir, "staging"),
-		committedDir: filepath.Join(dir, "committed"),
+		dir:         dir,
+		lockTimeout: DefaultLockTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 
-	if err := c.setupStagingDir(); err != nil {
-		return nil, errors.Wrapf(err, "initializing staging directory '%s'", c.stagingDir)
+	if c.readOnly {
+		if err := c.readCommittedDir(); err != nil {
+			return nil, errors.Wrapf(err, "reading committed directory '%s'", c.committedPath())
+		}
+		return c, nil
+	}
+
+	cacheLock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer cacheLock.release()
+
+	if err := c.removeStale(); err != nil {
+		return nil, err
 	}
 
-	if err := os.RemoveAll(c.backupDir); err != nil {
-		return nil, errors.Wrapf(err, "removing backup directory '%s'", c.backupDir)
+	if err := c.setupCommittedDir(); err != nil {
+		return nil, errors.Wrapf(err, "initializing committed directory '%s'", c.committedPath())
 	}
 
-	if err := os.MkdirAll(c.committedDir, 0777); err != nil {
-		return nil, errors.Wrapf(err, "creating committed directory '%s'", c.committedDir)
+	if err := c.setupStagingDir(); err != nil {
+		return nil, errors.Wrapf(err, "initializing staging directory in '%s'", dir)
 	}
 
 	return c, nil
@@ -60,8 +110,8 @@ func (c *VolumeCache) Name() string {
 }
 
 func (c *VolumeCache) SetMetadata(metadata platform.CacheMetadata) error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 	metadataPath := filepath.Join(c.stagingDir, MetadataLabel)
 	file, err := os.Create(metadataPath)
@@ -89,15 +139,15 @@ func (c *VolumeCache) RetrieveMetadata() (platform.CacheMetadata, error) {
 	defer file.Close()
 
 	metadata := platform.CacheMetadata{}
-	if json.NewDecoder(file).Decode(&metadata) != nil {
-		return platform.CacheMetadata{}, nil
+	if err := json.NewDecoder(file).Decode(&metadata); err != nil {
+		return platform.CacheMetadata{}, errors.Wrapf(lifecycle.ErrCorruptCacheMetadata, "decoding metadata file '%s': %s", metadataPath, err)
 	}
 	return metadata, nil
 }
 
 func (c *VolumeCache) AddLayerFile(tarPath string, diffID string) error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 	layerTar := diffIDPath(c.stagingDir, diffID)
 	if _, err := os.Stat(layerTar); err == nil {
@@ -112,8 +162,8 @@ func (c *VolumeCache) AddLayerFile(tarPath string, diffID string) error {
 }
 
 func (c *VolumeCache) AddLayer(rc io.ReadCloser, diffID string) error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 
 	fh, err := os.Create(diffIDPath(c.stagingDir, diffID))
@@ -129,8 +179,11 @@ func (c *VolumeCache) AddLayer(rc io.ReadCloser, diffID string) error {
 }
 
 func (c *VolumeCache) ReuseLayer(diffID string) error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+	if c.isQuarantined(diffID) {
+		return errors.Errorf("layer with SHA '%s' is quarantined", diffID)
 	}
 	if err := os.Link(diffIDPath(c.committedDir, diffID), diffIDPath(c.stagingDir, diffID)); err != nil && !os.IsExist(err) {
 		return errors.Wrapf(err, "reusing layer (%s)", diffID)
@@ -151,6 +204,9 @@ func (c *VolumeCache) RetrieveLayer(diffID string) (io.ReadCloser, error) {
 }
 
 func (c *VolumeCache) HasLayer(diffID string) (bool, error) {
+	if c.isQuarantined(diffID) {
+		return false, nil
+	}
 	if _, err := os.Stat(diffIDPath(c.committedDir, diffID)); err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -161,34 +217,97 @@ func (c *VolumeCache) HasLayer(diffID string) (bool, error) {
 }
 
 func (c *VolumeCache) RetrieveLayerFile(diffID string) (string, error) {
+	if c.isQuarantined(diffID) {
+		return "", errors.Errorf("layer with SHA '%s' is quarantined", diffID)
+	}
 	path := diffIDPath(c.committedDir, diffID)
 	if _, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
-			return "", errors.Wrapf(err, "layer with SHA '%s' not found", diffID)
+			return "", errors.Wrapf(lifecycle.ErrLayerNotFound, "layer with SHA '%s' not found", diffID)
 		}
 		return "", errors.Wrapf(err, "retrieving layer with SHA '%s'", diffID)
 	}
 	return path, nil
 }
 
+// QuarantineLayer prevents a corrupt layer from being retrieved or reused by this cache.
+// The committed generation is shared by other lifecycles and is not modified, the layer is left out
+// of the generation staged by this cache and linked into the quarantine directory for inspection.
+func (c *VolumeCache) QuarantineLayer(diffID string) error {
+	c.mu.Lock()
+	if c.quarantined == nil {
+		c.quarantined = map[string]bool{}
+	}
+	c.quarantined[diffID] = true
+	c.mu.Unlock()
+	if c.readOnly {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.quarantinePath(), 0777); err != nil {
+		return errors.Wrap(err, "creating quarantine directory")
+	}
+	path := diffIDPath(c.committedDir, diffID)
+	if err := os.Link(path, filepath.Join(c.quarantinePath(), filepath.Base(path))); err != nil && !os.IsExist(err) && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "quarantining layer with SHA '%s'", diffID)
+	}
+	return nil
+}
+
+func (c *VolumeCache) isQuarantined(diffID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quarantined[diffID]
+}
+
 func (c *VolumeCache) Commit() error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 	c.committed = true
-	if err := os.Rename(c.committedDir, c.backupDir); err != nil {
-		return errors.Wrap(err, "backing up cache")
+
+	cacheLock, err := c.lock()
+	if err != nil {
+		return err
 	}
-	defer os.RemoveAll(c.backupDir)
+	defer cacheLock.release()
 
-	if err1 := os.Rename(c.stagingDir, c.committedDir); err1 != nil {
-		if err2 := os.Rename(c.backupDir, c.committedDir); err2 != nil {
-			return errors.Wrap(err2, "rolling back cache")
-		}
-		return errors.Wrap(err1, "committing cache")
+	generation := strings.TrimPrefix(filepath.Base(c.stagingDir), stagingPrefix)
+	generationDir := filepath.Join(c.generationsPath(), generation)
+	if err := os.Rename(c.stagingDir, generationDir); err != nil {
+		return errors.Wrap(err, "committing cache")
+	}
+	readLock, err := tryLock(generationDir+lockSuffix, false)
+	if err != nil {
+		return errors.Wrap(err, "locking committed generation")
+	}
+	if err := replaceSymlink(filepath.Join(generationsDir, generation), c.committedPath()); err != nil {
+		readLock.release()
+		return errors.Wrap(err, "committing cache")
 	}
 
-	return nil
+	c.readLock.release()
+	c.readLock = readLock
+	c.committedDir = generationDir
+	c.stagingLock.release()
+	c.stagingLock = nil
+	os.Remove(c.stagingDir + lockSuffix)
+
+	return c.removeUnusedGenerations(generation)
+}
+
+// Close releases the locks held by the cache and removes its staging directory if it was not committed
+func (c *VolumeCache) Close() error {
+	if !c.committed && !c.readOnly {
+		if err := os.RemoveAll(c.stagingDir); err != nil {
+			return err
+		}
+		c.committed = true
+	}
+	if err := c.stagingLock.release(); err != nil {
+		return err
+	}
+	return c.readLock.release()
 }
 
 func diffIDPath(basePath, diffID string) string {
@@ -199,11 +318,221 @@ func diffIDPath(basePath, diffID string) string {
 	return filepath.Join(basePath, diffID+".tar")
 }
 
+const (
+	committedDir   = "committed"
+	generationsDir = "generations"
+	quarantineDir  = "quarantine"
+	cacheLockFile  = "lock"
+	lockSuffix     = ".lock"
+	stagingPrefix  = "staging-"
+
+	readCommittedAttempts = 3
+
+	legacyStagingDir = "staging"
+	legacyBackupDir  = "committed-backup"
+)
+
+func (c *VolumeCache) committedPath() string {
+	return filepath.Join(c.dir, committedDir)
+}
+
+func (c *VolumeCache) quarantinePath() string {
+	return filepath.Join(c.dir, quarantineDir)
+}
+
+func (c *VolumeCache) generationsPath() string {
+	return filepath.Join(c.dir, generationsDir)
+}
+
+func (c *VolumeCache) lock() (*lock, error) {
+	l, err := waitLock(filepath.Join(c.dir, cacheLockFile), true, c.lockTimeout)
+	if err == errLocked {
+		return nil, errors.Errorf("cache directory '%s' is locked by another lifecycle, waited %s", c.dir, c.lockTimeout)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "locking cache directory '%s'", c.dir)
+	}
+	return l, nil
+}
+
+// setupCommittedDir finds the committed generation and locks it for reading
+func (c *VolumeCache) setupCommittedDir() error {
+	if err := os.MkdirAll(c.generationsPath(), 0777); err != nil {
+		return err
+	}
+	if err := c.migrateCommittedDir(); err != nil {
+		return errors.Wrap(err, "migrating committed directory")
+	}
+	_, err := os.Lstat(c.committedPath())
+	switch {
+	case os.IsNotExist(err):
+		generation, err := ioutil.TempDir(c.generationsPath(), "")
+		if err != nil {
+			return err
+		}
+		if err := replaceSymlink(filepath.Join(generationsDir, filepath.Base(generation)), c.committedPath()); err != nil {
+			return err
+		}
+		c.committedDir = generation
+	case err != nil:
+		return err
+	default:
+		target, err := os.Readlink(c.committedPath())
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(c.dir, target)
+		}
+		c.committedDir = target
+	}
+	c.readLock, err = tryLock(c.committedDir+lockSuffix, false)
+	return err
+}
+
+// readCommittedDir finds the committed generation and locks it for reading, without writing to the cache directory.
+// The committed symlink is read again when the generation it pointed to is removed before it could be locked,
+// including when it is removed after its lock file was opened.
+func (c *VolumeCache) readCommittedDir() error {
+	for attempt := 0; ; attempt++ {
+		fi, err := os.Lstat(c.committedPath())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			// written by an earlier lifecycle, which does not lock it
+			c.committedDir = c.committedPath()
+			return nil
+		}
+		target, err := os.Readlink(c.committedPath())
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(c.dir, target)
+		}
+		c.readLock, err = tryLockExisting(target+lockSuffix, false)
+		if (os.IsNotExist(err) || err == errLocked) && attempt < readCommittedAttempts {
+			time.Sleep(lockRetryInterval)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			c.readLock.release()
+			c.readLock = nil
+			if attempt < readCommittedAttempts {
+				time.Sleep(lockRetryInterval)
+				continue
+			}
+			return errors.Errorf("committed generation '%s' was removed", target)
+		}
+		c.committedDir = target
+		return nil
+	}
+}
+
+func (c *VolumeCache) checkWritable() error {
+	if c.readOnly {
+		return errCacheReadOnly
+	}
+	if c.committed {
+		return errCacheCommitted
+	}
+	return nil
+}
+
 func (c *VolumeCache) setupStagingDir() error {
-	if err := os.RemoveAll(c.stagingDir); err != nil {
+	stagingDir, err := ioutil.TempDir(c.dir, stagingPrefix)
+	if err != nil {
+		return err
+	}
+	c.stagingDir = stagingDir
+	c.stagingLock, err = tryLock(stagingDir+lockSuffix, true)
+	return err
+}
+
+// migrateCommittedDir moves a committed directory written by an earlier lifecycle to a generation
+// and points the committed symlink at it
+func (c *VolumeCache) migrateCommittedDir() error {
+	fi, err := os.Lstat(c.committedPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil || fi.Mode()&os.ModeSymlink != 0 {
+		return err
+	}
+	generation, err := ioutil.TempDir(c.generationsPath(), "")
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(generation); err != nil {
+		return err
+	}
+	if err := os.Rename(c.committedPath(), generation); err != nil {
+		return err
+	}
+	return replaceSymlink(filepath.Join(generationsDir, filepath.Base(generation)), c.committedPath())
+}
+
+// removeStale removes staging directories of lifecycles that are no longer running,
+// along with the directories used by earlier lifecycles
+func (c *VolumeCache) removeStale() error {
+	for _, dir := range []string{legacyStagingDir, legacyBackupDir} {
+		if err := os.RemoveAll(filepath.Join(c.dir, dir)); err != nil {
+			return errors.Wrapf(err, "removing directory '%s'", dir)
+		}
+	}
+	stagingDirs, err := filepath.Glob(filepath.Join(c.dir, stagingPrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range stagingDirs {
+		if strings.HasSuffix(dir, lockSuffix) {
+			continue
+		}
+		if err := removeUnlocked(dir); err != nil {
+			return errors.Wrapf(err, "removing stale staging directory '%s'", dir)
+		}
+	}
+	return nil
+}
+
+// removeUnusedGenerations removes the generations other than current that are not being read
+func (c *VolumeCache) removeUnusedGenerations(current string) error {
+	fis, err := ioutil.ReadDir(c.generationsPath())
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() || fi.Name() == current {
+			continue
+		}
+		if err := removeUnlocked(filepath.Join(c.generationsPath(), fi.Name())); err != nil {
+			return errors.Wrapf(err, "removing unused generation '%s'", fi.Name())
+		}
+	}
+	return nil
+}
+
+// removeUnlocked removes dir unless another lifecycle holds a lock on it
+func removeUnlocked(dir string) error {
+	l, err := tryLock(dir+lockSuffix, true)
+	if err == errLocked {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer l.release()
+	if err := os.RemoveAll(dir); err != nil {
 		return err
 	}
-	return os.MkdirAll(c.stagingDir, 0777)
+	return os.Remove(dir + lockSuffix)
 }
 
 func copyFile(from, to string) error {
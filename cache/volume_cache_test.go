@@ -7,12 +7,15 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
+	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/buildpack/layertypes"
 	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/platform"
@@ -29,8 +32,6 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 		tmpDir       string
 		volumeDir    string
 		subject      *cache.VolumeCache
-		backupDir    string
-		stagingDir   string
 		committedDir string
 	)
 
@@ -43,12 +44,13 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 		volumeDir = filepath.Join(tmpDir, "test_volume")
 		h.AssertNil(t, os.MkdirAll(volumeDir, os.ModePerm))
 
-		backupDir = filepath.Join(volumeDir, "committed-backup")
-		stagingDir = filepath.Join(volumeDir, "staging")
 		committedDir = filepath.Join(volumeDir, "committed")
 	})
 
 	it.After(func() {
+		if subject != nil {
+			subject.Close()
+		}
 		os.RemoveAll(tmpDir)
 	})
 
@@ -60,38 +62,58 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 			}
 		})
 
-		when("staging already exists", func() {
+		when("a stale staging dir exists", func() {
+			var stalePath string
+
 			it.Before(func() {
-				stagingPath := filepath.Join(volumeDir, "staging")
-				h.AssertNil(t, os.MkdirAll(stagingPath, 0777))
-				h.AssertNil(t, ioutil.WriteFile(filepath.Join(stagingPath, "some-layer.tar"), []byte("some data"), 0666))
+				stalePath = filepath.Join(volumeDir, "staging-stale")
+				h.AssertNil(t, os.MkdirAll(stalePath, 0777))
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(stalePath, "some-layer.tar"), []byte("some data"), 0666))
 			})
 
-			it("clears staging", func() {
+			it("removes it", func() {
 				var err error
 
 				subject, err = cache.NewVolumeCache(volumeDir)
 				h.AssertNil(t, err)
 
-				_, err = os.Stat(filepath.Join(stagingDir, "some-layer.tar"))
-				if err == nil {
-					t.Fatal("expect NewVolumeCache to clear the staging dir")
+				if _, err := os.Stat(stalePath); !os.IsNotExist(err) {
+					t.Fatal("expect NewVolumeCache to remove the stale staging dir")
 				}
 			})
 		})
 
-		when("staging does not exist", func() {
-			it("creates staging dir", func() {
+		when("staging dirs of earlier lifecycles exist", func() {
+			it.Before(func() {
+				for _, dir := range []string{"staging", "committed-backup"} {
+					h.AssertNil(t, os.MkdirAll(filepath.Join(volumeDir, dir), 0777))
+					h.AssertNil(t, ioutil.WriteFile(filepath.Join(volumeDir, dir, "some-layer.tar"), []byte("some data"), 0666))
+				}
+			})
+
+			it("removes them", func() {
 				var err error
 
 				subject, err = cache.NewVolumeCache(volumeDir)
 				h.AssertNil(t, err)
 
-				_, err = os.Stat(stagingDir)
-				h.AssertNil(t, err)
+				for _, dir := range []string{"staging", "committed-backup"} {
+					if _, err := os.Stat(filepath.Join(volumeDir, dir)); !os.IsNotExist(err) {
+						t.Fatalf("expect NewVolumeCache to remove '%s'", dir)
+					}
+				}
 			})
 		})
 
+		it("creates a staging dir", func() {
+			var err error
+
+			subject, err = cache.NewVolumeCache(volumeDir)
+			h.AssertNil(t, err)
+
+			findStagingDir(t, volumeDir)
+		})
+
 		when("committed does not exist", func() {
 			it("creates committed dir", func() {
 				var err error
@@ -104,24 +126,228 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
-		when("backup dir already exists", func() {
+		when("committed is a directory written by an earlier lifecycle", func() {
 			it.Before(func() {
-				h.AssertNil(t, os.MkdirAll(backupDir, 0777))
-				h.AssertNil(t, ioutil.WriteFile(filepath.Join(backupDir, "some-layer.tar"), []byte("some data"), 0666))
+				h.AssertNil(t, os.MkdirAll(committedDir, 0777))
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(committedDir, "some_sha.tar"), []byte("dummy data"), 0666))
 			})
 
-			it("clears the backup dir", func() {
+			it("reads and replaces it", func() {
 				var err error
 
 				subject, err = cache.NewVolumeCache(volumeDir)
 				h.AssertNil(t, err)
+				h.AssertNil(t, subject.ReuseLayer("some_sha"))
+				h.AssertNil(t, subject.Commit())
 
-				_, err = os.Stat(filepath.Join(backupDir, "some-layer.tar"))
-				if err == nil {
-					t.Fatal("expect NewVolumeCache to clear the staging dir")
-				}
+				fi, err := os.Lstat(committedDir)
+				h.AssertNil(t, err)
+				h.AssertEq(t, fi.Mode()&os.ModeSymlink != 0, true)
+				bytes, err := ioutil.ReadFile(filepath.Join(committedDir, "some_sha.tar"))
+				h.AssertNil(t, err)
+				h.AssertEq(t, string(bytes), "dummy data")
 			})
 		})
+
+		when("read-only", func() {
+			listVolume := func() []string {
+				var paths []string
+				h.AssertNil(t, filepath.Walk(volumeDir, func(path string, _ os.FileInfo, err error) error {
+					paths = append(paths, path)
+					return err
+				}))
+				return paths
+			}
+
+			it("does not write to an empty volume", func() {
+				var err error
+
+				subject, err = cache.NewVolumeCache(volumeDir, cache.WithReadOnly())
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, subject.Exists(), false)
+				h.AssertEq(t, listVolume(), []string{volumeDir})
+				h.AssertNil(t, subject.Close())
+			})
+
+			it("reads the committed generation without writing to the volume", func() {
+				writable, err := cache.NewVolumeCache(volumeDir)
+				h.AssertNil(t, err)
+				h.AssertNil(t, writable.AddLayer(ioutil.NopCloser(strings.NewReader("dummy data")), "some_sha"))
+				h.AssertNil(t, writable.Commit())
+				h.AssertNil(t, writable.Close())
+				before := listVolume()
+
+				subject, err = cache.NewVolumeCache(volumeDir, cache.WithReadOnly())
+				h.AssertNil(t, err)
+
+				path, err := subject.RetrieveLayerFile("some_sha")
+				h.AssertNil(t, err)
+				bytes, err := ioutil.ReadFile(path)
+				h.AssertNil(t, err)
+				h.AssertEq(t, string(bytes), "dummy data")
+				h.AssertNil(t, subject.QuarantineLayer("some_sha"))
+				h.AssertNil(t, subject.Close())
+				h.AssertEq(t, listVolume(), before)
+			})
+
+			it("does not migrate a committed directory written by an earlier lifecycle", func() {
+				h.AssertNil(t, os.MkdirAll(committedDir, 0777))
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(committedDir, "some_sha.tar"), []byte("dummy data"), 0666))
+				var err error
+
+				subject, err = cache.NewVolumeCache(volumeDir, cache.WithReadOnly())
+				h.AssertNil(t, err)
+
+				hasLayer, err := subject.HasLayer("some_sha")
+				h.AssertNil(t, err)
+				h.AssertEq(t, hasLayer, true)
+				fi, err := os.Lstat(committedDir)
+				h.AssertNil(t, err)
+				h.AssertEq(t, fi.IsDir(), true)
+				h.AssertPathDoesNotExist(t, filepath.Join(volumeDir, "generations"))
+			})
+
+			when("the committed generation is removed while it is locked", func() {
+				var generation string
+
+				it.Before(func() {
+					writable, err := cache.NewVolumeCache(volumeDir)
+					h.AssertNil(t, err)
+					h.AssertNil(t, writable.AddLayer(ioutil.NopCloser(strings.NewReader("dummy data")), "some_sha"))
+					h.AssertNil(t, writable.Commit())
+					h.AssertNil(t, writable.Close())
+					generation, err = os.Readlink(committedDir)
+					h.AssertNil(t, err)
+
+					// the generation is removed after its lock file is opened, but before its lock is taken
+					h.AssertNil(t, os.Rename(filepath.Join(volumeDir, generation), filepath.Join(volumeDir, "moved")))
+				})
+
+				it("reads the committed symlink again", func() {
+					// another lifecycle commits a new generation
+					newGeneration := filepath.Join("generations", "new-generation")
+					h.AssertNil(t, os.Rename(filepath.Join(volumeDir, "moved"), filepath.Join(volumeDir, newGeneration)))
+					h.AssertNil(t, ioutil.WriteFile(filepath.Join(volumeDir, newGeneration+".lock"), nil, 0666))
+					h.AssertNil(t, os.Symlink(newGeneration, filepath.Join(volumeDir, "committed-new")))
+					go func() {
+						time.Sleep(50 * time.Millisecond)
+						_ = os.Rename(filepath.Join(volumeDir, "committed-new"), committedDir)
+					}()
+
+					var err error
+					subject, err = cache.NewVolumeCache(volumeDir, cache.WithReadOnly())
+					h.AssertNil(t, err)
+
+					hasLayer, err := subject.HasLayer("some_sha")
+					h.AssertNil(t, err)
+					h.AssertEq(t, hasLayer, true)
+					h.AssertNil(t, subject.Close())
+				})
+
+				it("fails when the committed symlink still points to the removed generation", func() {
+					_, err := cache.NewVolumeCache(volumeDir, cache.WithReadOnly())
+					h.AssertError(t, err, "was removed")
+				})
+			})
+
+			it("cannot be modified", func() {
+				var err error
+
+				subject, err = cache.NewVolumeCache(volumeDir, cache.WithReadOnly())
+				h.AssertNil(t, err)
+
+				h.AssertError(t, subject.SetMetadata(platform.CacheMetadata{}), "cache is read-only")
+				h.AssertError(t, subject.AddLayer(ioutil.NopCloser(strings.NewReader("dummy data")), "some_sha"), "cache is read-only")
+				h.AssertError(t, subject.ReuseLayer("some_sha"), "cache is read-only")
+				h.AssertError(t, subject.Commit(), "cache is read-only")
+			})
+		})
+
+		when("the cache is locked by another lifecycle", func() {
+			var other *cache.VolumeCache
+
+			it.Before(func() {
+				var err error
+				other, err = cache.NewVolumeCache(volumeDir)
+				h.AssertNil(t, err)
+			})
+
+			it.After(func() {
+				h.AssertNil(t, other.Close())
+			})
+
+			it("does not wait for other lifecycles that are not committing", func() {
+				var err error
+
+				subject, err = cache.NewVolumeCache(volumeDir, cache.WithLockTimeout(0))
+				h.AssertNil(t, err)
+			})
+		})
+	})
+
+	when("multiple lifecycles share the volume", func() {
+		var first, second *cache.VolumeCache
+
+		it.Before(func() {
+			var err error
+			h.AssertNil(t, os.MkdirAll(committedDir, 0777))
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(committedDir, "old_sha.tar"), []byte("old data"), 0666))
+
+			first, err = cache.NewVolumeCache(volumeDir)
+			h.AssertNil(t, err)
+			second, err = cache.NewVolumeCache(volumeDir)
+			h.AssertNil(t, err)
+		})
+
+		it.After(func() {
+			first.Close()
+			second.Close()
+		})
+
+		it("stages layers separately", func() {
+			h.AssertNil(t, first.AddLayer(ioutil.NopCloser(strings.NewReader("first data")), "first_sha"))
+			h.AssertNil(t, second.AddLayer(ioutil.NopCloser(strings.NewReader("second data")), "second_sha"))
+
+			h.AssertNil(t, first.Commit())
+			h.AssertNil(t, second.Commit())
+
+			third, err := cache.NewVolumeCache(volumeDir)
+			h.AssertNil(t, err)
+			defer third.Close()
+			found, err := third.HasLayer("second_sha")
+			h.AssertNil(t, err)
+			h.AssertEq(t, found, true)
+			found, err = third.HasLayer("first_sha")
+			h.AssertNil(t, err)
+			h.AssertEq(t, found, false)
+		})
+
+		it("reads the generation that was committed when it started", func() {
+			h.AssertNil(t, first.Commit())
+
+			rc, err := second.RetrieveLayer("old_sha")
+			h.AssertNil(t, err)
+			defer rc.Close()
+			bytes, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(bytes), "old data")
+		})
+
+		it("removes generations once they are no longer read", func() {
+			h.AssertNil(t, first.Commit())
+			h.AssertNil(t, second.Commit())
+
+			generations, err := filepath.Glob(filepath.Join(volumeDir, "generations", "*"))
+			h.AssertNil(t, err)
+			var dirs []string
+			for _, generation := range generations {
+				if !strings.HasSuffix(generation, ".lock") {
+					dirs = append(dirs, generation)
+				}
+			}
+			h.AssertEq(t, len(dirs), 2) // first is still reading the generation it committed
+		})
 	})
 
 	when("VolumeCache", func() {
@@ -177,9 +403,11 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 					h.AssertNil(t, ioutil.WriteFile(filepath.Join(committedDir, "io.buildpacks.lifecycle.cache.metadata"), []byte("garbage"), 0666))
 				})
 
-				it("returns empty metadata", func() {
+				it("returns a corrupt metadata error", func() {
 					meta, err := subject.RetrieveMetadata()
-					h.AssertNil(t, err)
+					if !errors.Is(err, lifecycle.ErrCorruptCacheMetadata) {
+						t.Fatalf("expected corrupt metadata error, got: %v", err)
+					}
 					h.AssertEq(t, len(meta.Buildpacks), 0)
 				})
 			})
@@ -217,6 +445,39 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("#QuarantineLayer", func() {
+			it.Before(func() {
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(committedDir, "some_sha.tar"), []byte("dummy data"), 0666))
+			})
+
+			it("prevents the layer from being retrieved or reused", func() {
+				h.AssertNil(t, subject.QuarantineLayer("some_sha"))
+
+				_, err := subject.RetrieveLayer("some_sha")
+				h.AssertError(t, err, "layer with SHA 'some_sha' is quarantined")
+				hasLayer, err := subject.HasLayer("some_sha")
+				h.AssertNil(t, err)
+				h.AssertEq(t, hasLayer, false)
+				h.AssertError(t, subject.ReuseLayer("some_sha"), "layer with SHA 'some_sha' is quarantined")
+			})
+
+			it("keeps the layer for inspection without modifying the committed dir", func() {
+				h.AssertNil(t, subject.QuarantineLayer("some_sha"))
+
+				bytes, err := ioutil.ReadFile(filepath.Join(volumeDir, "quarantine", "some_sha.tar"))
+				h.AssertNil(t, err)
+				h.AssertEq(t, string(bytes), "dummy data")
+				h.AssertPathExists(t, filepath.Join(committedDir, "some_sha.tar"))
+			})
+
+			it("leaves the layer out of the next generation", func() {
+				h.AssertNil(t, subject.QuarantineLayer("some_sha"))
+				h.AssertNil(t, subject.Commit())
+
+				h.AssertPathDoesNotExist(t, filepath.Join(volumeDir, "committed", "some_sha.tar"))
+			})
+		})
+
 		when("#RetrieveLayerFile", func() {
 			when("layer exists", func() {
 				it.Before(func() {
@@ -243,7 +504,7 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 
 		when("#Commit", func() {
 			it("should clear the staging dir", func() {
-				layerTarPath := filepath.Join(stagingDir, "some-layer.tar")
+				layerTarPath := filepath.Join(findStagingDir(t, volumeDir), "some-layer.tar")
 				h.AssertNil(t, ioutil.WriteFile(layerTarPath, []byte("some data"), 0666))
 
 				err := subject.Commit()
@@ -527,3 +788,17 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 }
+
+func findStagingDir(t *testing.T, volumeDir string) string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(volumeDir, "staging-*"))
+	h.AssertNil(t, err)
+	var dirs []string
+	for _, match := range matches {
+		if !strings.HasSuffix(match, ".lock") {
+			dirs = append(dirs, match)
+		}
+	}
+	h.AssertEq(t, len(dirs), 1)
+	return dirs[0]
+}
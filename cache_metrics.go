@@ -0,0 +1,128 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/buildpacks/lifecycle/buildpack/layertypes"
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+const (
+	// restoreMetricsFile records the cache metrics of the restorer in the layers directory so that the exporter can report them
+	restoreMetricsFile = "restore-metrics.toml"
+	// quarantineFile records the cached layers the restorer found corrupt so that the exporter does not reuse them
+	quarantineFile = "quarantine.toml"
+)
+
+// quarantineRecord is the content of quarantineFile
+type quarantineRecord struct {
+	Layers []string `toml:"layers"`
+}
+
+// cacheMetrics collects the cache metrics of buildpack layers, it is safe for concurrent use
+type cacheMetrics struct {
+	mu         sync.Mutex
+	total      platform.CacheMetrics
+	buildpacks []*platform.BuildpackCacheReport
+}
+
+// add records metrics for a layer of the buildpack bpID, under each of the layer's types
+func (m *cacheMetrics) add(bpID string, types layertypes.LayerMetadataFile, metrics platform.CacheMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total.Add(metrics)
+	bp := m.buildpack(bpID)
+	bp.CacheMetrics.Add(metrics)
+	for _, layerType := range layerTypes(types) {
+		typeMetrics := bp.Types[layerType]
+		typeMetrics.Add(metrics)
+		bp.Types[layerType] = typeMetrics
+	}
+}
+
+// merge adds the metrics in report, which were collected by another phase
+func (m *cacheMetrics) merge(report platform.CacheReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total.Add(report.CacheMetrics)
+	for _, other := range report.Buildpacks {
+		bp := m.buildpack(other.ID)
+		bp.CacheMetrics.Add(other.CacheMetrics)
+		for layerType, metrics := range other.Types {
+			typeMetrics := bp.Types[layerType]
+			typeMetrics.Add(metrics)
+			bp.Types[layerType] = typeMetrics
+		}
+	}
+}
+
+func (m *cacheMetrics) report() platform.CacheReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := platform.CacheReport{CacheMetrics: m.total}
+	for _, bp := range m.buildpacks {
+		bpReport := platform.BuildpackCacheReport{ID: bp.ID, CacheMetrics: bp.CacheMetrics, Types: map[string]platform.CacheMetrics{}}
+		for layerType, metrics := range bp.Types {
+			bpReport.Types[layerType] = metrics
+		}
+		report.Buildpacks = append(report.Buildpacks, bpReport)
+	}
+	return report
+}
+
+func (m *cacheMetrics) buildpack(id string) *platform.BuildpackCacheReport {
+	for _, bp := range m.buildpacks {
+		if bp.ID == id {
+			return bp
+		}
+	}
+	bp := &platform.BuildpackCacheReport{ID: id, Types: map[string]platform.CacheMetrics{}}
+	m.buildpacks = append(m.buildpacks, bp)
+	return bp
+}
+
+func layerTypes(types layertypes.LayerMetadataFile) []string {
+	var out []string
+	if types.Launch {
+		out = append(out, "launch")
+	}
+	if types.Build {
+		out = append(out, "build")
+	}
+	if types.Cache {
+		out = append(out, "cache")
+	}
+	return out
+}
+
+// readRestoreMetrics returns the metrics written by the restorer, or an empty report if the restorer did not run
+func readRestoreMetrics(layersDir string) (platform.CacheReport, error) {
+	var report platform.CacheReport
+	if _, err := toml.DecodeFile(filepath.Join(layersDir, restoreMetricsFile), &report); err != nil && !os.IsNotExist(err) {
+		return platform.CacheReport{}, err
+	}
+	return report, nil
+}
+
+// readQuarantinedLayers returns the digests of the cached layers quarantined by the restorer,
+// or no digests if the restorer did not run
+func readQuarantinedLayers(layersDir string) ([]string, error) {
+	var record quarantineRecord
+	if _, err := toml.DecodeFile(filepath.Join(layersDir, quarantineFile), &record); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return record.Layers, nil
+}
+
+// fileSize is the size of the file at path, or 0 if it cannot be determined
+func fileSize(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
@@ -1,6 +1,7 @@
 package lifecycle_test
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -20,8 +21,10 @@ import (
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/buildpack/layertypes"
 	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/layers"
+	"github.com/buildpacks/lifecycle/platform"
 	h "github.com/buildpacks/lifecycle/testhelpers"
 	"github.com/buildpacks/lifecycle/testmock"
 )
@@ -95,6 +98,20 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 					assertCacheHasLayer(t, testCache, "other.buildpack.id:other-buildpack-layer")
 				})
 
+				it("reports the added layers", func() {
+					h.AssertNil(t, exporter.Cache(layersDir, testCache))
+
+					report := exporter.CacheReport()
+					h.AssertEq(t, report.CacheAdded, 3)
+					h.AssertEq(t, report.CacheReused, 0)
+					h.AssertEq(t, report.ImageAdded, 0)
+					if report.CacheAddedBytes == 0 {
+						t.Fatalf("expected the size of added layers to be recorded")
+					}
+					h.AssertEq(t, len(report.Buildpacks), 2)
+					h.AssertEq(t, report.Buildpacks[0].Types["cache"].CacheAdded, 2)
+				})
+
 				it("sets cache metadata", func() {
 					err := exporter.Cache(layersDir, testCache)
 					h.AssertNil(t, err)
@@ -325,7 +342,146 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 		})
+
+		when("the restorer quarantined a corrupt layer", func() {
+			var sha string
+
+			it.Before(func() {
+				contents := "cache-layer-contents"
+				sha = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(contents)))
+				layerFactory.EXPECT().
+					DirLayer(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(id string, dir string) (layers.Layer, error) {
+						tarPath := filepath.Join(tmpDir, "artifacts", "cache-layer")
+						if err := ioutil.WriteFile(tarPath, []byte(contents), 0666); err != nil {
+							return layers.Layer{}, err
+						}
+						return layers.Layer{ID: id, TarPath: tarPath, Digest: sha}, nil
+					}).AnyTimes()
+
+				previousCache, err := cache.NewVolumeCache(cacheDir)
+				h.AssertNil(t, err)
+				h.AssertNil(t, previousCache.AddLayer(ioutil.NopCloser(strings.NewReader("corrupt data")), sha))
+				h.AssertNil(t, previousCache.SetMetadata(platform.CacheMetadata{
+					Buildpacks: []platform.BuildpackLayersMetadata{{
+						ID: "buildpack.id",
+						Layers: map[string]platform.BuildpackLayerMetadata{
+							"cache-layer": {
+								LayerMetadata:     platform.LayerMetadata{SHA: sha},
+								LayerMetadataFile: layertypes.LayerMetadataFile{Cache: true},
+							},
+						},
+					}},
+				}))
+				h.AssertNil(t, previousCache.Commit())
+				h.AssertNil(t, previousCache.Close())
+
+				layersDir = filepath.Join(tmpDir, "layers")
+				meta := "[types]\n  cache=true"
+				h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-layer", meta, sha))
+				restoreCache, err := cache.NewVolumeCache(cacheDir)
+				h.AssertNil(t, err)
+				restorer := &lifecycle.Restorer{
+					LayersDir:  layersDir,
+					Buildpacks: exporter.Buildpacks,
+					Logger:     &log.Logger{Handler: logHandler},
+				}
+				h.AssertNil(t, restorer.Restore(restoreCache))
+				h.AssertNil(t, restoreCache.Close())
+
+				// the buildpack recreates the layer with the same contents
+				h.AssertNil(t, os.MkdirAll(filepath.Join(layersDir, "buildpack.id", "cache-layer"), 0777))
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(layersDir, "buildpack.id", "cache-layer.toml"), []byte(meta), 0666))
+			})
+
+			it("adds the layer instead of reusing the corrupt layer", func() {
+				exportCache, err := cache.NewVolumeCache(cacheDir)
+				h.AssertNil(t, err)
+				defer exportCache.Close()
+
+				h.AssertNil(t, exporter.Cache(layersDir, exportCache))
+
+				nextCache, err := cache.NewVolumeCache(cacheDir)
+				h.AssertNil(t, err)
+				defer nextCache.Close()
+				rc, err := nextCache.RetrieveLayer(sha)
+				h.AssertNil(t, err)
+				defer rc.Close()
+				h.AssertNil(t, layers.VerifyDigest(rc, sha))
+				h.AssertEq(t, exporter.CacheReport().CacheAdded, 1)
+			})
+		})
 	})
+
+	when("#VerifyCache", func() {
+		var (
+			cacheDir   string
+			logHandler *memory.Handler
+			logger     *log.Logger
+			goodSHA    string
+			corruptSHA string
+		)
+
+		it.Before(func() {
+			var err error
+			cacheDir, err = ioutil.TempDir("", "lifecycle.cache.verify")
+			h.AssertNil(t, err)
+			logHandler = memory.New()
+			logger = &log.Logger{Handler: logHandler}
+
+			volumeCache, err := cache.NewVolumeCache(cacheDir)
+			h.AssertNil(t, err)
+			goodSHA = addCacheLayer(t, volumeCache, "good data")
+			corruptSHA = addCacheLayer(t, volumeCache, "some data")
+			h.AssertNil(t, volumeCache.SetMetadata(platform.CacheMetadata{
+				Buildpacks: []platform.BuildpackLayersMetadata{{
+					ID: "buildpack.id",
+					Layers: map[string]platform.BuildpackLayerMetadata{
+						"good-layer":    {LayerMetadata: platform.LayerMetadata{SHA: goodSHA}},
+						"corrupt-layer": {LayerMetadata: platform.LayerMetadata{SHA: corruptSHA}},
+					},
+				}},
+			}))
+			h.AssertNil(t, volumeCache.Commit())
+
+			path, err := volumeCache.RetrieveLayerFile(corruptSHA)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ioutil.WriteFile(path, []byte("corrupt data"), 0666))
+		})
+
+		it.After(func() {
+			h.AssertNil(t, os.RemoveAll(cacheDir))
+		})
+
+		it("returns the layers that do not match their digest", func() {
+			testCache, err := cache.NewVolumeCache(cacheDir)
+			h.AssertNil(t, err)
+
+			failed, err := lifecycle.VerifyCache(testCache, logger)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, failed, []string{corruptSHA})
+			assertLogEntry(t, logHandler, "Layer 'buildpack.id:corrupt-layer' is corrupt")
+			assertLogEntry(t, logHandler, "Verified layer 'buildpack.id:good-layer'")
+		})
+
+		it("fails when the metadata is corrupt", func() {
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(cacheDir, "committed", "io.buildpacks.lifecycle.cache.metadata"), []byte("garbage"), 0666))
+			testCache, err := cache.NewVolumeCache(cacheDir)
+			h.AssertNil(t, err)
+
+			_, err = lifecycle.VerifyCache(testCache, logger)
+			h.AssertError(t, err, "cache metadata is corrupt")
+		})
+	})
+}
+
+func addCacheLayer(t *testing.T, testCache *cache.VolumeCache, contents string) string {
+	t.Helper()
+
+	sha := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(contents)))
+	h.AssertNil(t, testCache.AddLayer(ioutil.NopCloser(strings.NewReader(contents)), sha))
+	return sha
 }
 
 func assertCacheHasLayer(t *testing.T, cache lifecycle.Cache, id string) {
@@ -52,6 +52,10 @@ func Run(c Command, asSubcommand bool) {
 	if err := SetLogLevel(logLevel); err != nil {
 		Exit(err)
 	}
+	ignoreEnvsOfSetFlags()
+	if err := EnvError(); err != nil {
+		Exit(FailErrCode(err, CodeInvalidArgs, "parse environment"))
+	}
 	if err := c.Args(flagSet.NArg(), flagSet.Args()); err != nil {
 		Exit(err)
 	}
@@ -5,22 +5,29 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/buildpacks/lifecycle/api"
 )
 
 var (
-	DefaultAppDir          = filepath.Join(rootDir, "workspace")
-	DefaultBuildpacksDir   = filepath.Join(rootDir, "cnb", "buildpacks")
-	DefaultDeprecationMode = DeprecationModeWarn
-	DefaultLauncherPath    = filepath.Join(rootDir, "cnb", "lifecycle", "launcher"+execExt)
-	DefaultLayersDir       = filepath.Join(rootDir, "layers")
-	DefaultLogLevel        = "info"
-	DefaultPlatformAPI     = "0.3"
-	DefaultPlatformDir     = filepath.Join(rootDir, "platform")
-	DefaultProcessType     = "web"
-	DefaultStackPath       = filepath.Join(rootDir, "cnb", "stack.toml")
+	DefaultAppDir               = filepath.Join(rootDir, "workspace")
+	DefaultBuildpacksDir        = filepath.Join(rootDir, "cnb", "buildpacks")
+	DefaultCacheLockTimeout     = time.Minute
+	DefaultDeprecationMode      = DeprecationModeWarn
+	DefaultLauncherPath         = filepath.Join(rootDir, "cnb", "lifecycle", "launcher"+execExt)
+	DefaultLayersDir            = filepath.Join(rootDir, "layers")
+	DefaultLogLevel             = "info"
+	DefaultPlatformAPI          = "0.3"
+	DefaultPlatformDir          = filepath.Join(rootDir, "platform")
+	DefaultProcessType          = "web"
+	DefaultRegistryRetries      = 3
+	DefaultRegistryRetryBackoff = time.Second
+	DefaultRestoreWorkers       = 4
+	DefaultRunImageDigestPolicy = RunImageDigestPolicyWarn
+	DefaultStackPath            = filepath.Join(rootDir, "cnb", "stack.toml")
 
 	DefaultAnalyzedFile        = "analyzed.toml"
 	DefaultGroupFile           = "group.toml"
@@ -38,36 +45,70 @@ var (
 )
 
 const (
-	EnvAnalyzedPath        = "CNB_ANALYZED_PATH"
-	EnvAppDir              = "CNB_APP_DIR"
-	EnvBuildpacksDir       = "CNB_BUILDPACKS_DIR"
-	EnvCacheDir            = "CNB_CACHE_DIR"
-	EnvCacheImage          = "CNB_CACHE_IMAGE"
-	EnvDeprecationMode     = "CNB_DEPRECATION_MODE"
-	EnvGID                 = "CNB_GROUP_ID"
-	EnvGroupPath           = "CNB_GROUP_PATH"
-	EnvLaunchCacheDir      = "CNB_LAUNCH_CACHE_DIR"
-	EnvLayersDir           = "CNB_LAYERS_DIR"
-	EnvLogLevel            = "CNB_LOG_LEVEL"
-	EnvNoColor             = "CNB_NO_COLOR" // defaults to false
-	EnvOrderPath           = "CNB_ORDER_PATH"
-	EnvPlanPath            = "CNB_PLAN_PATH"
-	EnvPlatformAPI         = "CNB_PLATFORM_API"
-	EnvPlatformDir         = "CNB_PLATFORM_DIR"
-	EnvPreviousImage       = "CNB_PREVIOUS_IMAGE"
-	EnvProcessType         = "CNB_PROCESS_TYPE"
-	EnvProjectMetadataPath = "CNB_PROJECT_METADATA_PATH"
-	EnvReportPath          = "CNB_REPORT_PATH"
-	EnvRunImage            = "CNB_RUN_IMAGE"
-	EnvSkipLayers          = "CNB_ANALYZE_SKIP_LAYERS" // defaults to false
-	EnvSkipRestore         = "CNB_SKIP_RESTORE"        // defaults to false
-	EnvStackPath           = "CNB_STACK_PATH"
-	EnvUID                 = "CNB_USER_ID"
-	EnvUseDaemon           = "CNB_USE_DAEMON" // defaults to false
+	EnvAnalyzedPath               = "CNB_ANALYZED_PATH"
+	EnvAppDir                     = "CNB_APP_DIR"
+	EnvBuildDebug                 = "CNB_BUILD_DEBUG"        // defaults to false
+	EnvBuildDebugRedact           = "CNB_BUILD_DEBUG_REDACT" // comma separated patterns of env var names to redact
+	EnvBuildpacksDir              = "CNB_BUILDPACKS_DIR"
+	EnvCacheDir                   = "CNB_CACHE_DIR"
+	EnvCacheImage                 = "CNB_CACHE_IMAGE"
+	EnvCacheURL                   = "CNB_CACHE_URL"          // e.g. s3://<bucket>/<prefix>
+	EnvCacheLockTimeout           = "CNB_CACHE_LOCK_TIMEOUT" // 0 fails immediately, negative waits indefinitely
+	EnvDebugOnFailure             = "CNB_DEBUG_ON_FAILURE"   // defaults to false
+	EnvDeprecationMode            = "CNB_DEPRECATION_MODE"
+	EnvDryRun                     = "CNB_ANALYZE_DRY_RUN" // defaults to false
+	EnvExplainPath                = "CNB_ANALYZE_EXPLAIN_PATH"
+	EnvGID                        = "CNB_GROUP_ID"
+	EnvGroupPath                  = "CNB_GROUP_PATH"
+	EnvLaunchCacheDir             = "CNB_LAUNCH_CACHE_DIR"
+	EnvLauncherExecDConcurrent    = "CNB_LAUNCHER_EXEC_D_CONCURRENT"      // defaults to false
+	EnvLauncherExecDMaxOutputSize = "CNB_LAUNCHER_EXEC_D_MAX_OUTPUT_SIZE" // in bytes, 0 is unlimited
+	EnvLauncherExecDTimeout       = "CNB_LAUNCHER_EXEC_D_TIMEOUT"
+	EnvLauncherExitPolicy         = "CNB_LAUNCHER_EXIT_POLICY" // defaults to any
+	EnvLauncherGracePeriod        = "CNB_LAUNCHER_GRACE_PERIOD"
+	EnvLauncherMaxRestarts        = "CNB_LAUNCHER_MAX_RESTARTS" // defaults to 0, unlimited
+	EnvLauncherProcesses          = "CNB_LAUNCHER_PROCESSES"    // comma separated process types to launch together
+	EnvLauncherRestart            = "CNB_LAUNCHER_RESTART"      // defaults to false
+	EnvLauncherRestartBackoff     = "CNB_LAUNCHER_RESTART_BACKOFF"
+	EnvLauncherSupervise          = "CNB_LAUNCHER_SUPERVISE" // defaults to false
+	EnvLayersDir                  = "CNB_LAYERS_DIR"
+	EnvLogLevel                   = "CNB_LOG_LEVEL"
+	EnvNoColor                    = "CNB_NO_COLOR" // defaults to false
+	EnvOrderPath                  = "CNB_ORDER_PATH"
+	EnvPlanPath                   = "CNB_PLAN_PATH"
+	EnvPlatformAPI                = "CNB_PLATFORM_API"
+	EnvPlatformDir                = "CNB_PLATFORM_DIR"
+	EnvPreviousImage              = "CNB_PREVIOUS_IMAGE"
+	EnvProcessType                = "CNB_PROCESS_TYPE"
+	EnvProjectMetadataPath        = "CNB_PROJECT_METADATA_PATH"
+	EnvRegistryRetries            = "CNB_REGISTRY_RETRIES"
+	EnvRegistryRetryBackoff       = "CNB_REGISTRY_RETRY_BACKOFF"
+	EnvReportPath                 = "CNB_REPORT_PATH"
+	EnvRestoreWorkers             = "CNB_RESTORE_WORKERS" // 0 is unlimited
+	EnvRunImage                   = "CNB_RUN_IMAGE"
+	EnvRunImageDigest             = "CNB_RUN_IMAGE_DIGEST"
+	EnvRunImageDigestPolicy       = "CNB_RUN_IMAGE_DIGEST_POLICY"
+	EnvRunImageMirrors            = "CNB_RUN_IMAGE_MIRRORS"
+	EnvSkipLayers                 = "CNB_ANALYZE_SKIP_LAYERS" // defaults to false
+	EnvSkipRestore                = "CNB_SKIP_RESTORE"        // defaults to false
+	EnvStackPath                  = "CNB_STACK_PATH"
+	EnvStrictValidation           = "CNB_STRICT_VALIDATION" // defaults to false
+	EnvUID                        = "CNB_USER_ID"
+	EnvUseDaemon                  = "CNB_USE_DAEMON" // defaults to false
+)
+
+const (
+	RunImageDigestPolicyWarn = "warn" // warn and use the pinned run image when the run image tag has moved
+	RunImageDigestPolicyFail = "fail" // fail when the run image tag has moved
 )
 
 var flagSet = flag.NewFlagSet("lifecycle", flag.ExitOnError)
 
+var (
+	flagEnvs    = map[string]string{} // flag name -> environment variable providing its default
+	invalidEnvs = map[string]error{}  // environment variable -> error parsing its value
+)
+
 func FlagAnalyzedPath(analyzedPath *string) {
 	flagSet.StringVar(analyzedPath, "analyzed", EnvOrDefault(EnvAnalyzedPath, PlaceholderAnalyzedPath), "path to analyzed.toml")
 }
@@ -80,6 +121,14 @@ func FlagAppDir(appDir *string) {
 	flagSet.StringVar(appDir, "app", EnvOrDefault(EnvAppDir, DefaultAppDir), "path to app directory")
 }
 
+func FlagBuildDebug(debug *bool) {
+	flagSet.BoolVar(debug, "build-debug", BoolEnv(EnvBuildDebug), "write a snapshot of each buildpack's build invocation to <layers>/.debug/build/<index>-<buildpack ID>.toml")
+}
+
+func FlagBuildDebugRedact(patterns *string) {
+	flagSet.StringVar(patterns, "build-debug-redact", os.Getenv(EnvBuildDebugRedact), "comma separated patterns of environment variable names to redact from build snapshots, in addition to the defaults")
+}
+
 func FlagBuildpacksDir(buildpacksDir *string) {
 	flagSet.StringVar(buildpacksDir, "buildpacks", EnvOrDefault(EnvBuildpacksDir, DefaultBuildpacksDir), "path to buildpacks directory")
 }
@@ -88,10 +137,31 @@ func FlagCacheDir(cacheDir *string) {
 	flagSet.StringVar(cacheDir, "cache-dir", os.Getenv(EnvCacheDir), "path to cache directory")
 }
 
+func FlagCacheURL(cacheURL *string) {
+	flagSet.StringVar(cacheURL, "cache-url", os.Getenv(EnvCacheURL), "URL of an object store cache, e.g. s3://<bucket>/<prefix>")
+}
+
+func FlagCacheLockTimeout(timeout *time.Duration) {
+	flagSet.DurationVar(timeout, "cache-lock-timeout", DurationEnvOrDefault(EnvCacheLockTimeout, DefaultCacheLockTimeout), "how long to wait for other lifecycles to release the cache directory lock, 0 fails immediately and a negative duration waits indefinitely")
+	flagEnvs["cache-lock-timeout"] = EnvCacheLockTimeout
+}
+
 func FlagCacheImage(cacheImage *string) {
 	flagSet.StringVar(cacheImage, "cache-image", os.Getenv(EnvCacheImage), "cache image tag name")
 }
 
+func FlagDebugOnFailure(debug *bool) {
+	flagSet.BoolVar(debug, "debug-on-failure", BoolEnv(EnvDebugOnFailure), "run an interactive shell when a buildpack fails detection or build")
+}
+
+func FlagDryRun(dryRun *bool) {
+	flagSet.BoolVar(dryRun, "dry-run", BoolEnv(EnvDryRun), "print what would be restored for each layer, and why, without modifying the layers directory")
+}
+
+func FlagExplainPath(explainPath *string) {
+	flagSet.StringVar(explainPath, "explain", os.Getenv(EnvExplainPath), "path to write what would be restored for each layer as JSON, implies -dry-run")
+}
+
 func FlagGID(gid *int) {
 	flagSet.IntVar(gid, "gid", intEnv(EnvGID), "GID of user's group in the stack's build and run images")
 }
@@ -156,6 +226,16 @@ func FlagPreviousImage(image *string) {
 	flagSet.StringVar(image, "previous-image", os.Getenv(EnvPreviousImage), "reference to previous image")
 }
 
+func FlagRegistryRetries(retries *int) {
+	flagSet.IntVar(retries, "registry-retries", IntEnvOrDefault(EnvRegistryRetries, DefaultRegistryRetries), "number of times to retry registry operations that fail with transient errors")
+	flagEnvs["registry-retries"] = EnvRegistryRetries
+}
+
+func FlagRegistryRetryBackoff(backoff *time.Duration) {
+	flagSet.DurationVar(backoff, "registry-retry-backoff", DurationEnvOrDefault(EnvRegistryRetryBackoff, DefaultRegistryRetryBackoff), "delay before the first retry of a registry operation, doubled for each subsequent retry")
+	flagEnvs["registry-retry-backoff"] = EnvRegistryRetryBackoff
+}
+
 func FlagReportPath(reportPath *string) {
 	flagSet.StringVar(reportPath, "report", EnvOrDefault(EnvReportPath, PlaceholderReportPath), "path to report.toml")
 }
@@ -164,10 +244,27 @@ func DefaultReportPath(platformAPI, layersDir string) string {
 	return defaultPath(DefaultReportFile, platformAPI, layersDir)
 }
 
+func FlagRestoreWorkers(workers *int) {
+	flagSet.IntVar(workers, "restore-workers", IntEnvOrDefault(EnvRestoreWorkers, DefaultRestoreWorkers), "maximum number of cached layers to restore concurrently, 0 is unlimited")
+	flagEnvs["restore-workers"] = EnvRestoreWorkers
+}
+
 func FlagRunImage(runImage *string) {
 	flagSet.StringVar(runImage, "run-image", os.Getenv(EnvRunImage), "reference to run image")
 }
 
+func FlagRunImageDigest(digest *string) {
+	flagSet.StringVar(digest, "run-image-digest", os.Getenv(EnvRunImageDigest), "expected digest of the run image")
+}
+
+func FlagRunImageDigestPolicy(policy *string) {
+	flagSet.StringVar(policy, "run-image-digest-policy", EnvOrDefault(EnvRunImageDigestPolicy, DefaultRunImageDigestPolicy), "action when the run image no longer matches the pinned digest (warn or fail)")
+}
+
+func FlagRunImageMirrors(mirrors *string) {
+	flagSet.StringVar(mirrors, "run-image-mirrors", os.Getenv(EnvRunImageMirrors), "comma separated list of preferred run image mirrors or registries")
+}
+
 func FlagSkipLayers(skip *bool) {
 	flagSet.BoolVar(skip, "skip-layers", BoolEnv(EnvSkipLayers), "do not provide layer metadata to buildpacks")
 }
@@ -180,6 +277,10 @@ func FlagStackPath(stackPath *string) {
 	flagSet.StringVar(stackPath, "stack", EnvOrDefault(EnvStackPath, DefaultStackPath), "path to stack.toml")
 }
 
+func FlagStrictValidation(strict *bool) {
+	flagSet.BoolVar(strict, "strict-validation", BoolEnv(EnvStrictValidation), "fail when validation finds problems with the processes or launch environment, reading the run image layers to look for commands")
+}
+
 func FlagTags(tags *StringSlice) {
 	flagSet.Var(tags, "tag", "additional tags")
 }
@@ -236,6 +337,56 @@ func intEnv(k string) int {
 	return d
 }
 
+// IntEnvOrDefault returns the value of the environment variable k, or defaultVal when it is not set.
+// A value that is not an integer is reported by EnvError.
+func IntEnvOrDefault(k string, defaultVal int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return defaultVal
+	}
+	d, err := strconv.Atoi(v)
+	if err != nil {
+		invalidEnvs[k] = fmt.Errorf("invalid value '%s' for %s, expected an integer", v, k)
+		return defaultVal
+	}
+	return d
+}
+
+// DurationEnvOrDefault returns the value of the environment variable k, or defaultVal when it is not set.
+// A value that is not a duration is reported by EnvError.
+func DurationEnvOrDefault(k string, defaultVal time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		return defaultVal
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		invalidEnvs[k] = fmt.Errorf("invalid value '%s' for %s, expected a duration such as '30s'", v, k)
+		return defaultVal
+	}
+	return d
+}
+
+// EnvError returns an error for the first environment variable, by name, read with an invalid value
+func EnvError() error {
+	var keys []string
+	for k := range invalidEnvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return nil
+	}
+	return invalidEnvs[keys[0]]
+}
+
+// ignoreEnvsOfSetFlags forgets invalid environment variables whose values are replaced by flags
+func ignoreEnvsOfSetFlags() {
+	flagSet.Visit(func(f *flag.Flag) {
+		delete(invalidEnvs, flagEnvs[f.Name])
+	})
+}
+
 func BoolEnv(k string) bool {
 	v := os.Getenv(k)
 	b, err := strconv.ParseBool(v)
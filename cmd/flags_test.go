@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestFlags(t *testing.T) {
+	spec.Run(t, "Flags", testFlags, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testFlags(t *testing.T, when spec.G, it spec.S) {
+	it.After(func() {
+		invalidEnvs = map[string]error{}
+	})
+
+	when("IntEnvOrDefault", func() {
+		it.After(func() {
+			os.Unsetenv("CNB_TEST_INT")
+		})
+
+		it("returns the default when the variable is not set", func() {
+			h.AssertEq(t, IntEnvOrDefault("CNB_TEST_INT", 4), 4)
+		})
+
+		it("returns the value when it is an integer", func() {
+			h.AssertNil(t, os.Setenv("CNB_TEST_INT", "0"))
+			h.AssertEq(t, IntEnvOrDefault("CNB_TEST_INT", 4), 0)
+		})
+	})
+
+	when("DurationEnvOrDefault", func() {
+		it.After(func() {
+			os.Unsetenv("CNB_TEST_DURATION")
+		})
+
+		it("returns the default when the variable is not set", func() {
+			h.AssertEq(t, DurationEnvOrDefault("CNB_TEST_DURATION", time.Second), time.Second)
+		})
+
+		it("returns the value when it is a duration", func() {
+			h.AssertNil(t, os.Setenv("CNB_TEST_DURATION", "5m"))
+			h.AssertEq(t, DurationEnvOrDefault("CNB_TEST_DURATION", time.Second), 5*time.Minute)
+		})
+	})
+
+	when("EnvError", func() {
+		it.After(func() {
+			os.Unsetenv("CNB_TEST_BAD_INT")
+			os.Unsetenv("CNB_TEST_BAD_DURATION")
+		})
+
+		it("reports values that cannot be parsed", func() {
+			h.AssertNil(t, EnvError())
+			h.AssertNil(t, os.Setenv("CNB_TEST_BAD_INT", "abc"))
+			h.AssertNil(t, os.Setenv("CNB_TEST_BAD_DURATION", "abc"))
+
+			h.AssertEq(t, DurationEnvOrDefault("CNB_TEST_BAD_DURATION", time.Second), time.Second)
+			h.AssertEq(t, IntEnvOrDefault("CNB_TEST_BAD_INT", 4), 4)
+
+			h.AssertError(t, EnvError(), "invalid value 'abc' for CNB_TEST_BAD_DURATION, expected a duration such as '30s'")
+		})
+	})
+}
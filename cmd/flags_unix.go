@@ -2,6 +2,8 @@
 
 package cmd
 
+const DefaultDebugShell = "/bin/sh"
+
 const (
 	rootDir = "/"
 	execExt = ""
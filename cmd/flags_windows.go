@@ -1,5 +1,7 @@
 package cmd
 
+const DefaultDebugShell = "cmd.exe"
+
 const (
 	rootDir = `c:\`
 	execExt = ".exe"
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/launch"
+)
+
+const (
+	describeFlag = "--describe"
+	jsonFlag     = "--json"
+)
+
+// describe prints the processes, the default process and the environment computed for each process type.
+// Output from exec.d binaries and profile scripts is written to stderr so that stdout can be parsed.
+func describe(launcher *launch.Launcher, args []string) error {
+	jsonOutput := false
+	for _, arg := range args {
+		if arg != jsonFlag {
+			return cmd.FailErrCode(fmt.Errorf("unknown argument '%s'", arg), cmd.CodeInvalidArgs, "parse arguments")
+		}
+		jsonOutput = true
+	}
+	runner := newExecDRunner()
+	runner.Out = os.Stderr
+	launcher.ExecD = runner
+
+	desc, err := launcher.Describe()
+	if err != nil {
+		return cmd.FailErr(err, "describe processes")
+	}
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(desc); err != nil {
+			return cmd.FailErr(err, "write description")
+		}
+		return nil
+	}
+	writeDescription(os.Stdout, desc)
+	return nil
+}
+
+func writeDescription(w io.Writer, desc launch.Description) {
+	fmt.Fprintln(w, "Processes:")
+	if len(desc.Processes) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	for _, proc := range desc.Processes {
+		var notes []string
+		if proc.Type == desc.DefaultProcess {
+			notes = append(notes, "default")
+		}
+		if proc.Direct {
+			notes = append(notes, "direct")
+		}
+		if proc.BuildpackID != "" {
+			notes = append(notes, "from "+proc.BuildpackID)
+		}
+		fmt.Fprintf(w, "  %s: %s", proc.Type, strings.Join(append([]string{proc.Command}, proc.Args...), " "))
+		if len(notes) > 0 {
+			fmt.Fprintf(w, " (%s)", strings.Join(notes, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	if desc.DefaultProcess == "" {
+		fmt.Fprintln(w, "Default process: (none)")
+	} else {
+		fmt.Fprintf(w, "Default process: %s\n", desc.DefaultProcess)
+	}
+
+	for _, proc := range desc.Processes {
+		fmt.Fprintf(w, "\nEnvironment for process type '%s':\n", proc.Type)
+		for _, v := range proc.Env {
+			fmt.Fprintf(w, "  %s=%s\n", v.Name, v.Value)
+			for _, src := range v.Sources {
+				fmt.Fprintf(w, "    set by %s\n", describeSource(src))
+			}
+		}
+	}
+}
+
+func describeSource(src launch.EnvSource) string {
+	var parts []string
+	if src.Buildpack != "" {
+		parts = append(parts, fmt.Sprintf("buildpack '%s' layer '%s'", src.Buildpack, src.Layer))
+	} else if src.Type == launch.EnvSourceProfile {
+		parts = append(parts, "app")
+	}
+	parts = append(parts, src.Type)
+	if src.Path != "" {
+		parts = append(parts, fmt.Sprintf("'%s'", src.Path))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/launch"
+)
+
+const waitFlag = "--wait"
+
+// healthCheck runs the health check declared by a process type, defaulting to the default process type.
+// It exits with status 0 when the process is healthy and 1 when it is not, as expected of a Docker HEALTHCHECK.
+// With --wait the check is retried until it succeeds or the duration elapses, so it can be used as a readiness probe.
+func healthCheck(launcher *launch.Launcher, args []string) error {
+	var (
+		processType = launcher.DefaultProcessType
+		wait        time.Duration
+	)
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == waitFlag && i+1 < len(args):
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil {
+				return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse wait duration")
+			}
+			wait = d
+			i++
+		case args[i] != waitFlag && i == 0:
+			processType = args[i]
+		default:
+			return cmd.FailErrCode(fmt.Errorf("unknown argument '%s'", args[i]), cmd.CodeInvalidArgs, "parse arguments")
+		}
+	}
+	if processType == "" {
+		return cmd.FailErrCode(errors.New("no process type given and there is no default process type"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	proc, ok := launch.Metadata{Processes: launcher.Processes}.FindProcessType(processType)
+	if !ok {
+		return cmd.FailErrCode(fmt.Errorf("process type '%s' was not found", processType), cmd.CodeInvalidArgs, "parse arguments")
+	}
+
+	var err error
+	if wait > 0 {
+		err = launcher.WaitHealthy(proc, wait)
+	} else {
+		err = launcher.CheckHealth(proc)
+	}
+	if err != nil {
+		cmd.DefaultLogger.Errorf("Process type '%s' is unhealthy: %s", processType, err)
+		return &launch.ExitError{Code: 1}
+	}
+	cmd.DefaultLogger.Debugf("Process type '%s' is healthy", processType)
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/heroku/color"
+	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/cmd"
@@ -16,7 +17,12 @@ import (
 )
 
 func main() {
-	cmd.Exit(runLaunch())
+	err := runLaunch()
+	if exitErr, ok := err.(*launch.ExitError); ok {
+		// the supervised process has already reported its own failure
+		os.Exit(exitErr.Code)
+	}
+	cmd.Exit(err)
 }
 
 func runLaunch() error {
@@ -46,19 +52,102 @@ func runLaunch() error {
 		PlatformAPI:        api.MustParse(platform.API()),
 		Processes:          md.Processes,
 		Buildpacks:         md.Buildpacks,
-		Env:                env.NewLaunchEnv(os.Environ(), launch.ProcessDir, launch.LifecycleDir),
+		ConcurrentExecD:    cmd.BoolEnv(cmd.EnvLauncherExecDConcurrent),
+		Env:                newLaunchEnv(os.Environ()),
+		NewEnv:             newLaunchEnv,
 		Exec:               launch.OSExecFunc,
-		ExecD:              launch.NewExecDRunner(),
+		ExecD:              newExecDRunner(),
 		Shell:              launch.DefaultShell,
 		Setenv:             os.Setenv,
 	}
+	if err := verifyEnv(); err != nil {
+		return err
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == describeFlag {
+		return describe(launcher, os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == launch.HealthCheckFlag {
+		return healthCheck(launcher, os.Args[2:])
+	}
+	if processTypes := os.Getenv(cmd.EnvLauncherProcesses); processTypes != "" {
+		return launchProcesses(launcher, strings.Split(processTypes, ","), platform)
+	}
+	if cmd.BoolEnv(cmd.EnvLauncherSupervise) {
+		supervisor := newSupervisor()
+		if err := verifyEnv(); err != nil {
+			return err
+		}
+		launcher.Exec = supervisor.Exec
+		launcher.Shell = launch.NewShell(supervisor.Exec)
+	}
 
 	if err := launcher.Launch(os.Args[0], os.Args[1:]); err != nil {
+		var exitErr *launch.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr
+		}
+		return cmd.FailErrCode(err, platform.CodeFor(cmd.LaunchError), "launch")
+	}
+	return nil
+}
+
+func launchProcesses(launcher *launch.Launcher, processTypes []string, platform lplatform.Platform) error {
+	if len(os.Args) > 1 {
+		return cmd.FailErrCode(
+			errors.New("arguments are not supported when launching multiple process types"),
+			cmd.CodeInvalidArgs,
+			"parse arguments",
+		)
+	}
+	policy, err := launch.ParseExitPolicy(cmd.EnvOrDefault(cmd.EnvLauncherExitPolicy, string(launch.ExitPolicyAny)))
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse exit policy")
+	}
+	group := launch.NewProcessGroup(policy, cmd.DefaultLogger)
+	group.GracePeriod = cmd.DurationEnvOrDefault(cmd.EnvLauncherGracePeriod, group.GracePeriod)
+	if err := verifyEnv(); err != nil {
+		return err
+	}
+
+	if err := launcher.LaunchProcesses(os.Args[0], processTypes, group); err != nil {
+		var exitErr *launch.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr
+		}
 		return cmd.FailErrCode(err, platform.CodeFor(cmd.LaunchError), "launch")
 	}
 	return nil
 }
 
+// verifyEnv fails when an environment variable read so far has an invalid value
+func verifyEnv() error {
+	if err := cmd.EnvError(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse environment")
+	}
+	return nil
+}
+
+func newLaunchEnv(environ []string) launch.Env {
+	return env.NewLaunchEnv(environ, launch.ProcessDir, launch.LifecycleDir)
+}
+
+func newExecDRunner() *launch.ExecDRunner {
+	runner := launch.NewExecDRunner()
+	runner.Timeout = cmd.DurationEnvOrDefault(cmd.EnvLauncherExecDTimeout, runner.Timeout)
+	runner.MaxOutputSize = int64(cmd.IntEnvOrDefault(cmd.EnvLauncherExecDMaxOutputSize, int(runner.MaxOutputSize)))
+	return runner
+}
+
+func newSupervisor() *launch.Supervisor {
+	supervisor := launch.NewSupervisor(cmd.DefaultLogger)
+	supervisor.GracePeriod = cmd.DurationEnvOrDefault(cmd.EnvLauncherGracePeriod, supervisor.GracePeriod)
+	supervisor.Restart = cmd.BoolEnv(cmd.EnvLauncherRestart)
+	supervisor.MaxRestarts = cmd.IntEnvOrDefault(cmd.EnvLauncherMaxRestarts, 0)
+	supervisor.RestartBackoff = cmd.DurationEnvOrDefault(cmd.EnvLauncherRestartBackoff, supervisor.RestartBackoff)
+	return supervisor
+}
+
 func defaultProcessType(platformAPI *api.Version, launchMD launch.Metadata) string {
 	if platformAPI.Compare(api.MustParse("0.4")) < 0 {
 		return cmd.EnvOrDefault(cmd.EnvProcessType, cmd.DefaultProcessType)
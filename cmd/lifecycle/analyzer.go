@@ -1,56 +1,90 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/buildpacks/imgutil"
 	"github.com/buildpacks/imgutil/local"
 	"github.com/buildpacks/imgutil/remote"
 	"github.com/docker/docker/client"
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/auth"
 	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/platform"
 	"github.com/buildpacks/lifecycle/priv"
 )
 
 type analyzeCmd struct {
 	//flags: inputs
-	cacheDir      string
-	cacheImageTag string
-	groupPath     string
-	uid, gid      int
+	cacheDir         string
+	cacheImageTag    string
+	cacheURL         string
+	cacheLockTimeout time.Duration
+	dryRun           bool
+	groupPath        string
+	platformDir      string
+	runImageMirrors  string
+	stackPath        string
+	uid, gid         int
 	analyzeArgs
 
+	registryRetries      int
+	registryRetryBackoff time.Duration
+
 	//flags: paths to write data
 	analyzedPath string
+	explainPath  string
 }
 
 type analyzeArgs struct {
 	//inputs needed when run by creator
-	imageName  string
-	layersDir  string
-	skipLayers bool
-	useDaemon  bool
+	imageName        string
+	layersDir        string
+	preferredMirrors []string
+	registry         string
+	retry            lifecycle.Retry
+	runImageRef      string
+	skipLayers       bool
+	stackMD          platform.StackMetadata
+	useDaemon        bool
 
 	platform cmd.Platform
 
 	//construct if necessary before dropping privileges
-	docker   client.CommonAPIClient
-	keychain authn.Keychain
+	docker        client.CommonAPIClient
+	keychain      authn.Keychain
+	cacheKeychain authn.Keychain
 }
 
 func (a *analyzeCmd) DefineFlags() {
 	cmd.FlagAnalyzedPath(&a.analyzedPath)
 	cmd.FlagCacheDir(&a.cacheDir)
 	cmd.FlagCacheImage(&a.cacheImageTag)
+	cmd.FlagCacheURL(&a.cacheURL)
+	cmd.FlagCacheLockTimeout(&a.cacheLockTimeout)
+	cmd.FlagDryRun(&a.dryRun)
+	cmd.FlagExplainPath(&a.explainPath)
 	cmd.FlagGroupPath(&a.groupPath)
 	cmd.FlagLayersDir(&a.layersDir)
+	cmd.FlagPlatformDir(&a.platformDir)
+	cmd.FlagRegistryRetries(&a.registryRetries)
+	cmd.FlagRegistryRetryBackoff(&a.registryRetryBackoff)
+	cmd.FlagRunImage(&a.runImageRef)
+	cmd.FlagRunImageMirrors(&a.runImageMirrors)
 	cmd.FlagSkipLayers(&a.skipLayers)
+	cmd.FlagStackPath(&a.stackPath)
 	cmd.FlagUseDaemon(&a.useDaemon)
 	cmd.FlagUID(&a.uid)
 	cmd.FlagGID(&a.gid)
@@ -63,9 +97,12 @@ func (a *analyzeCmd) Args(nargs int, args []string) error {
 	if args[0] == "" {
 		return cmd.FailErrCode(errors.New("image argument is required"), cmd.CodeInvalidArgs, "parse arguments")
 	}
-	if a.cacheImageTag == "" && a.cacheDir == "" {
+	if a.cacheImageTag == "" && a.cacheURL == "" && a.cacheDir == "" {
 		cmd.DefaultLogger.Warn("Not restoring cached layer metadata, no cache flag specified.")
 	}
+	if a.explainPath != "" {
+		a.dryRun = true
+	}
 
 	if a.analyzedPath == cmd.PlaceholderAnalyzedPath {
 		a.analyzedPath = cmd.DefaultAnalyzedPath(a.platform.API(), a.layersDir)
@@ -76,15 +113,30 @@ func (a *analyzeCmd) Args(nargs int, args []string) error {
 	}
 
 	a.imageName = args[0]
+	ref, err := name.ParseReference(a.imageName, name.WeakValidation)
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse image name")
+	}
+	a.registry = ref.Context().RegistryStr()
+	a.preferredMirrors = splitList(a.runImageMirrors)
+	a.retry = registryRetry(a.registryRetries, a.registryRetryBackoff)
+
+	if _, err := toml.DecodeFile(a.stackPath, &a.stackMD); err != nil {
+		cmd.DefaultLogger.Debugf("no stack metadata found at path '%s', run image will not be selected", a.stackPath)
+	}
 	return nil
 }
 
 func (a *analyzeCmd) Privileges() error {
 	var err error
-	a.keychain, err = auth.DefaultKeychain(a.registryImages()...)
+	a.keychain, err = auth.PlatformKeychain(a.platformDir, "analyzer", cmd.DefaultLogger, a.registryImages()...)
 	if err != nil {
 		return cmd.FailErr(err, "resolve keychain")
 	}
+	a.cacheKeychain, err = auth.CacheKeychain(a.platformDir, cmd.DefaultLogger, a.keychain, a.cacheImageTag)
+	if err != nil {
+		return cmd.FailErr(err, "resolve cache keychain")
+	}
 
 	if a.useDaemon {
 		var err error
@@ -93,8 +145,11 @@ func (a *analyzeCmd) Privileges() error {
 			return cmd.FailErr(err, "initialize docker client")
 		}
 	}
-	if err := priv.EnsureOwner(a.uid, a.gid, a.layersDir, a.cacheDir); err != nil {
-		return cmd.FailErr(err, "chown volumes")
+	// a dry run only reads the volumes
+	if !a.dryRun {
+		if err := priv.EnsureOwner(a.uid, a.gid, a.layersDir, a.cacheDir); err != nil {
+			return cmd.FailErr(err, "chown volumes")
+		}
 	}
 	if err := priv.RunAs(a.uid, a.gid); err != nil {
 		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", a.uid, a.gid))
@@ -111,10 +166,20 @@ func (a *analyzeCmd) Exec() error {
 		return err
 	}
 
-	cacheStore, err := initCache(a.cacheImageTag, a.cacheDir, a.keychain)
+	var volumeOpts []cache.VolumeCacheOption
+	if a.dryRun {
+		// a dry run only reads the cache, and may run without ownership of the cache directory
+		volumeOpts = append(volumeOpts, cache.WithReadOnly())
+	}
+	cacheStore, err := initCache(a.cacheImageTag, a.cacheURL, a.cacheDir, a.cacheLockTimeout, a.cacheKeychain, a.retry, volumeOpts...)
 	if err != nil {
 		return cmd.FailErr(err, "initialize cache")
 	}
+	defer closeCache(cacheStore)
+
+	if a.dryRun {
+		return a.explain(group, cacheStore)
+	}
 
 	analyzedMD, err := a.analyze(group, cacheStore)
 	if err != nil {
@@ -128,7 +193,63 @@ func (a *analyzeCmd) Exec() error {
 	return nil
 }
 
+// explain prints what analyzing and restoring would do with each layer, and writes it as JSON to the explain path if provided
+func (a *analyzeCmd) explain(group buildpack.Group, cacheStore lifecycle.Cache) error {
+	img, err := a.previousImage()
+	if err != nil {
+		return err
+	}
+	explanation, err := (&lifecycle.Analyzer{
+		Buildpacks: group.Group,
+		LayersDir:  a.layersDir,
+		Logger:     cmd.DefaultLogger,
+		SkipLayers: a.skipLayers,
+	}).Explain(img, cacheStore)
+	if err != nil {
+		return cmd.FailErrCode(err, a.platform.CodeFor(cmd.AnalyzeError), "analyzer")
+	}
+
+	for _, layer := range explanation.Layers {
+		cmd.DefaultLogger.Infof("%s:%s: %s (%s)", layer.Buildpack, layer.Layer, layer.Decision, layer.Reason)
+	}
+	if a.explainPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(explanation, "", "  ")
+	if err != nil {
+		return cmd.FailErr(err, "encode explanation")
+	}
+	if err := ioutil.WriteFile(a.explainPath, data, 0644); err != nil {
+		return cmd.FailErr(err, "write explanation")
+	}
+	return nil
+}
+
 func (aa analyzeArgs) analyze(group buildpack.Group, cacheStore lifecycle.Cache) (platform.AnalyzedMetadata, error) {
+	img, err := aa.previousImage()
+	if err != nil {
+		return platform.AnalyzedMetadata{}, err
+	}
+
+	analyzedMD, err := (&lifecycle.Analyzer{
+		Buildpacks: group.Group,
+		LayersDir:  aa.layersDir,
+		Logger:     cmd.DefaultLogger,
+		SkipLayers: aa.skipLayers,
+	}).Analyze(img, cacheStore)
+	if err != nil {
+		return platform.AnalyzedMetadata{}, cmd.FailErrCode(err, aa.platform.CodeFor(cmd.AnalyzeError), "analyzer")
+	}
+
+	analyzedMD.RunImage, err = aa.selectRunImage()
+	if err != nil {
+		return platform.AnalyzedMetadata{}, cmd.FailErrCode(err, aa.platform.CodeFor(cmd.AnalyzeError), "select run image")
+	}
+	return analyzedMD, nil
+}
+
+// previousImage returns the image being analyzed, which is not found for a first build
+func (aa analyzeArgs) previousImage() (imgutil.Image, error) {
 	var (
 		img imgutil.Image
 		err error
@@ -140,26 +261,57 @@ func (aa analyzeArgs) analyze(group buildpack.Group, cacheStore lifecycle.Cache)
 			local.FromBaseImage(aa.imageName),
 		)
 	} else {
-		img, err = remote.NewImage(
-			aa.imageName,
-			aa.keychain,
-			remote.FromBaseImage(aa.imageName),
-		)
+		err = aa.retry.Do("reading previous image", func() error {
+			var err error
+			img, err = remote.NewImage(
+				aa.imageName,
+				aa.keychain,
+				remote.FromBaseImage(aa.imageName),
+			)
+			return err
+		})
 	}
 	if err != nil {
-		return platform.AnalyzedMetadata{}, cmd.FailErr(err, "get previous image")
+		return nil, cmd.FailErr(err, "get previous image")
 	}
+	return img, nil
+}
 
-	analyzedMD, err := (&lifecycle.Analyzer{
-		Buildpacks: group.Group,
-		LayersDir:  aa.layersDir,
-		Logger:     cmd.DefaultLogger,
-		SkipLayers: aa.skipLayers,
-	}).Analyze(img, cacheStore)
+// selectRunImage chooses the run image the exporter should use and pins it to its current digest.
+// Selection is skipped when exporting to a daemon or when there is no stack metadata.
+func (aa analyzeArgs) selectRunImage() (*platform.RunImage, error) {
+	if aa.runImageRef != "" {
+		runImage := &platform.RunImage{Reference: aa.runImageRef, Reason: "provided by platform"}
+		if !aa.useDaemon {
+			if err := aa.retry.Do("resolving run image", func() error {
+				var err error
+				runImage.Digest, err = image.ResolveDigest(aa.runImageRef, aa.keychain)
+				return err
+			}); err != nil {
+				return nil, err
+			}
+		}
+		return runImage, nil
+	}
+	if aa.useDaemon || aa.stackMD.RunImage.Image == "" {
+		return nil, nil
+	}
+	candidates, err := aa.stackMD.RunImageCandidates(aa.registry, aa.preferredMirrors)
 	if err != nil {
-		return platform.AnalyzedMetadata{}, cmd.FailErrCode(err, aa.platform.CodeFor(cmd.AnalyzeError), "analyzer")
+		return nil, err
 	}
-	return analyzedMD, nil
+	selector := &image.RunImageSelector{
+		Keychain: aa.keychain,
+		Logger:   cmd.DefaultLogger,
+		Retry:    aa.retry.Do,
+	}
+	runImage, err := selector.Select(candidates)
+	if err != nil {
+		return nil, err
+	}
+	cmd.DefaultLogger.Infof("Selected run image '%s' (%s)", runImage.Reference, runImage.Reason)
+	cmd.DefaultLogger.Debugf("Pinned run image to digest '%s'", runImage.Digest)
+	return &runImage, nil
 }
 
 func (a *analyzeCmd) registryImages() []string {
@@ -169,6 +321,28 @@ func (a *analyzeCmd) registryImages() []string {
 	}
 	if !a.useDaemon {
 		registryImages = append(registryImages, a.analyzeArgs.imageName)
+		registryImages = append(registryImages, runImageRefs(a.runImageRef, a.stackMD)...)
 	}
 	return registryImages
 }
+
+// runImageRefs returns the references that may be selected as the run image
+func runImageRefs(runImageRef string, stackMD platform.StackMetadata) []string {
+	if runImageRef != "" {
+		return []string{runImageRef}
+	}
+	if stackMD.RunImage.Image == "" {
+		return nil
+	}
+	return append([]string{stackMD.RunImage.Image}, stackMD.RunImage.Mirrors...)
+}
+
+func splitList(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"errors"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 
@@ -29,6 +32,9 @@ type buildArgs struct {
 	layersDir     string
 	appDir        string
 	platformDir   string
+	debug         bool
+	debugRedact   string
+	debugShell    bool
 
 	platform cmd.Platform
 }
@@ -40,6 +46,9 @@ func (b *buildCmd) DefineFlags() {
 	cmd.FlagLayersDir(&b.layersDir)
 	cmd.FlagAppDir(&b.appDir)
 	cmd.FlagPlatformDir(&b.platformDir)
+	cmd.FlagBuildDebug(&b.debug)
+	cmd.FlagBuildDebugRedact(&b.debugRedact)
+	cmd.FlagDebugOnFailure(&b.debugShell)
 }
 
 func (b *buildCmd) Args(nargs int, args []string) error {
@@ -82,6 +91,10 @@ func (ba buildArgs) build(group buildpack.Group, plan platform.BuildPlan) error
 	if err != nil {
 		return cmd.FailErrCode(err, ba.platform.CodeFor(cmd.BuildError), "build")
 	}
+	redactPatterns, err := parseRedactPatterns(ba.debugRedact)
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse build debug redact patterns")
+	}
 
 	builder := &lifecycle.Builder{
 		AppDir:         ba.appDir,
@@ -95,6 +108,12 @@ func (ba buildArgs) build(group buildpack.Group, plan platform.BuildPlan) error
 		Err:            cmd.Stderr,
 		Logger:         cmd.DefaultLogger,
 		BuildpackStore: buildpackStore,
+		RedactPatterns: redactPatterns,
+		DebugShell:     debugShell(ba.debugShell),
+	}
+	if ba.debug {
+		// the dot keeps the dir apart from the layers dirs of buildpacks, which are named after their escaped IDs
+		builder.DebugDir = filepath.Join(ba.layersDir, ".debug", "build")
 	}
 	md, err := builder.Build()
 
@@ -113,6 +132,22 @@ func (ba buildArgs) build(group buildpack.Group, plan platform.BuildPlan) error
 	return nil
 }
 
+// parseRedactPatterns returns the default redact patterns with the given comma separated patterns appended
+func parseRedactPatterns(patterns string) ([]*regexp.Regexp, error) {
+	out := append([]*regexp.Regexp{}, buildpack.DefaultRedactPatterns...)
+	for _, p := range strings.Split(patterns, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
 func (b *buildCmd) readData() (buildpack.Group, platform.BuildPlan, error) {
 	group, err := lifecycle.ReadGroup(b.groupPath)
 	if err != nil {
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/auth"
+	"github.com/buildpacks/lifecycle/cache"
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/priv"
+)
+
+// cacheVerifyCmd checks that each layer in a cache matches its digest, without restoring it
+type cacheVerifyCmd struct {
+	// flags: inputs
+	cacheDir             string
+	cacheImageTag        string
+	cacheURL             string
+	cacheLockTimeout     time.Duration
+	platformDir          string
+	registryRetries      int
+	registryRetryBackoff time.Duration
+	uid, gid             int
+
+	//set before dropping privileges
+	keychain      authn.Keychain
+	cacheKeychain authn.Keychain
+}
+
+func (v *cacheVerifyCmd) DefineFlags() {
+	cmd.FlagCacheDir(&v.cacheDir)
+	cmd.FlagCacheImage(&v.cacheImageTag)
+	cmd.FlagCacheURL(&v.cacheURL)
+	cmd.FlagCacheLockTimeout(&v.cacheLockTimeout)
+	cmd.FlagPlatformDir(&v.platformDir)
+	cmd.FlagRegistryRetries(&v.registryRetries)
+	cmd.FlagRegistryRetryBackoff(&v.registryRetryBackoff)
+	cmd.FlagUID(&v.uid)
+	cmd.FlagGID(&v.gid)
+}
+
+func (v *cacheVerifyCmd) Args(nargs int, args []string) error {
+	if nargs > 0 {
+		return cmd.FailErrCode(errors.New("received unexpected Args"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	if v.cacheImageTag == "" && v.cacheURL == "" && v.cacheDir == "" {
+		return cmd.FailErrCode(errors.New("a cache directory or cache image is required"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	return nil
+}
+
+func (v *cacheVerifyCmd) Privileges() error {
+	var err error
+	// the cache is read with the credentials of the restorer
+	v.keychain, err = auth.PlatformKeychain(v.platformDir, "restorer", cmd.DefaultLogger, v.registryImages()...)
+	if err != nil {
+		return cmd.FailErr(err, "resolve keychain")
+	}
+	v.cacheKeychain, err = auth.CacheKeychain(v.platformDir, cmd.DefaultLogger, v.keychain, v.cacheImageTag)
+	if err != nil {
+		return cmd.FailErr(err, "resolve cache keychain")
+	}
+	if err := priv.RunAs(v.uid, v.gid); err != nil {
+		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", v.uid, v.gid))
+	}
+	return nil
+}
+
+func (v *cacheVerifyCmd) Exec() error {
+	// verifying only reads the cache, and may run without ownership of the cache directory
+	cacheStore, err := initCache(v.cacheImageTag, v.cacheURL, v.cacheDir, v.cacheLockTimeout, v.cacheKeychain, registryRetry(v.registryRetries, v.registryRetryBackoff), cache.WithReadOnly())
+	if err != nil {
+		return cmd.FailErr(err, "initialize cache")
+	}
+	defer closeCache(cacheStore)
+	if !cacheStore.Exists() {
+		cmd.DefaultLogger.Info("Layer cache not found")
+		return nil
+	}
+
+	failed, err := lifecycle.VerifyCache(cacheStore, cmd.DefaultLogger)
+	if err != nil {
+		return cmd.FailErr(err, "verify cache")
+	}
+	if len(failed) > 0 {
+		return cmd.FailErr(fmt.Errorf("%d layer(s) failed verification", len(failed)), "verify cache")
+	}
+	cmd.DefaultLogger.Info("Cache verified")
+	return nil
+}
+
+func (v *cacheVerifyCmd) registryImages() []string {
+	if v.cacheImageTag != "" {
+		return []string{v.cacheImageTag}
+	}
+	return []string{}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/google/go-containerregistry/pkg/authn"
 
+	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/auth"
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/image"
@@ -15,41 +17,61 @@ import (
 
 type createCmd struct {
 	//flags: inputs
-	appDir              string
-	buildpacksDir       string
-	cacheDir            string
-	cacheImageTag       string
-	imageName           string
-	launchCacheDir      string
-	launcherPath        string
-	layersDir           string
-	orderPath           string
-	platformDir         string
-	previousImage       string
-	processType         string
-	projectMetadataPath string
-	registry            string
-	reportPath          string
-	runImageRef         string
-	stackMD             platform.StackMetadata
-	stackPath           string
-	uid, gid            int
-	additionalTags      cmd.StringSlice
-	skipRestore         bool
-	useDaemon           bool
+	appDir               string
+	buildDebug           bool
+	buildDebugRedact     string
+	buildpacksDir        string
+	cacheDir             string
+	cacheImageTag        string
+	cacheURL             string
+	cacheLockTimeout     time.Duration
+	debugOnFailure       bool
+	imageName            string
+	launchCacheDir       string
+	launcherPath         string
+	layersDir            string
+	orderPath            string
+	platformDir          string
+	previousImage        string
+	processType          string
+	projectMetadataPath  string
+	registry             string
+	registryRetries      int
+	registryRetryBackoff time.Duration
+	retry                lifecycle.Retry
+	reportPath           string
+	restoreWorkers       int
+	runImageDigest       string
+	runImageDigestPolicy string
+	runImageMirrors      string
+	runImageProvided     bool
+	runImageRef          string
+	stackMD              platform.StackMetadata
+	stackPath            string
+	strictValidation     bool
+	uid, gid             int
+	additionalTags       cmd.StringSlice
+	skipRestore          bool
+	useDaemon            bool
 
 	platform cmd.Platform
 
 	//set if necessary before dropping privileges
-	docker   client.CommonAPIClient
-	keychain authn.Keychain
+	docker        client.CommonAPIClient
+	keychain      authn.Keychain
+	cacheKeychain authn.Keychain
 }
 
 func (c *createCmd) DefineFlags() {
 	cmd.FlagAppDir(&c.appDir)
+	cmd.FlagBuildDebug(&c.buildDebug)
+	cmd.FlagBuildDebugRedact(&c.buildDebugRedact)
 	cmd.FlagBuildpacksDir(&c.buildpacksDir)
 	cmd.FlagCacheDir(&c.cacheDir)
 	cmd.FlagCacheImage(&c.cacheImageTag)
+	cmd.FlagCacheURL(&c.cacheURL)
+	cmd.FlagCacheLockTimeout(&c.cacheLockTimeout)
+	cmd.FlagDebugOnFailure(&c.debugOnFailure)
 	cmd.FlagGID(&c.gid)
 	cmd.FlagLaunchCacheDir(&c.launchCacheDir)
 	cmd.FlagLauncherPath(&c.launcherPath)
@@ -57,10 +79,16 @@ func (c *createCmd) DefineFlags() {
 	cmd.FlagOrderPath(&c.orderPath)
 	cmd.FlagPlatformDir(&c.platformDir)
 	cmd.FlagPreviousImage(&c.previousImage)
+	cmd.FlagRegistryRetries(&c.registryRetries)
+	cmd.FlagRegistryRetryBackoff(&c.registryRetryBackoff)
 	cmd.FlagReportPath(&c.reportPath)
+	cmd.FlagRestoreWorkers(&c.restoreWorkers)
 	cmd.FlagRunImage(&c.runImageRef)
+	cmd.FlagRunImageDigestPolicy(&c.runImageDigestPolicy)
+	cmd.FlagRunImageMirrors(&c.runImageMirrors)
 	cmd.FlagSkipRestore(&c.skipRestore)
 	cmd.FlagStackPath(&c.stackPath)
+	cmd.FlagStrictValidation(&c.strictValidation)
 	cmd.FlagUID(&c.uid)
 	cmd.FlagUseDaemon(&c.useDaemon)
 	cmd.FlagTags(&c.additionalTags)
@@ -79,7 +107,7 @@ func (c *createCmd) Args(nargs int, args []string) error {
 		c.launchCacheDir = ""
 	}
 
-	if c.cacheImageTag == "" && c.cacheDir == "" {
+	if c.cacheImageTag == "" && c.cacheURL == "" && c.cacheDir == "" {
 		cmd.DefaultLogger.Warn("Not restoring or caching layer data, no cache flag specified.")
 	}
 
@@ -87,7 +115,7 @@ func (c *createCmd) Args(nargs int, args []string) error {
 		c.previousImage = c.imageName
 	}
 
-	if err := image.ValidateDestinationTags(c.useDaemon, append(c.additionalTags, c.imageName)...); err != nil {
+	if err := image.ValidateDestinationTags(append(c.additionalTags, c.imageName)...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
 
@@ -99,6 +127,13 @@ func (c *createCmd) Args(nargs int, args []string) error {
 		c.reportPath = cmd.DefaultReportPath(c.platform.API(), c.layersDir)
 	}
 
+	if err := validateRunImageDigestPolicy(c.runImageDigestPolicy); err != nil {
+		return err
+	}
+
+	c.retry = registryRetry(c.registryRetries, c.registryRetryBackoff)
+	c.runImageProvided = c.runImageRef != ""
+
 	var err error
 	c.stackMD, c.runImageRef, c.registry, err = resolveStack(c.imageName, c.stackPath, c.runImageRef)
 	if err != nil {
@@ -110,10 +145,14 @@ func (c *createCmd) Args(nargs int, args []string) error {
 
 func (c *createCmd) Privileges() error {
 	var err error
-	c.keychain, err = auth.DefaultKeychain(c.registryImages()...)
+	c.keychain, err = auth.PlatformKeychain(c.platformDir, "creator", cmd.DefaultLogger, c.registryImages()...)
 	if err != nil {
 		return cmd.FailErr(err, "resolve keychain")
 	}
+	c.cacheKeychain, err = auth.CacheKeychain(c.platformDir, cmd.DefaultLogger, c.keychain, c.cacheImageTag)
+	if err != nil {
+		return cmd.FailErr(err, "resolve cache keychain")
+	}
 
 	if c.useDaemon {
 		var err error
@@ -135,10 +174,11 @@ func (c *createCmd) Privileges() error {
 }
 
 func (c *createCmd) Exec() error {
-	cacheStore, err := initCache(c.cacheImageTag, c.cacheDir, c.keychain)
+	cacheStore, err := initCache(c.cacheImageTag, c.cacheURL, c.cacheDir, c.cacheLockTimeout, c.cacheKeychain, c.retry)
 	if err != nil {
 		return err
 	}
+	defer closeCache(cacheStore)
 
 	cmd.DefaultLogger.Phase("DETECTING")
 	group, plan, err := detectArgs{
@@ -148,28 +188,41 @@ func (c *createCmd) Exec() error {
 		platform:      c.platform,
 		platformDir:   c.platformDir,
 		orderPath:     c.orderPath,
+		debugShell:    c.debugOnFailure,
 	}.detect()
 	if err != nil {
 		return err
 	}
 
 	cmd.DefaultLogger.Phase("ANALYZING")
-	analyzedMD, err := analyzeArgs{
-		imageName:  c.previousImage,
-		keychain:   c.keychain,
-		layersDir:  c.layersDir,
-		platform:   c.platform,
-		skipLayers: c.skipRestore,
-		useDaemon:  c.useDaemon,
-		docker:     c.docker,
-	}.analyze(group, cacheStore)
+	aa := analyzeArgs{
+		imageName:        c.previousImage,
+		keychain:         c.keychain,
+		layersDir:        c.layersDir,
+		platform:         c.platform,
+		preferredMirrors: splitList(c.runImageMirrors),
+		registry:         c.registry,
+		retry:            c.retry,
+		skipLayers:       c.skipRestore,
+		stackMD:          c.stackMD,
+		useDaemon:        c.useDaemon,
+		docker:           c.docker,
+	}
+	if c.runImageProvided {
+		aa.runImageRef = c.runImageRef
+	}
+	analyzedMD, err := aa.analyze(group, cacheStore)
 	if err != nil {
 		return err
 	}
+	if analyzedMD.RunImage != nil {
+		c.runImageRef = analyzedMD.RunImage.Reference
+		c.runImageDigest = analyzedMD.RunImage.Digest
+	}
 
 	if !c.skipRestore {
 		cmd.DefaultLogger.Phase("RESTORING")
-		if err := restore(c.platform, c.layersDir, group, cacheStore); err != nil {
+		if err := restore(c.platform, c.layersDir, group, cacheStore, c.restoreWorkers); err != nil {
 			return err
 		}
 	}
@@ -181,6 +234,9 @@ func (c *createCmd) Exec() error {
 		appDir:        c.appDir,
 		platform:      c.platform,
 		platformDir:   c.platformDir,
+		debug:         c.buildDebug,
+		debugRedact:   c.buildDebugRedact,
+		debugShell:    c.debugOnFailure,
 	}.build(group, plan)
 	if err != nil {
 		return err
@@ -188,24 +244,30 @@ func (c *createCmd) Exec() error {
 
 	cmd.DefaultLogger.Phase("EXPORTING")
 	return exportArgs{
-		appDir:              c.appDir,
-		docker:              c.docker,
-		gid:                 c.gid,
-		imageNames:          append([]string{c.imageName}, c.additionalTags...),
-		keychain:            c.keychain,
-		launchCacheDir:      c.launchCacheDir,
-		launcherPath:        c.launcherPath,
-		layersDir:           c.layersDir,
-		platform:            c.platform,
-		processType:         c.processType,
-		projectMetadataPath: c.projectMetadataPath,
-		registry:            c.registry,
-		reportPath:          c.reportPath,
-		runImageRef:         c.runImageRef,
-		stackMD:             c.stackMD,
-		stackPath:           c.stackPath,
-		uid:                 c.uid,
-		useDaemon:           c.useDaemon,
+		appDir:               c.appDir,
+		cacheKeychain:        c.cacheKeychain,
+		cacheLockTimeout:     c.cacheLockTimeout,
+		docker:               c.docker,
+		gid:                  c.gid,
+		imageNames:           append([]string{c.imageName}, c.additionalTags...),
+		keychain:             c.keychain,
+		launchCacheDir:       c.launchCacheDir,
+		launcherPath:         c.launcherPath,
+		layersDir:            c.layersDir,
+		platform:             c.platform,
+		processType:          c.processType,
+		projectMetadataPath:  c.projectMetadataPath,
+		registry:             c.registry,
+		reportPath:           c.reportPath,
+		retry:                c.retry,
+		runImageDigest:       c.runImageDigest,
+		runImageDigestPolicy: c.runImageDigestPolicy,
+		runImageRef:          c.runImageRef,
+		stackMD:              c.stackMD,
+		stackPath:            c.stackPath,
+		strictValidation:     c.strictValidation,
+		uid:                  c.uid,
+		useDaemon:            c.useDaemon,
 	}.export(group, cacheStore, analyzedMD)
 }
 
@@ -216,7 +278,12 @@ func (c *createCmd) registryImages() []string {
 	}
 	if !c.useDaemon {
 		registryImages = append(registryImages, append([]string{c.imageName}, c.additionalTags...)...)
-		registryImages = append(registryImages, c.runImageRef, c.previousImage)
+		registryImages = append(registryImages, c.previousImage)
+		if c.runImageProvided {
+			registryImages = append(registryImages, c.runImageRef)
+		} else {
+			registryImages = append(registryImages, runImageRefs("", c.stackMD)...)
+		}
 	}
 	return registryImages
 }
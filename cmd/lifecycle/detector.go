@@ -29,6 +29,7 @@ type detectArgs struct {
 	layersDir     string
 	platformDir   string
 	orderPath     string
+	debugShell    bool
 
 	platform cmd.Platform
 }
@@ -41,6 +42,7 @@ func (d *detectCmd) DefineFlags() {
 	cmd.FlagOrderPath(&d.orderPath)
 	cmd.FlagGroupPath(&d.groupPath)
 	cmd.FlagPlanPath(&d.planPath)
+	cmd.FlagDebugOnFailure(&d.debugShell)
 }
 
 func (d *detectCmd) Args(nargs int, args []string) error {
@@ -100,6 +102,7 @@ func (da detectArgs) detect() (buildpack.Group, platform.BuildPlan, error) {
 			AppDir:      da.appDir,
 			PlatformDir: da.platformDir,
 			Logger:      cmd.DefaultLogger,
+			DebugShell:  debugShell(da.debugShell),
 		},
 		da.buildpacksDir,
 	)
@@ -158,3 +161,16 @@ func (d *detectCmd) writeData(group buildpack.Group, plan platform.BuildPlan) er
 	}
 	return nil
 }
+
+// debugShell returns the shell to run when a buildpack fails, or nil when debugging is not enabled
+func debugShell(enabled bool) *buildpack.DebugShell {
+	if !enabled {
+		return nil
+	}
+	return &buildpack.DebugShell{
+		Path: cmd.DefaultDebugShell,
+		In:   os.Stdin,
+		Out:  cmd.Stdout,
+		Err:  cmd.Stderr,
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/buildpacks/imgutil"
@@ -12,6 +14,7 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle"
@@ -32,36 +35,47 @@ type exportCmd struct {
 	//flags: inputs
 	cacheDir              string
 	cacheImageTag         string
+	cacheURL              string
 	groupPath             string
+	platformDir           string
 	deprecatedRunImageRef string
 	exportArgs
 
+	registryRetries      int
+	registryRetryBackoff time.Duration
+
 	//flags: paths to write outputs
 	analyzedPath string
 }
 
 type exportArgs struct {
 	// inputs needed when run by creator
-	appDir              string
-	imageNames          []string
-	launchCacheDir      string
-	launcherPath        string
-	layersDir           string
-	processType         string
-	projectMetadataPath string
-	registry            string
-	reportPath          string
-	runImageRef         string
-	stackMD             platform.StackMetadata
-	stackPath           string
-	useDaemon           bool
-	uid, gid            int
+	appDir               string
+	cacheLockTimeout     time.Duration
+	imageNames           []string
+	launchCacheDir       string
+	launcherPath         string
+	layersDir            string
+	processType          string
+	projectMetadataPath  string
+	registry             string
+	retry                lifecycle.Retry
+	reportPath           string
+	runImageDigest       string
+	runImageDigestPolicy string
+	runImageRef          string
+	stackMD              platform.StackMetadata
+	stackPath            string
+	strictValidation     bool
+	useDaemon            bool
+	uid, gid             int
 
 	platform cmd.Platform
 
 	//construct if necessary before dropping privileges
-	docker   client.CommonAPIClient
-	keychain authn.Keychain
+	docker        client.CommonAPIClient
+	keychain      authn.Keychain
+	cacheKeychain authn.Keychain
 }
 
 func (e *exportCmd) DefineFlags() {
@@ -69,16 +83,23 @@ func (e *exportCmd) DefineFlags() {
 	cmd.FlagAppDir(&e.appDir)
 	cmd.FlagCacheDir(&e.cacheDir)
 	cmd.FlagCacheImage(&e.cacheImageTag)
+	cmd.FlagCacheURL(&e.cacheURL)
+	cmd.FlagCacheLockTimeout(&e.cacheLockTimeout)
 	cmd.FlagGID(&e.gid)
 	cmd.FlagGroupPath(&e.groupPath)
 	cmd.FlagLaunchCacheDir(&e.launchCacheDir)
 	cmd.FlagLauncherPath(&e.launcherPath)
 	cmd.FlagLayersDir(&e.layersDir)
+	cmd.FlagPlatformDir(&e.platformDir)
 	cmd.FlagProcessType(&e.processType)
 	cmd.FlagProjectMetadataPath(&e.projectMetadataPath)
+	cmd.FlagRegistryRetries(&e.registryRetries)
+	cmd.FlagRegistryRetryBackoff(&e.registryRetryBackoff)
 	cmd.FlagReportPath(&e.reportPath)
 	cmd.FlagRunImage(&e.runImageRef)
+	cmd.FlagRunImageDigestPolicy(&e.runImageDigestPolicy)
 	cmd.FlagStackPath(&e.stackPath)
+	cmd.FlagStrictValidation(&e.strictValidation)
 	cmd.FlagUID(&e.uid)
 	cmd.FlagUseDaemon(&e.useDaemon)
 
@@ -91,16 +112,17 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 	}
 
 	e.imageNames = args
+	e.retry = registryRetry(e.registryRetries, e.registryRetryBackoff)
 	if e.launchCacheDir != "" && !e.useDaemon {
 		cmd.DefaultLogger.Warn("Ignoring -launch-cache, only intended for use with -daemon")
 		e.launchCacheDir = ""
 	}
 
-	if e.cacheImageTag == "" && e.cacheDir == "" {
+	if e.cacheImageTag == "" && e.cacheURL == "" && e.cacheDir == "" {
 		cmd.DefaultLogger.Warn("Will not cache data, no cache flag specified.")
 	}
 
-	if err := image.ValidateDestinationTags(e.useDaemon, e.imageNames...); err != nil {
+	if err := image.ValidateDestinationTags(e.imageNames...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
 
@@ -129,14 +151,27 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 	}
 
 	var err error
-	e.stackMD, e.runImageRef, e.registry, err = resolveStack(e.imageNames[0], e.stackPath, e.runImageRef)
+	e.analyzedMD, err = parseOptionalAnalyzedMD(cmd.DefaultLogger, e.analyzedPath)
 	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse analyzed metadata")
+	}
+
+	if err := validateRunImageDigestPolicy(e.runImageDigestPolicy); err != nil {
 		return err
 	}
 
-	e.analyzedMD, err = parseOptionalAnalyzedMD(cmd.DefaultLogger, e.analyzedPath)
+	if e.runImageRef == "" && e.analyzedMD.RunImage != nil {
+		cmd.DefaultLogger.Debugf("Using run image '%s' selected by the analyzer (%s)", e.analyzedMD.RunImage.Reference, e.analyzedMD.RunImage.Reason)
+		e.runImageRef = e.analyzedMD.RunImage.Reference
+	}
+
+	e.stackMD, e.runImageRef, e.registry, err = resolveStack(e.imageNames[0], e.stackPath, e.runImageRef)
 	if err != nil {
-		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse analyzed metadata")
+		return err
+	}
+
+	if e.analyzedMD.RunImage != nil && e.analyzedMD.RunImage.Reference == e.runImageRef {
+		e.runImageDigest = e.analyzedMD.RunImage.Digest
 	}
 
 	return nil
@@ -144,10 +179,14 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 
 func (e *exportCmd) Privileges() error {
 	var err error
-	e.keychain, err = auth.DefaultKeychain(e.registryImages()...)
+	e.keychain, err = auth.PlatformKeychain(e.platformDir, "exporter", cmd.DefaultLogger, e.registryImages()...)
 	if err != nil {
 		return cmd.FailErr(err, "resolve keychain")
 	}
+	e.cacheKeychain, err = auth.CacheKeychain(e.platformDir, cmd.DefaultLogger, e.keychain, e.cacheImageTag)
+	if err != nil {
+		return cmd.FailErr(err, "resolve cache keychain")
+	}
 
 	if e.useDaemon {
 		var err error
@@ -174,10 +213,11 @@ func (e *exportCmd) Exec() error {
 		return err
 	}
 
-	cacheStore, err := initCache(e.cacheImageTag, e.cacheDir, e.keychain)
+	cacheStore, err := initCache(e.cacheImageTag, e.cacheURL, e.cacheDir, e.cacheLockTimeout, e.cacheKeychain, e.retry)
 	if err != nil {
-		cmd.DefaultLogger.Infof("no stack metadata found at path '%s', stack metadata will not be exported\n", e.stackPath)
+		return cmd.FailErr(err, "initialize cache")
 	}
+	defer closeCache(cacheStore)
 
 	return e.export(group, cacheStore, e.analyzedMD)
 }
@@ -223,14 +263,32 @@ func (ea exportArgs) export(group buildpack.Group, cacheStore lifecycle.Cache, a
 		},
 		Logger:      cmd.DefaultLogger,
 		PlatformAPI: api.MustParse(ea.platform.API()),
+		Retry:       ea.retry,
+	}
+
+	var cacheMD platform.CacheMetadata
+	if cacheStore != nil {
+		cacheMD, err = cacheStore.RetrieveMetadata()
+		if err != nil {
+			cmd.DefaultLogger.Warnf("Failed to read previous app layer index from cache: %v", err)
+		}
 	}
 
 	var appImage imgutil.Image
 	var runImageID string
+	var cacheImageDiffIDs map[string]bool
 	if ea.useDaemon {
 		appImage, runImageID, err = ea.initDaemonAppImage(analyzedMD)
 	} else {
-		appImage, runImageID, err = ea.initRemoteAppImage(analyzedMD)
+		var (
+			cacheImageName string
+			seeded         bool
+		)
+		cacheImageName, cacheImageDiffIDs = ea.cacheImageSeed(analyzedMD, cacheStore, cacheMD)
+		appImage, runImageID, seeded, err = ea.initRemoteAppImage(analyzedMD, cacheImageName)
+		if !seeded {
+			cacheImageDiffIDs = nil
+		}
 	}
 	if err != nil {
 		return err
@@ -243,22 +301,30 @@ func (ea exportArgs) export(group buildpack.Group, cacheStore lifecycle.Cache, a
 		LauncherConfig:     launcherConfig(ea.launcherPath),
 		LayersDir:          ea.layersDir,
 		OrigMetadata:       analyzedMD.Metadata,
+		OrigAppIndex:       lifecycle.RetrieveAppIndex(cacheStore, cacheMD, cmd.DefaultLogger),
+		CacheImageDiffIDs:  cacheImageDiffIDs,
 		Project:            projectMD,
 		RunImageRef:        runImageID,
+		RunImageDigest:     runImageDigest(runImageID, ea.useDaemon),
+		RunImageDiffIDs:    ea.runImageDiffIDs(runImageID),
 		Stack:              ea.stackMD,
+		StrictValidation:   ea.strictValidation,
 		WorkingImage:       appImage,
 	})
 	if err != nil {
 		return cmd.FailErrCode(err, ea.platform.CodeFor(cmd.ExportError), "export")
 	}
-	if err := lifecycle.WriteTOML(ea.reportPath, &report); err != nil {
-		return cmd.FailErrCode(err, ea.platform.CodeFor(cmd.ExportError), "write export report")
-	}
 
 	if cacheStore != nil {
 		if cacheErr := exporter.Cache(ea.layersDir, cacheStore); cacheErr != nil {
 			cmd.DefaultLogger.Warnf("Failed to export cache: %v\n", cacheErr)
 		}
+		// the report is written after caching so that it includes the cache layer metrics
+		cacheReport := exporter.CacheReport()
+		report.Cache = &cacheReport
+	}
+	if err := lifecycle.WriteTOML(ea.reportPath, &report); err != nil {
+		return cmd.FailErrCode(err, ea.platform.CodeFor(cmd.ExportError), "write export report")
 	}
 	return nil
 }
@@ -289,7 +355,7 @@ func (ea exportArgs) initDaemonAppImage(analyzedMD platform.AnalyzedMetadata) (i
 	}
 
 	if ea.launchCacheDir != "" {
-		volumeCache, err := cache.NewVolumeCache(ea.launchCacheDir)
+		volumeCache, err := cache.NewVolumeCache(ea.launchCacheDir, cache.WithLockTimeout(ea.cacheLockTimeout))
 		if err != nil {
 			return nil, "", cmd.FailErr(err, "create launch cache")
 		}
@@ -298,42 +364,160 @@ func (ea exportArgs) initDaemonAppImage(analyzedMD platform.AnalyzedMetadata) (i
 	return appImage, runImageID.String(), nil
 }
 
-func (ea exportArgs) initRemoteAppImage(analyzedMD platform.AnalyzedMetadata) (imgutil.Image, string, error) {
+// cacheImageSeed returns the cache image and the buildpack layers it contains when there is no previous image to reuse layers from.
+// Reused layers of a cache image on the same registry as the app image are mounted,
+// and those of a cache image on another registry are copied from that registry, instead of uploaded from the layers directory.
+// The cache image is read with the cache credentials, see initRemoteAppImage.
+func (ea exportArgs) cacheImageSeed(analyzedMD platform.AnalyzedMetadata, cacheStore lifecycle.Cache, cacheMD platform.CacheMetadata) (string, map[string]bool) {
+	imageCache, ok := cacheStore.(*cache.ImageCache)
+	if analyzedMD.Image != nil || !ok || !imageCache.Exists() {
+		return "", nil
+	}
+	diffIDs := map[string]bool{}
+	for _, bp := range cacheMD.Buildpacks {
+		for _, layer := range bp.Layers {
+			if layer.SHA != "" {
+				diffIDs[layer.SHA] = true
+			}
+		}
+	}
+	if len(diffIDs) == 0 {
+		return "", nil
+	}
+	return imageCache.Name(), diffIDs
+}
+
+// initRemoteAppImage returns the app image, the run image reference and whether the app image reuses layers from the cache image
+func (ea exportArgs) initRemoteAppImage(analyzedMD platform.AnalyzedMetadata, cacheImageName string) (imgutil.Image, string, bool, error) {
+	runImageRef, err := pinRunImage(ea.runImageRef, ea.runImageDigest, ea.runImageDigestPolicy, ea.keychain, ea.retry)
+	if err != nil {
+		return nil, "", false, cmd.FailErrCode(err, ea.platform.CodeFor(cmd.ExportError), "verify run image")
+	}
+
 	var opts = []remote.ImageOption{
-		remote.FromBaseImage(ea.runImageRef),
+		remote.FromBaseImage(runImageRef),
 	}
 
 	if analyzedMD.Image != nil {
 		cmd.DefaultLogger.Infof("Reusing layers from image '%s'", analyzedMD.Image.Reference)
 		ref, err := name.ParseReference(analyzedMD.Image.Reference, name.WeakValidation)
 		if err != nil {
-			return nil, "", cmd.FailErr(err, "parse analyzed registry")
+			return nil, "", false, cmd.FailErr(err, "parse analyzed registry")
 		}
 		analyzedRegistry := ref.Context().RegistryStr()
 		if analyzedRegistry != ea.registry {
-			return nil, "", fmt.Errorf("analyzed image is on a different registry %s from the exported image %s", analyzedRegistry, ea.registry)
+			return nil, "", false, fmt.Errorf("analyzed image is on a different registry %s from the exported image %s", analyzedRegistry, ea.registry)
 		}
 		opts = append(opts, remote.WithPreviousImage(analyzedMD.Image.Reference))
 	}
 
-	appImage, err := remote.NewImage(
-		ea.imageNames[0],
-		ea.keychain,
-		opts...,
-	)
-	if err != nil {
-		return nil, "", cmd.FailErr(err, "create new app image")
+	var appImage imgutil.Image
+	if cacheImageName != "" {
+		// the cache image and its reused layers are read with the cache credentials, the app image is written with the app credentials
+		var cacheImage v1.Image
+		err := ea.retry.Do("reading cache image", func() error {
+			var err error
+			cacheImage, err = image.RemoteImage(cacheImageName, ea.cacheKeychain)
+			return err
+		})
+		if err == nil {
+			appImage, err = remote.NewImage(ea.imageNames[0], ea.keychain, append(opts, remote.WithPreviousLayers(cacheImage))...)
+		}
+		// export without reusing layers from the cache image if it cannot be read
+		if err != nil {
+			cmd.DefaultLogger.Warnf("Unable to reuse layers from cache image '%s': %s", cacheImageName, err)
+			appImage = nil
+		} else {
+			cmd.DefaultLogger.Infof("Reusing layers from cache image '%s'", cacheImageName)
+		}
+	}
+	seeded := appImage != nil
+	if appImage == nil {
+		appImage, err = remote.NewImage(
+			ea.imageNames[0],
+			ea.keychain,
+			opts...,
+		)
+		if err != nil {
+			return nil, "", false, cmd.FailErr(err, "create new app image")
+		}
 	}
 
-	runImage, err := remote.NewImage(ea.runImageRef, ea.keychain, remote.FromBaseImage(ea.runImageRef))
+	runImage, err := remote.NewImage(runImageRef, ea.keychain, remote.FromBaseImage(runImageRef))
 	if err != nil {
-		return nil, "", cmd.FailErr(err, "access run image")
+		return nil, "", false, cmd.FailErr(err, "access run image")
 	}
 	runImageID, err := runImage.Identifier()
 	if err != nil {
-		return nil, "", cmd.FailErr(err, "get run image reference")
+		return nil, "", false, cmd.FailErr(err, "get run image reference")
 	}
-	return appImage, runImageID.String(), nil
+	return appImage, runImageID.String(), seeded, nil
+}
+
+// runImageDiffIDs returns the layers of the run image, or nil if they cannot be determined
+func (ea exportArgs) runImageDiffIDs(runImageID string) []string {
+	if ea.useDaemon {
+		inspect, _, err := ea.docker.ImageInspectWithRaw(context.Background(), runImageID)
+		if err != nil {
+			cmd.DefaultLogger.Debugf("Unable to inspect run image '%s': %s", runImageID, err)
+			return nil
+		}
+		return inspect.RootFS.Layers
+	}
+	diffIDs, err := image.RemoteDiffIDs(runImageID, ea.keychain)
+	if err != nil {
+		cmd.DefaultLogger.Debugf("Unable to read layers of run image '%s': %s", runImageID, err)
+		return nil
+	}
+	return diffIDs
+}
+
+// pinRunImage returns a reference to the run image pinned to pinnedDigest.
+// If runImageRef no longer resolves to pinnedDigest, pinRunImage fails or warns according to policy.
+func pinRunImage(runImageRef, pinnedDigest, policy string, keychain authn.Keychain, retry lifecycle.Retry) (string, error) {
+	if pinnedDigest == "" {
+		return runImageRef, nil
+	}
+	pinnedRef, err := image.DigestReference(runImageRef, pinnedDigest)
+	if err != nil {
+		return "", err
+	}
+	var currentDigest string
+	if err := retry.Do("resolving run image", func() error {
+		currentDigest, err = image.ResolveDigest(runImageRef, keychain)
+		return err
+	}); err != nil {
+		return "", err
+	}
+	if currentDigest != pinnedDigest {
+		msg := fmt.Sprintf("run image '%s' resolves to '%s', expected pinned digest '%s'", runImageRef, currentDigest, pinnedDigest)
+		if policy == cmd.RunImageDigestPolicyFail {
+			return "", errors.New(msg)
+		}
+		cmd.DefaultLogger.Warnf("%s, using pinned image '%s'", msg, pinnedRef)
+	}
+	return pinnedRef, nil
+}
+
+func validateRunImageDigestPolicy(policy string) error {
+	switch policy {
+	case cmd.RunImageDigestPolicyWarn, cmd.RunImageDigestPolicyFail:
+		return nil
+	default:
+		return cmd.FailErrCode(fmt.Errorf("unknown run image digest policy '%s'", policy), cmd.CodeInvalidArgs, "parse arguments")
+	}
+}
+
+// runImageDigest returns the digest of the run image if it was pulled from a registry
+func runImageDigest(runImageID string, useDaemon bool) string {
+	if useDaemon {
+		return ""
+	}
+	digestRef, err := name.NewDigest(runImageID, name.WeakValidation)
+	if err != nil {
+		return ""
+	}
+	return digestRef.DigestStr()
 }
 
 func launcherConfig(launcherPath string) lifecycle.LauncherConfig {
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/auth"
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestExporter(t *testing.T) {
+	spec.Run(t, "Exporter", testExporter, spec.Report(report.Terminal{}))
+}
+
+func testExporter(t *testing.T, when spec.G, it spec.S) {
+	when("#pinRunImage", func() {
+		var (
+			registry    *h.FaultyRegistry
+			runImageRef string
+			digest      string
+		)
+
+		it.Before(func() {
+			registry = h.NewFaultyRegistry()
+			runImage, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			runImageRef = registry.Host() + "/some/run"
+			ref, err := name.ParseReference(runImageRef)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(ref, runImage))
+			imageDigest, err := runImage.Digest()
+			h.AssertNil(t, err)
+			digest = imageDigest.String()
+		})
+
+		it.After(func() {
+			registry.Close()
+		})
+
+		it("retries resolving the run image", func() {
+			registry.FailNext(http.MethodHead, "/some/run/manifests/", 1, http.StatusServiceUnavailable)
+
+			pinnedRef, err := pinRunImage(runImageRef, digest, cmd.RunImageDigestPolicyFail, authn.DefaultKeychain,
+				lifecycle.Retry{Retries: 1, Backoff: time.Millisecond})
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, pinnedRef, runImageRef+"@"+digest)
+			h.AssertEq(t, registry.Requests(http.MethodHead, "/some/run/manifests/"), 2)
+		})
+	})
+
+	when("#initRemoteAppImage", func() {
+		var (
+			appRegistry, cacheRegistry *h.FaultyRegistry
+			cacheImageRef, cacheDiffID string
+			ea                         exportArgs
+		)
+
+		writeImage := func(imageRef string, img v1.Image) {
+			t.Helper()
+			ref, err := name.ParseReference(imageRef)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(ref, img))
+		}
+
+		it.Before(func() {
+			appRegistry = h.NewFaultyRegistry()
+			cacheRegistry = h.NewFaultyRegistry()
+
+			runImage, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			runImage, err = mutate.ConfigFile(runImage, &v1.ConfigFile{OS: "linux", Architecture: "amd64"})
+			h.AssertNil(t, err)
+			writeImage(appRegistry.Host()+"/some/run", runImage)
+
+			cacheImage, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			cacheImageRef = cacheRegistry.Host() + "/some/cache"
+			writeImage(cacheImageRef, cacheImage)
+			cacheLayers, err := cacheImage.Layers()
+			h.AssertNil(t, err)
+			diffID, err := cacheLayers[0].DiffID()
+			h.AssertNil(t, err)
+			cacheDiffID = diffID.String()
+			cacheRegistry.RequireAuth("Basic Y2FjaGU6cGFzc3dvcmQ=")
+
+			ea = exportArgs{
+				imageNames:  []string{appRegistry.Host() + "/some/app"},
+				registry:    appRegistry.Host(),
+				runImageRef: appRegistry.Host() + "/some/run",
+				keychain:    authn.DefaultKeychain,
+				cacheKeychain: &auth.ResolvedKeychain{Auths: map[string]string{
+					cacheRegistry.Host(): "Basic Y2FjaGU6cGFzc3dvcmQ=",
+				}},
+				platform: platform.NewPlatform(cmd.DefaultPlatformAPI),
+			}
+		})
+
+		it.After(func() {
+			appRegistry.Close()
+			cacheRegistry.Close()
+		})
+
+		it("reuses layers from the cache image read with the cache credentials", func() {
+			appImage, _, seeded, err := ea.initRemoteAppImage(platform.AnalyzedMetadata{}, cacheImageRef)
+			h.AssertNil(t, err)
+			h.AssertEq(t, seeded, true)
+
+			h.AssertNil(t, appImage.ReuseLayer(cacheDiffID))
+			h.AssertNil(t, appImage.Save())
+			h.AssertEq(t, appRegistry.Requests(http.MethodPut, "/some/app/manifests/"), 1)
+		})
+
+		it("exports without reusing layers when the cache image cannot be read", func() {
+			ea.cacheKeychain = authn.DefaultKeychain
+
+			appImage, _, seeded, err := ea.initRemoteAppImage(platform.AnalyzedMetadata{}, cacheImageRef)
+			h.AssertNil(t, err)
+			h.AssertEq(t, seeded, false)
+			h.AssertNotNil(t, appImage.ReuseLayer(cacheDiffID))
+		})
+	})
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 
@@ -64,6 +66,13 @@ func subcommand() {
 		cmd.Run(&rebaseCmd{}, true)
 	case "create":
 		cmd.Run(&createCmd{}, true)
+	case "cache":
+		if len(os.Args) < 3 || os.Args[2] != "verify" {
+			cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "unknown cache command, expected: verify"))
+		}
+		// flags follow the cache command
+		os.Args = os.Args[1:]
+		cmd.Run(&cacheVerifyCmd{}, true)
 	default:
 		cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "unknown phase:", phase))
 	}
@@ -83,21 +92,39 @@ func verifyBuildpackApis(group buildpack.Group) error {
 	return nil
 }
 
-func initCache(cacheImageTag, cacheDir string, keychain authn.Keychain) (lifecycle.Cache, error) {
+func registryRetry(retries int, backoff time.Duration) lifecycle.Retry {
+	return lifecycle.Retry{Retries: retries, Backoff: backoff, Logger: cmd.DefaultLogger}
+}
+
+func initCache(cacheImageTag, cacheURL, cacheDir string, cacheLockTimeout time.Duration, keychain authn.Keychain, retry lifecycle.Retry, volumeOpts ...cache.VolumeCacheOption) (lifecycle.Cache, error) {
 	var (
 		cacheStore lifecycle.Cache
 		err        error
 	)
 	if cacheImageTag != "" {
-		cacheStore, err = cache.NewImageCacheFromName(cacheImageTag, keychain)
+		cacheStore, err = cache.NewImageCacheFromName(cacheImageTag, keychain, retry)
 		if err != nil {
 			return nil, cmd.FailErr(err, "create image cache")
 		}
+	} else if cacheURL != "" {
+		cacheStore, err = cache.NewBlobCacheFromURL(cacheURL, retry)
+		if err != nil {
+			return nil, cmd.FailErr(err, "create blob cache")
+		}
 	} else if cacheDir != "" {
-		cacheStore, err = cache.NewVolumeCache(cacheDir)
+		cacheStore, err = cache.NewVolumeCache(cacheDir, append([]cache.VolumeCacheOption{cache.WithLockTimeout(cacheLockTimeout)}, volumeOpts...)...)
 		if err != nil {
 			return nil, cmd.FailErr(err, "create volume cache")
 		}
 	}
 	return cacheStore, nil
 }
+
+// closeCache releases the locks and staging dir held by a volume cache
+func closeCache(cacheStore lifecycle.Cache) {
+	if closer, ok := cacheStore.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			cmd.DefaultLogger.Warnf("Failed to close cache: %s", err)
+		}
+	}
+}
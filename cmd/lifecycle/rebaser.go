@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/buildpacks/imgutil"
 	"github.com/buildpacks/imgutil/local"
@@ -24,7 +25,12 @@ type rebaseCmd struct {
 	appImage imgutil.Image
 	//flags: inputs
 	imageNames            []string
+	platformDir           string
 	reportPath            string
+	registryRetries       int
+	registryRetryBackoff  time.Duration
+	runImageDigest        string
+	runImageDigestPolicy  string
 	runImageRef           string
 	deprecatedRunImageRef string
 	useDaemon             bool
@@ -39,8 +45,13 @@ type rebaseCmd struct {
 
 func (r *rebaseCmd) DefineFlags() {
 	cmd.FlagGID(&r.gid)
+	cmd.FlagPlatformDir(&r.platformDir)
+	cmd.FlagRegistryRetries(&r.registryRetries)
+	cmd.FlagRegistryRetryBackoff(&r.registryRetryBackoff)
 	cmd.FlagReportPath(&r.reportPath)
 	cmd.FlagRunImage(&r.runImageRef)
+	cmd.FlagRunImageDigest(&r.runImageDigest)
+	cmd.FlagRunImageDigestPolicy(&r.runImageDigestPolicy)
 	cmd.FlagUID(&r.uid)
 	cmd.FlagUseDaemon(&r.useDaemon)
 
@@ -52,7 +63,7 @@ func (r *rebaseCmd) Args(nargs int, args []string) error {
 		return cmd.FailErrCode(errors.New("at least one image argument is required"), cmd.CodeInvalidArgs, "parse arguments")
 	}
 	r.imageNames = args
-	if err := image.ValidateDestinationTags(r.useDaemon, r.imageNames...); err != nil {
+	if err := image.ValidateDestinationTags(r.imageNames...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
 
@@ -63,6 +74,10 @@ func (r *rebaseCmd) Args(nargs int, args []string) error {
 		r.runImageRef = r.deprecatedRunImageRef
 	}
 
+	if err := validateRunImageDigestPolicy(r.runImageDigestPolicy); err != nil {
+		return err
+	}
+
 	if r.reportPath == cmd.PlaceholderReportPath {
 		r.reportPath = cmd.DefaultReportPath(r.platform.API(), "")
 	}
@@ -76,7 +91,7 @@ func (r *rebaseCmd) Args(nargs int, args []string) error {
 
 func (r *rebaseCmd) Privileges() error {
 	var err error
-	r.keychain, err = auth.DefaultKeychain(r.registryImages()...)
+	r.keychain, err = auth.PlatformKeychain(r.platformDir, "rebaser", cmd.DefaultLogger, r.registryImages()...)
 	if err != nil {
 		return cmd.FailErr(err, "resolve keychain")
 	}
@@ -104,11 +119,21 @@ func (r *rebaseCmd) Exec() error {
 			local.FromBaseImage(r.runImageRef),
 		)
 	} else {
-		newBaseImage, err = remote.NewImage(
-			r.runImageRef,
-			r.keychain,
-			remote.FromBaseImage(r.runImageRef),
-		)
+		retry := registryRetry(r.registryRetries, r.registryRetryBackoff)
+		var runImageRef string
+		runImageRef, err = pinRunImage(r.runImageRef, r.runImageDigest, r.runImageDigestPolicy, r.keychain, retry)
+		if err != nil {
+			return cmd.FailErrCode(err, r.platform.CodeFor(cmd.RebaseError), "verify run image")
+		}
+		err = retry.Do("reading run image", func() error {
+			var err error
+			newBaseImage, err = remote.NewImage(
+				runImageRef,
+				r.keychain,
+				remote.FromBaseImage(runImageRef),
+			)
+			return err
+		})
 	}
 	if err != nil || !newBaseImage.Found() {
 		return cmd.FailErr(err, "access run image")
@@ -117,6 +142,7 @@ func (r *rebaseCmd) Exec() error {
 	rebaser := &lifecycle.Rebaser{
 		Logger:      cmd.DefaultLogger,
 		PlatformAPI: api.MustParse(r.platform.API()),
+		Retry:       registryRetry(r.registryRetries, r.registryRetryBackoff),
 	}
 	report, err := rebaser.Rebase(r.appImage, newBaseImage, r.imageNames[1:])
 	if err != nil {
@@ -151,15 +177,19 @@ func (r *rebaseCmd) setAppImage() error {
 		)
 	} else {
 		var keychain authn.Keychain
-		keychain, err = auth.DefaultKeychain(r.imageNames[0])
+		keychain, err = auth.PlatformKeychain(r.platformDir, "rebaser", cmd.DefaultLogger, r.imageNames[0])
 		if err != nil {
 			return err
 		}
-		r.appImage, err = remote.NewImage(
-			r.imageNames[0],
-			keychain,
-			remote.FromBaseImage(r.imageNames[0]),
-		)
+		err = registryRetry(r.registryRetries, r.registryRetryBackoff).Do("reading image to rebase", func() error {
+			var err error
+			r.appImage, err = remote.NewImage(
+				r.imageNames[0],
+				keychain,
+				remote.FromBaseImage(r.imageNames[0]),
+			)
+			return err
+		})
 	}
 	if err != nil || !r.appImage.Found() {
 		return cmd.FailErr(err, "access image to rebase")
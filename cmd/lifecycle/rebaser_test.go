@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestRebaser(t *testing.T) {
+	spec.Run(t, "Rebaser", testRebaser, spec.Report(report.Terminal{}))
+}
+
+func testRebaser(t *testing.T, when spec.G, it spec.S) {
+	when("#Exec", func() {
+		var server *httptest.Server
+
+		it.Before(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		when("the run image cannot be read", func() {
+			it("fails to access the run image", func() {
+				rebaser := &rebaseCmd{
+					runImageRef: strings.TrimPrefix(server.URL, "http://") + "/some-run-image",
+					platform:    platform.NewPlatform(cmd.DefaultPlatformAPI),
+					keychain:    authn.DefaultKeychain,
+				}
+
+				err := rebaser.Exec()
+				h.AssertNotNil(t, err)
+				h.AssertStringContains(t, err.Error(), "failed to access run image")
+			})
+		})
+	})
+
+	when("#setAppImage", func() {
+		var (
+			registry *h.FaultyRegistry
+			appImage string
+		)
+
+		it.Before(func() {
+			registry = h.NewFaultyRegistry()
+			img, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			img, err = mutate.ConfigFile(img, &v1.ConfigFile{OS: "linux", Architecture: "amd64"})
+			h.AssertNil(t, err)
+			appImage = registry.Host() + "/some/app"
+			ref, err := name.ParseReference(appImage)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(ref, img))
+		})
+
+		it.After(func() {
+			registry.Close()
+		})
+
+		it("retries reading the image to rebase", func() {
+			registry.FailNext(http.MethodGet, "/some/app/manifests/", 1, http.StatusServiceUnavailable)
+			rebaser := &rebaseCmd{
+				imageNames:           []string{appImage},
+				runImageRef:          "some-run-image",
+				registryRetries:      1,
+				registryRetryBackoff: time.Millisecond,
+				platformDir:          t.TempDir(),
+			}
+
+			h.AssertNil(t, rebaser.setAppImage())
+
+			h.AssertEq(t, rebaser.appImage.Found(), true)
+		})
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 
@@ -15,23 +16,37 @@ import (
 
 type restoreCmd struct {
 	// flags: inputs
-	cacheDir      string
-	cacheImageTag string
-	groupPath     string
-	layersDir     string
-	uid, gid      int
+	cacheDir         string
+	cacheImageTag    string
+	cacheURL         string
+	cacheLockTimeout time.Duration
+	groupPath        string
+	layersDir        string
+	platformDir      string
+	restoreWorkers   int
+	uid, gid         int
+
+	registryRetries      int
+	registryRetryBackoff time.Duration
 
 	platform cmd.Platform
 
 	//set before dropping privileges
-	keychain authn.Keychain
+	keychain      authn.Keychain
+	cacheKeychain authn.Keychain
 }
 
 func (r *restoreCmd) DefineFlags() {
 	cmd.FlagCacheDir(&r.cacheDir)
 	cmd.FlagCacheImage(&r.cacheImageTag)
+	cmd.FlagCacheURL(&r.cacheURL)
+	cmd.FlagCacheLockTimeout(&r.cacheLockTimeout)
 	cmd.FlagGroupPath(&r.groupPath)
 	cmd.FlagLayersDir(&r.layersDir)
+	cmd.FlagPlatformDir(&r.platformDir)
+	cmd.FlagRegistryRetries(&r.registryRetries)
+	cmd.FlagRegistryRetryBackoff(&r.registryRetryBackoff)
+	cmd.FlagRestoreWorkers(&r.restoreWorkers)
 	cmd.FlagUID(&r.uid)
 	cmd.FlagGID(&r.gid)
 }
@@ -40,7 +55,7 @@ func (r *restoreCmd) Args(nargs int, args []string) error {
 	if nargs > 0 {
 		return cmd.FailErrCode(errors.New("received unexpected Args"), cmd.CodeInvalidArgs, "parse arguments")
 	}
-	if r.cacheImageTag == "" && r.cacheDir == "" {
+	if r.cacheImageTag == "" && r.cacheURL == "" && r.cacheDir == "" {
 		cmd.DefaultLogger.Warn("Not restoring cached layer data, no cache flag specified.")
 	}
 
@@ -53,10 +68,14 @@ func (r *restoreCmd) Args(nargs int, args []string) error {
 
 func (r *restoreCmd) Privileges() error {
 	var err error
-	r.keychain, err = auth.DefaultKeychain(r.registryImages()...)
+	r.keychain, err = auth.PlatformKeychain(r.platformDir, "restorer", cmd.DefaultLogger, r.registryImages()...)
 	if err != nil {
 		return cmd.FailErr(err, "resolve keychain")
 	}
+	r.cacheKeychain, err = auth.CacheKeychain(r.platformDir, cmd.DefaultLogger, r.keychain, r.cacheImageTag)
+	if err != nil {
+		return cmd.FailErr(err, "resolve cache keychain")
+	}
 
 	if err := priv.EnsureOwner(r.uid, r.gid, r.layersDir, r.cacheDir); err != nil {
 		return cmd.FailErr(err, "chown volumes")
@@ -75,11 +94,12 @@ func (r *restoreCmd) Exec() error {
 	if err := verifyBuildpackApis(group); err != nil {
 		return err
 	}
-	cacheStore, err := initCache(r.cacheImageTag, r.cacheDir, r.keychain)
+	cacheStore, err := initCache(r.cacheImageTag, r.cacheURL, r.cacheDir, r.cacheLockTimeout, r.cacheKeychain, registryRetry(r.registryRetries, r.registryRetryBackoff))
 	if err != nil {
 		return err
 	}
-	return restore(r.platform, r.layersDir, group, cacheStore)
+	defer closeCache(cacheStore)
+	return restore(r.platform, r.layersDir, group, cacheStore, r.restoreWorkers)
 }
 
 func (r *restoreCmd) registryImages() []string {
@@ -89,11 +109,12 @@ func (r *restoreCmd) registryImages() []string {
 	return []string{}
 }
 
-func restore(p cmd.Platform, layersDir string, group buildpack.Group, cacheStore lifecycle.Cache) error {
+func restore(p cmd.Platform, layersDir string, group buildpack.Group, cacheStore lifecycle.Cache, workers int) error {
 	restorer := &lifecycle.Restorer{
 		LayersDir:  layersDir,
 		Buildpacks: group.Group,
 		Logger:     cmd.DefaultLogger,
+		Workers:    workers,
 	}
 
 	if err := restorer.Restore(cacheStore); err != nil {
@@ -10,11 +10,13 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/buildpacks/imgutil"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/buildpack"
 	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/layers"
 	"github.com/buildpacks/lifecycle/platform"
@@ -28,6 +30,7 @@ type Cache interface {
 	AddLayerFile(tarPath string, sha string) error
 	ReuseLayer(sha string) error
 	RetrieveLayer(sha string) (io.ReadCloser, error)
+	QuarantineLayer(sha string) error
 	Commit() error
 }
 
@@ -36,6 +39,10 @@ type Exporter struct {
 	LayerFactory LayerFactory
 	Logger       Logger
 	PlatformAPI  *api.Version
+	Retry        Retry
+
+	appIndex []layers.SliceIndex // appIndex indexes the exported app layers, it is written to the cache
+	metrics  cacheMetrics        // metrics are collected by the restorer, Export and Cache
 }
 
 //go:generate mockgen -package testmock -destination testmock/layer_factory.go github.com/buildpacks/lifecycle LayerFactory
@@ -43,7 +50,8 @@ type LayerFactory interface {
 	DirLayer(id string, dir string) (layers.Layer, error)
 	LauncherLayer(path string) (layers.Layer, error)
 	ProcessTypesLayer(metadata launch.Metadata) (layers.Layer, error)
-	SliceLayers(dir string, slices []layers.Slice) ([]layers.Layer, error)
+	SliceLayersWithIndex(dir string, slices []layers.Slice, previous []layers.SliceIndex) ([]layers.Layer, []layers.SliceIndex, error)
+	AppIndexLayer(index []layers.SliceIndex) (layers.Layer, error)
 }
 
 type LauncherConfig struct {
@@ -56,12 +64,17 @@ type ExportOptions struct {
 	AppDir             string
 	WorkingImage       imgutil.Image
 	RunImageRef        string
+	RunImageDigest     string
+	RunImageDiffIDs    []string // RunImageDiffIDs are the layers of the run image, read by strict validation
 	OrigMetadata       platform.LayersMetadata
+	OrigAppIndex       []layers.SliceIndex // OrigAppIndex indexes the app layers of the previous image, it is read from the cache
 	AdditionalNames    []string
 	LauncherConfig     LauncherConfig
 	Stack              platform.StackMetadata
 	Project            platform.ProjectMetadata
 	DefaultProcessType string
+	StrictValidation   bool            // StrictValidation fails the export when the processes or launch environment have problems and reads the run image layers to find them
+	CacheImageDiffIDs  map[string]bool // CacheImageDiffIDs are the layers of the cache image, reusable when WorkingImage was created from the cache image
 }
 
 func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
@@ -84,6 +97,7 @@ func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
 	}
 
 	meta.RunImage.Reference = opts.RunImageRef
+	meta.RunImage.Digest = opts.RunImageDigest
 	meta.Stack = opts.Stack
 
 	buildMD := &platform.BuildMetadata{}
@@ -91,6 +105,43 @@ func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
 		return platform.ExportReport{}, errors.Wrap(err, "read build metadata")
 	}
 
+	if err := e.checkShell(opts, buildMD.ToLaunchMD()); err != nil {
+		return platform.ExportReport{}, err
+	}
+
+	findings, err := e.validateLaunch(opts, buildMD.ToLaunchMD())
+	if err != nil {
+		return platform.ExportReport{}, errors.Wrap(err, "validating processes and launch environment")
+	}
+	for _, finding := range findings {
+		e.Logger.Warnf("Validation: %s", finding.Message)
+	}
+	if opts.StrictValidation && len(findings) > 0 {
+		return platform.ExportReport{}, fmt.Errorf("found %d problem(s) with the processes or launch environment", len(findings))
+	}
+
+	restoreMetrics, err := readRestoreMetrics(opts.LayersDir)
+	if err != nil {
+		e.Logger.Warnf("Failed to read restore metrics: %s", err)
+	}
+	e.metrics.merge(restoreMetrics)
+
+	// layers quarantined by the restorer are corrupt in the cache, so they are not reused from the cache image
+	quarantined, err := readQuarantinedLayers(opts.LayersDir)
+	if err != nil {
+		e.Logger.Warnf("Failed to read quarantined layers: %s", err)
+	}
+	if len(quarantined) > 0 && len(opts.CacheImageDiffIDs) > 0 {
+		diffIDs := map[string]bool{}
+		for diffID := range opts.CacheImageDiffIDs {
+			diffIDs[diffID] = true
+		}
+		for _, diffID := range quarantined {
+			delete(diffIDs, diffID)
+		}
+		opts.CacheImageDiffIDs = diffIDs
+	}
+
 	// buildpack-provided layers
 	if err := e.addBuildpackLayers(opts, &meta); err != nil {
 		return platform.ExportReport{}, err
@@ -135,12 +186,19 @@ func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
 		return platform.ExportReport{}, errors.Wrap(err, "setting cmd")
 	}
 
+	if err := e.setHealthcheck(opts, buildMD.ToLaunchMD(), entrypoint); err != nil {
+		return platform.ExportReport{}, errors.Wrap(err, "setting healthcheck")
+	}
+
 	report := platform.ExportReport{}
+	cacheReport := e.CacheReport()
+	report.Cache = &cacheReport
 	report.Build, err = e.makeBuildReport(opts.LayersDir)
 	if err != nil {
 		return platform.ExportReport{}, err
 	}
-	report.Image, err = saveImage(opts.WorkingImage, opts.AdditionalNames, e.Logger)
+	report.Validation = findings
+	report.Image, err = saveImage(opts.WorkingImage, opts.AdditionalNames, e.Retry, e.Logger)
 	if err != nil {
 		return platform.ExportReport{}, err
 	}
@@ -148,10 +206,16 @@ func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
 		// unset manifest size in report.toml for old platform API versions
 		report.Image.ManifestSize = 0
 	}
+	report.Image.RunImageDigest = opts.RunImageDigest
 
 	return report, nil
 }
 
+// CacheReport returns the cache metrics of the restorer and of the buildpack layers exported so far
+func (e *Exporter) CacheReport() platform.CacheReport {
+	return e.metrics.report()
+}
+
 func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *platform.LayersMetadata) error {
 	for _, bp := range e.Buildpacks {
 		bpDir, err := readBuildpackLayersDir(opts.LayersDir, bp, e.Logger)
@@ -177,10 +241,27 @@ func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *platform.LayersM
 					return errors.Wrapf(err, "creating layer")
 				}
 				origLayerMetadata := opts.OrigMetadata.MetadataForBuildpack(bp.ID).Layers[fsLayer.name()]
-				lmd.SHA, err = e.addOrReuseLayer(opts.WorkingImage, layer, origLayerMetadata.SHA)
+				previousSHA := origLayerMetadata.SHA
+				if layer.Digest != previousSHA && opts.CacheImageDiffIDs[layer.Digest] {
+					e.Logger.Debugf("Layer '%s' is in the cache image\n", fsLayer.Identifier())
+					previousSHA = layer.Digest
+				}
+				lmd.SHA, err = e.addOrReuseLayer(opts.WorkingImage, layer, previousSHA)
+				if err != nil && previousSHA != origLayerMetadata.SHA {
+					// the cache image may not be readable with the credentials of the app image
+					e.Logger.Debugf("Unable to reuse layer '%s' from the cache image: %s\n", fsLayer.Identifier(), err)
+					previousSHA = origLayerMetadata.SHA
+					lmd.SHA, err = e.addOrReuseLayer(opts.WorkingImage, layer, previousSHA)
+				}
 				if err != nil {
 					return err
 				}
+				size := fileSize(layer.TarPath)
+				if lmd.SHA == previousSHA {
+					e.metrics.add(bp.ID, lmd.LayerMetadataFile, platform.CacheMetrics{ImageReused: 1, ImageReusedBytes: size})
+				} else {
+					e.metrics.add(bp.ID, lmd.LayerMetadataFile, platform.CacheMetrics{ImageAdded: 1, ImageAddedBytes: size})
+				}
 			} else {
 				if lmd.Cache {
 					return fmt.Errorf("layer '%s' is cache=true but has no contents", fsLayer.Identifier())
@@ -196,6 +277,7 @@ func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *platform.LayersM
 					return errors.Wrapf(err, "reusing layer: '%s'", fsLayer.Identifier())
 				}
 				lmd.SHA = origLayerMetadata.SHA
+				e.metrics.add(bp.ID, lmd.LayerMetadataFile, platform.CacheMetrics{ImageReused: 1})
 			}
 			bpMD.Layers[fsLayer.name()] = lmd
 		}
@@ -237,11 +319,23 @@ func (e *Exporter) addLauncherLayers(opts ExportOptions, buildMD *platform.Build
 }
 
 func (e *Exporter) addAppLayers(opts ExportOptions, slices []layers.Slice, meta *platform.LayersMetadata) error {
+	// only layers in the previous image can be reused, so the factory only skips writing those
+	var origIndex []layers.SliceIndex
+	for _, index := range opts.OrigAppIndex {
+		for _, previous := range opts.OrigMetadata.App {
+			if index.Digest == previous.SHA {
+				origIndex = append(origIndex, index)
+				break
+			}
+		}
+	}
+
 	// creating app layers (slices + app dir)
-	sliceLayers, err := e.LayerFactory.SliceLayers(opts.AppDir, slices)
+	sliceLayers, appIndex, err := e.LayerFactory.SliceLayersWithIndex(opts.AppDir, slices, origIndex)
 	if err != nil {
 		return errors.Wrap(err, "creating app layers")
 	}
+	e.appIndex = appIndex
 
 	var numberOfReusedLayers int
 	for _, slice := range sliceLayers {
@@ -396,6 +490,44 @@ func (e *Exporter) entrypoint(launchMD launch.Metadata, userDefaultProcessType,
 	return launch.ProcessPath(buildpackDefaultProcessType), nil
 }
 
+// HealthcheckImage is implemented by images whose health check can be set, such as registry and daemon images
+type HealthcheckImage interface {
+	SetHealthcheck(config *v1.HealthConfig) error
+}
+
+// setHealthcheck sets the image health check to run the launcher health check of the default process,
+// if the default process declares one
+func (e *Exporter) setHealthcheck(opts ExportOptions, launchMD launch.Metadata, entrypoint string) error {
+	var defaultProcess *launch.Process
+	for i, proc := range launchMD.Processes {
+		if entrypoint == launch.ProcessPath(proc.Type) {
+			defaultProcess = &launchMD.Processes[i]
+		}
+	}
+	if defaultProcess == nil || defaultProcess.HealthCheck == nil {
+		return nil
+	}
+	timings, err := defaultProcess.HealthCheck.Timings()
+	if err != nil {
+		return errors.Wrapf(err, "health check for process type '%s'", defaultProcess.Type)
+	}
+	config := &v1.HealthConfig{
+		Test:        []string{"CMD", launch.LauncherPath, launch.HealthCheckFlag, defaultProcess.Type},
+		Interval:    timings.Interval,
+		Timeout:     timings.Timeout,
+		StartPeriod: timings.StartPeriod,
+		Retries:     defaultProcess.HealthCheck.Retries,
+	}
+	e.Logger.Debugf("Setting HEALTHCHECK: '%s'", strings.Join(config.Test[1:], " "))
+	hcImage, ok := opts.WorkingImage.(HealthcheckImage)
+	if !ok {
+		e.Logger.Warnf("Unable to set HEALTHCHECK for process type '%s': image type %T does not support health checks", defaultProcess.Type, opts.WorkingImage)
+		e.Logger.Warnf("Run the container with health command '%s' to check the process", strings.Join(config.Test[1:], " "))
+		return nil
+	}
+	return hcImage.SetHealthcheck(config)
+}
+
 // processTypes adds
 func (e *Exporter) launcherConfig(opts ExportOptions, buildMD *platform.BuildMetadata, meta *platform.LayersMetadata) error {
 	if e.supportsMulticallLauncher() {
@@ -436,6 +568,91 @@ func processTypeWarning(launchMD launch.Metadata, defaultProcessType string) str
 	return fmt.Sprintf("default process type '%s' not present in list %+v", defaultProcessType, typeList)
 }
 
+// checkShell checks whether the run image has the shell needed by non-direct processes and profile scripts.
+// The launcher fails to launch non-direct processes without a shell, so checkShell warns about each of them,
+// and fails if there are profile scripts, which only a shell can source.
+// Buildpack layers are exported as they are, profile scripts are not rewritten.
+func (e *Exporter) checkShell(opts ExportOptions, launchMD launch.Metadata) error {
+	if imageOS, err := opts.WorkingImage.OS(); err != nil || imageOS == "windows" {
+		return nil
+	}
+	var nonDirect []string
+	for _, proc := range launchMD.Processes {
+		if !proc.Direct {
+			nonDirect = append(nonDirect, proc.Type)
+		}
+	}
+	if len(nonDirect) == 0 {
+		// profile scripts are only sourced for non-direct processes
+		return nil
+	}
+	if hasShell, known := e.runImageHasShell(opts); !known || hasShell {
+		return nil
+	}
+	for _, pType := range nonDirect {
+		e.Logger.Warnf("Process type '%s' is not direct but run image '%s' has no shell at %s, "+
+			"the launcher will fail to launch it", pType, opts.RunImageRef, image.ShellPath)
+	}
+	profiles, err := e.profileScripts(opts)
+	if err != nil {
+		return err
+	}
+	if len(profiles) > 0 {
+		return errors.Errorf("run image '%s' has no shell at %s to source profile scripts: %s",
+			opts.RunImageRef, image.ShellPath, strings.Join(profiles, ", "))
+	}
+	return nil
+}
+
+// runImageHasShell returns whether the run image has a shell, known is false when it cannot be determined.
+func (e *Exporter) runImageHasShell(opts ExportOptions) (hasShell bool, known bool) {
+	if len(opts.RunImageDiffIDs) == 0 {
+		e.Logger.Debugf("Not checking whether run image '%s' has a shell, its layers are not known", opts.RunImageRef)
+		return false, false
+	}
+	hasShell, err := image.HasShell(opts.WorkingImage, opts.RunImageDiffIDs)
+	if err != nil {
+		e.Logger.Warnf("Unable to determine whether run image '%s' has a shell: %s", opts.RunImageRef, err)
+		return false, false
+	}
+	return hasShell, true
+}
+
+// profileScripts returns the profile scripts that will be exported in launch layers and the app directory
+func (e *Exporter) profileScripts(opts ExportOptions) ([]string, error) {
+	var profiles []string
+	for _, bp := range e.Buildpacks {
+		bpDir, err := readBuildpackLayersDir(opts.LayersDir, bp, e.Logger)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading layers for buildpack '%s'", bp.ID)
+		}
+		for _, fsLayer := range bpDir.findLayers(forLaunch) {
+			if !fsLayer.hasLocalContents() {
+				continue
+			}
+			if err := filepath.Walk(filepath.Join(fsLayer.path, "profile.d"), func(path string, fi os.FileInfo, err error) error {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if !fi.IsDir() {
+					profiles = append(profiles, path)
+				}
+				return nil
+			}); err != nil {
+				return nil, errors.Wrapf(err, "finding profile scripts in layer '%s'", fsLayer.Identifier())
+			}
+		}
+	}
+	appProfile := filepath.Join(opts.AppDir, ".profile")
+	if fi, err := os.Stat(appProfile); err == nil && !fi.IsDir() {
+		profiles = append(profiles, appProfile)
+	}
+	return profiles, nil
+}
+
 func (e *Exporter) addOrReuseLayer(image imgutil.Image, layer layers.Layer, previousSHA string) (string, error) {
 	layer, err := e.LayerFactory.DirLayer(layer.ID, layer.TarPath)
 	if err != nil {
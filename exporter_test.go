@@ -1,10 +1,12 @@
 package lifecycle_test
 
 import (
+	"archive/tar"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,17 +16,24 @@ import (
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/memory"
+	"github.com/buildpacks/imgutil"
 	"github.com/buildpacks/imgutil/fakes"
 	"github.com/buildpacks/imgutil/local"
 	"github.com/buildpacks/imgutil/remote"
 	"github.com/golang/mock/gomock"
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/sclevine/spec"
 	specreport "github.com/sclevine/spec/report"
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/layers"
 	"github.com/buildpacks/lifecycle/platform"
@@ -122,16 +131,16 @@ func testExporter(t *testing.T, when spec.G, it spec.S) {
 
 		// if there are no slices return a single deterministic app layer
 		layerFactory.EXPECT().
-			SliceLayers(gomock.Any(), nil).
-			DoAndReturn(func(dir string, slices []layers.Slice) ([]layers.Layer, error) {
+			SliceLayersWithIndex(gomock.Any(), nil, nil).
+			DoAndReturn(func(dir string, slices []layers.Slice, _ []layers.SliceIndex) ([]layers.Layer, []layers.SliceIndex, error) {
 				if dir != opts.AppDir {
-					return nil, fmt.Errorf("SliceLayers received %s but expected %s", dir, opts.AppDir)
+					return nil, nil, fmt.Errorf("SliceLayersWithIndex received %s but expected %s", dir, opts.AppDir)
 				}
 				layer, err := createTestLayer("app", tmpDir)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
-				return []layers.Layer{layer}, nil
+				return []layers.Layer{layer}, []layers.SliceIndex{{Digest: layer.Digest}}, nil
 			}).AnyTimes()
 
 		exporter = &lifecycle.Exporter{
@@ -202,18 +211,19 @@ func testExporter(t *testing.T, when spec.G, it spec.S) {
 				it.Before(func() {
 					opts.LayersDir = filepath.Join("testdata", "exporter", "app-slices", "layers")
 					layerFactory.EXPECT().
-						SliceLayers(
+						SliceLayersWithIndex(
 							opts.AppDir,
 							[]layers.Slice{
 								{Paths: []string{"static/**/*.txt", "static/**/*.svg"}},
 								{Paths: []string{"static/misc/resources/**/*.csv", "static/misc/resources/**/*.tps"}},
 							},
+							nil,
 						).
 						Return([]layers.Layer{
 							{ID: "slice-1", Digest: "slice-1-digest"},
 							{ID: "slice-2", Digest: "slice-2-digest"},
 							{ID: "slice-3", Digest: "slice-3-digest"},
-						}, nil)
+						}, nil, nil)
 					fakeAppImage.AddPreviousLayer("slice-1-digest", "")
 					opts.OrigMetadata.App = append(opts.OrigMetadata.App, platform.LayerMetadata{SHA: "slice-1-digest"})
 				})
@@ -227,6 +237,54 @@ func testExporter(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("there is an index of the previous app layers", func() {
+				var appIndex []layers.SliceIndex
+
+				it.Before(func() {
+					appIndex = []layers.SliceIndex{
+						{Digest: "slice-1-digest", Files: []layers.FileIndex{{Path: "/workspace/some-file", SHA: "some-sha"}}},
+						{Digest: "slice-2-digest", Files: []layers.FileIndex{{Path: "/workspace/other-file", SHA: "other-sha"}}},
+					}
+					layerFactory.EXPECT().
+						SliceLayersWithIndex(opts.AppDir, nil, appIndex[:1]).
+						Return([]layers.Layer{{ID: "slice-1", Digest: "slice-1-digest"}}, appIndex[:1], nil)
+					fakeAppImage.AddPreviousLayer("slice-1-digest", "")
+					opts.OrigMetadata.App = []platform.LayerMetadata{{SHA: "slice-1-digest"}}
+					opts.OrigAppIndex = appIndex
+				})
+
+				it("reuses the layers of the previous image that have the same files", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					h.AssertContains(t, fakeAppImage.ReusedLayers(), "slice-1-digest")
+					assertLogEntry(t, logHandler, "Reusing 1/1 app layer(s)")
+				})
+
+				it("caches the index of the exported app layers", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					cacheDir, err := ioutil.TempDir("", "lifecycle.exporter.cache")
+					h.AssertNil(t, err)
+					defer os.RemoveAll(cacheDir)
+					volumeCache, err := cache.NewVolumeCache(cacheDir)
+					h.AssertNil(t, err)
+					defer volumeCache.Close()
+					factory := &layers.Factory{ArtifactsDir: tmpDir, Logger: exporter.Logger}
+					var indexLayer layers.Layer
+					layerFactory.EXPECT().AppIndexLayer(appIndex[:1]).DoAndReturn(func(index []layers.SliceIndex) (layers.Layer, error) {
+						indexLayer, err = factory.AppIndexLayer(index)
+						return indexLayer, err
+					})
+					h.AssertNil(t, exporter.Cache(opts.LayersDir, volumeCache))
+
+					cacheMD, err := volumeCache.RetrieveMetadata()
+					h.AssertNil(t, err)
+					h.AssertEq(t, cacheMD.AppIndex, indexLayer.Digest)
+					h.AssertEq(t, lifecycle.RetrieveAppIndex(volumeCache, cacheMD, exporter.Logger), appIndex[:1])
+				})
+			})
+
 			it("creates app layer on Run image", func() {
 				_, err := exporter.Export(opts)
 				h.AssertNil(t, err)
@@ -310,6 +368,46 @@ func testExporter(t *testing.T, when spec.G, it spec.S) {
 				assertAddLayerLog(t, logHandler, "other.buildpack.id:new-launch-layer")
 			})
 
+			it("reports reused and added buildpack layers", func() {
+				report, err := exporter.Export(opts)
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, report.Cache.ImageReused, 2)
+				h.AssertEq(t, report.Cache.ImageAdded, 2)
+				h.AssertEq(t, report.Cache.CacheReused, 0)
+				h.AssertEq(t, report.Cache.CacheAdded, 0)
+				h.AssertEq(t, len(report.Cache.Buildpacks), 2)
+				for _, bp := range report.Cache.Buildpacks {
+					h.AssertEq(t, bp.ImageReused, 1)
+					h.AssertEq(t, bp.ImageAdded, 1)
+					h.AssertEq(t, bp.Types["launch"].ImageReused+bp.Types["launch"].ImageAdded, 2)
+				}
+			})
+
+			it("includes the metrics of the restorer in the report", func() {
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(opts.LayersDir, "restore-metrics.toml"), []byte(`
+hits = 1
+hit-bytes = 1024
+misses = 1
+
+[[buildpacks]]
+  id = "buildpack.id"
+  hits = 1
+  hit-bytes = 1024
+  misses = 1
+`), 0600))
+
+				report, err := exporter.Export(opts)
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, report.Cache.Hits, 1)
+				h.AssertEq(t, report.Cache.HitBytes, int64(1024))
+				h.AssertEq(t, report.Cache.Misses, 1)
+				h.AssertEq(t, report.Cache.Buildpacks[0].ID, "buildpack.id")
+				h.AssertEq(t, report.Cache.Buildpacks[0].Hits, 1)
+				h.AssertEq(t, report.Cache.Buildpacks[0].ImageReused, 1)
+			})
+
 			it("only adds expected layers", func() {
 				_, err := exporter.Export(opts)
 				h.AssertNil(t, err)
@@ -757,17 +855,18 @@ version = "4.5.6"
 			when("there are slices", func() {
 				it.Before(func() {
 					opts.LayersDir = filepath.Join("testdata", "exporter", "app-slices", "layers")
-					layerFactory.EXPECT().SliceLayers(
+					layerFactory.EXPECT().SliceLayersWithIndex(
 						opts.AppDir,
 						[]layers.Slice{
 							{Paths: []string{"static/**/*.txt", "static/**/*.svg"}},
 							{Paths: []string{"static/misc/resources/**/*.csv", "static/misc/resources/**/*.tps"}},
 						},
+						nil,
 					).Return([]layers.Layer{
 						{ID: "slice-1", Digest: "slice-1-digest"},
 						{ID: "slice-2", Digest: "slice-2-digest"},
 						{ID: "slice-3", Digest: "slice-3-digest"},
-					}, nil)
+					}, nil, nil)
 				})
 
 				it("exports slice layers", func() {
@@ -801,6 +900,37 @@ version = "4.5.6"
 				assertAddLayerLog(t, logHandler, "launcher")
 			})
 
+			when("saving one of the names fails with a transient error", func() {
+				it("saves only the failed name again", func() {
+					registry := h.NewFaultyRegistry()
+					defer registry.Close()
+					runImage, err := random.Image(1024, 1)
+					h.AssertNil(t, err)
+					runConfig, err := runImage.ConfigFile()
+					h.AssertNil(t, err)
+					runConfig.OS, runConfig.Architecture = "linux", "amd64"
+					runImage, err = mutate.ConfigFile(runImage, runConfig)
+					h.AssertNil(t, err)
+					runImageRef, err := name.ParseReference(registry.Host() + "/some/run")
+					h.AssertNil(t, err)
+					h.AssertNil(t, ggcrremote.Write(runImageRef, runImage))
+					appImage, err := remote.NewImage(registry.Host()+"/some/app", authn.DefaultKeychain, remote.FromBaseImage(runImageRef.Name()))
+					h.AssertNil(t, err)
+					opts.WorkingImage = appImage
+					opts.AdditionalNames = []string{registry.Host() + "/other/app"}
+					exporter.Retry = lifecycle.Retry{Retries: 2, Backoff: time.Millisecond}
+					registry.FailNext(http.MethodPut, "/other/app/manifests/", 1, http.StatusServiceUnavailable)
+
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, registry.Requests(http.MethodPut, "/some/app/manifests/"), 1)
+					h.AssertEq(t, registry.Requests(http.MethodPut, "/other/app/manifests/"), 2)
+					h.AssertEq(t, report.Image.Tags, []string{registry.Host() + "/some/app", registry.Host() + "/other/app"})
+					h.AssertEq(t, appImage.Name(), registry.Host()+"/some/app")
+				})
+			})
+
 			when("platform API >= 0.4", func() {
 				it("creates process-types layer", func() {
 					_, err := exporter.Export(opts)
@@ -831,6 +961,29 @@ version = "4.5.6"
 				assertAddLayerLog(t, logHandler, "buildpack.id:layer2")
 			})
 
+			it("reports a launch and cache layer separately for the image and the cache", func() {
+				_, err := exporter.Export(opts)
+				h.AssertNil(t, err)
+				cacheDir, err := ioutil.TempDir("", "lifecycle.exporter.cache")
+				h.AssertNil(t, err)
+				defer os.RemoveAll(cacheDir)
+				volumeCache, err := cache.NewVolumeCache(cacheDir)
+				h.AssertNil(t, err)
+				defer volumeCache.Close()
+				layerFactory.EXPECT().AppIndexLayer(gomock.Any()).DoAndReturn(func(_ []layers.SliceIndex) (layers.Layer, error) {
+					return createTestLayer("app-index", tmpDir)
+				})
+				h.AssertNil(t, exporter.Cache(opts.LayersDir, volumeCache))
+
+				report := exporter.CacheReport()
+				h.AssertEq(t, report.ImageAdded, 2)
+				h.AssertEq(t, report.ImageReused, 0)
+				h.AssertEq(t, report.CacheAdded, 1)
+				h.AssertEq(t, report.CacheReused, 0)
+				h.AssertEq(t, report.Buildpacks[0].Types["cache"].ImageAdded, 1)
+				h.AssertEq(t, report.Buildpacks[0].Types["cache"].CacheAdded, 1)
+			})
+
 			it("only creates expected layers", func() {
 				_, err := exporter.Export(opts)
 				h.AssertNil(t, err)
@@ -844,6 +997,54 @@ version = "4.5.6"
 				h.AssertEq(t, fakeAppImage.NumberOfAddedLayers(), 6)
 			})
 
+			when("the layers are in the cache image", func() {
+				it.Before(func() {
+					fakeAppImage.AddPreviousLayer("layer1-digest", "")
+					opts.CacheImageDiffIDs = map[string]bool{"layer1-digest": true}
+				})
+
+				it("reuses them instead of adding them", func() {
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					assertReuseLayerLog(t, logHandler, "buildpack.id:layer1")
+					assertAddLayerLog(t, logHandler, "buildpack.id:layer2")
+					h.AssertEq(t, fakeAppImage.ReusedLayers(), []string{"layer1-digest"})
+					h.AssertEq(t, report.Cache.ImageReused, 1)
+					h.AssertEq(t, report.Cache.ImageAdded, 1)
+				})
+
+				when("the cache image layers cannot be reused", func() {
+					it.Before(func() {
+						opts.CacheImageDiffIDs["layer2-digest"] = true
+					})
+
+					it("adds them", func() {
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+
+						assertHasLayer(t, fakeAppImage, "buildpack.id:layer2")
+						assertAddLayerLog(t, logHandler, "buildpack.id:layer2")
+					})
+				})
+
+				when("the restorer quarantined a layer", func() {
+					it.Before(func() {
+						h.AssertNil(t, ioutil.WriteFile(filepath.Join(opts.LayersDir, "quarantine.toml"), []byte(`layers = ["layer1-digest"]`), 0644))
+					})
+
+					it("adds it instead of reusing it from the cache image", func() {
+						report, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+
+						assertAddLayerLog(t, logHandler, "buildpack.id:layer1")
+						h.AssertEq(t, len(fakeAppImage.ReusedLayers()), 0)
+						h.AssertEq(t, report.Cache.ImageReused, 0)
+						h.AssertEq(t, report.Cache.ImageAdded, 2)
+					})
+				})
+			})
+
 			it("saves metadata with layer info", func() {
 				_, err := exporter.Export(opts)
 				h.AssertNil(t, err)
@@ -1052,6 +1253,85 @@ version = "4.5.6"
 				})
 			})
 
+			when("the default process declares a health check", func() {
+				var healthCheck = &launch.HealthCheck{Type: "http", Path: "/healthz", Interval: "10s", Retries: 3}
+
+				it.Before(func() {
+					h.RecursiveCopy(t, filepath.Join("testdata", "exporter", "default-process", "metadata-with-health-check", "layers"), opts.LayersDir)
+					layerFactory.EXPECT().
+						ProcessTypesLayer(launch.Metadata{
+							Processes: []launch.Process{
+								{
+									Type:        "some-process-type",
+									Command:     "/some/command",
+									Args:        []string{"some", "command", "args"},
+									Direct:      true,
+									BuildpackID: "buildpack.id",
+									HealthCheck: healthCheck,
+								}},
+						}).
+						DoAndReturn(func(_ launch.Metadata) (layers.Layer, error) {
+							return createTestLayer("process-types", tmpDir)
+						}).
+						AnyTimes()
+				})
+
+				it("sets the HEALTHCHECK to the launcher health check for the process type", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, fakeAppImage.Healthcheck(), &v1.HealthConfig{
+						Test:     []string{"CMD", filepath.Join(rootDir, "cnb", "lifecycle", "launcher"+execExt), "--health-check", "some-process-type"},
+						Interval: 10 * time.Second,
+						Retries:  3,
+					})
+				})
+
+				it("writes the HEALTHCHECK to the config of the saved image", func() {
+					registry := h.NewFaultyRegistry()
+					defer registry.Close()
+					runImage, err := random.Image(1024, 1)
+					h.AssertNil(t, err)
+					runConfig, err := runImage.ConfigFile()
+					h.AssertNil(t, err)
+					runConfig.OS, runConfig.Architecture = "linux", "amd64"
+					runImage, err = mutate.ConfigFile(runImage, runConfig)
+					h.AssertNil(t, err)
+					runImageRef, err := name.ParseReference(registry.Host() + "/some/run")
+					h.AssertNil(t, err)
+					h.AssertNil(t, ggcrremote.Write(runImageRef, runImage))
+					appImage, err := remote.NewImage(registry.Host()+"/some/app", authn.DefaultKeychain, remote.FromBaseImage(runImageRef.Name()))
+					h.AssertNil(t, err)
+					opts.WorkingImage = appImage
+					opts.AdditionalNames = nil
+
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					ref, err := name.ParseReference(registry.Host()+"/some/app@"+report.Image.Digest, name.WeakValidation)
+					h.AssertNil(t, err)
+					saved, err := ggcrremote.Image(ref)
+					h.AssertNil(t, err)
+					configFile, err := saved.ConfigFile()
+					h.AssertNil(t, err)
+					h.AssertEq(t, configFile.Config.Healthcheck, &v1.HealthConfig{
+						Test:     []string{"CMD", filepath.Join(rootDir, "cnb", "lifecycle", "launcher"+execExt), "--health-check", "some-process-type"},
+						Interval: 10 * time.Second,
+						Retries:  3,
+					})
+					h.AssertEq(t, registry.Requests(http.MethodPut, "/some/app/manifests/"), 1)
+				})
+
+				it("warns when the image does not support health checks", func() {
+					opts.WorkingImage = &noHealthcheckImage{Image: fakeAppImage}
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					assertLogEntry(t, logHandler, "Unable to set HEALTHCHECK for process type 'some-process-type'")
+				})
+			})
+
 			when("platform API < 0.6", func() {
 				it.Before(func() {
 					exporter.PlatformAPI = api.MustParse("0.5")
@@ -1113,6 +1393,212 @@ version = "4.5.6"
 			})
 		})
 
+		when("validation", func() {
+			var runImageLayer string
+
+			writeFile := func(path, contents string, mode os.FileMode) {
+				t.Helper()
+				h.AssertNil(t, os.MkdirAll(filepath.Dir(path), 0755))
+				h.AssertNil(t, ioutil.WriteFile(path, []byte(contents), mode))
+			}
+
+			writeProcesses := func(processes string) {
+				t.Helper()
+				writeFile(filepath.Join(opts.LayersDir, "config", "metadata.toml"), processes, 0644)
+			}
+
+			it.Before(func() {
+				h.RecursiveCopy(t, filepath.Join("testdata", "exporter", "previous-image-not-exist", "layers"), opts.LayersDir)
+				h.AssertNil(t, os.MkdirAll(opts.AppDir, 0755))
+				writeFile(filepath.Join(opts.LayersDir, "other.buildpack.id", "layer3.toml"), "[types]\n  launch = true\n", 0644)
+				h.AssertNil(t, os.MkdirAll(filepath.Join(opts.LayersDir, "other.buildpack.id", "layer3"), 0755))
+				h.AssertNil(t, fakeAppImage.SetEnv("PATH", "/usr/bin:/bin"))
+				layerFactory.EXPECT().ProcessTypesLayer(gomock.Any()).
+					DoAndReturn(func(_ launch.Metadata) (layers.Layer, error) {
+						return createTestLayer("process-types", tmpDir)
+					}).
+					AnyTimes()
+
+				runImageLayer = filepath.Join(tmpDir, "run-layer.tar")
+				f, err := os.Create(runImageLayer)
+				h.AssertNil(t, err)
+				tw := tar.NewWriter(f)
+				h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "usr/bin/run-image-binary", Typeflag: tar.TypeReg, Mode: 0755}))
+				h.AssertNil(t, tw.Close())
+				h.AssertNil(t, f.Close())
+				h.AssertNil(t, fakeAppImage.AddLayerWithDiffID(runImageLayer, "sha256:run-layer"))
+				opts.RunImageDiffIDs = []string{"sha256:run-layer"}
+			})
+
+			it("reports direct commands that are not in the launch PATH when validation is strict", func() {
+				writeFile(filepath.Join(opts.LayersDir, "buildpack.id", "layer1", "bin", "layer-binary"), "", 0755)
+				writeProcesses(`[[processes]]
+  type = "layer"
+  command = "layer-binary"
+  direct = true
+  buildpack-id = "buildpack.id"
+[[processes]]
+  type = "run-image"
+  command = "run-image-binary"
+  direct = true
+  buildpack-id = "buildpack.id"
+[[processes]]
+  type = "missing"
+  command = "missing-binary"
+  direct = true
+  buildpack-id = "other.buildpack.id"
+[[processes]]
+  type = "not-direct"
+  command = "missing-binary"
+  buildpack-id = "other.buildpack.id"
+`)
+
+				report, err := exporter.Export(opts)
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, len(report.Validation), 0)
+				assertLogEntry(t, logHandler, "Not checking command 'missing-binary' for process type 'missing' in the run image layers, validation is not strict")
+
+				opts.StrictValidation = true
+				_, err = exporter.Export(opts)
+				h.AssertError(t, err, "found 1 problem(s) with the processes or launch environment")
+				assertLogEntry(t, logHandler, "Validation: command 'missing-binary' for direct process type 'missing' was not found in the launch PATH")
+			})
+
+			when("a launch layer is reused", func() {
+				it.Before(func() {
+					writeFile(filepath.Join(opts.LayersDir, "buildpack.id", "reused-layer.toml"), "[types]\n  launch = true\n", 0644)
+					fakeAppImage.AddPreviousLayer("reused-layer-digest", "")
+					opts.OrigMetadata.Buildpacks = []platform.BuildpackLayersMetadata{{
+						ID:     "buildpack.id",
+						Layers: map[string]platform.BuildpackLayerMetadata{"reused-layer": {LayerMetadata: platform.LayerMetadata{SHA: "reused-layer-digest"}}},
+					}}
+					opts.StrictValidation = true
+				})
+
+				it("does not check commands that may be in the reused layer", func() {
+					writeProcesses(`[[processes]]
+  type = "reused"
+  command = "reused-binary"
+  direct = true
+  buildpack-id = "buildpack.id"
+`)
+
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, len(report.Validation), 0)
+					assertLogEntry(t, logHandler, "Unable to check command 'reused-binary' for process type 'reused', it may be in reused layer(s) 'buildpack.id:reused-layer'")
+				})
+
+				it("checks commands that are not in the reused layer", func() {
+					writeProcesses(`[[processes]]
+  type = "app"
+  command = "bin/missing-binary"
+  direct = true
+  buildpack-id = "buildpack.id"
+[[processes]]
+  type = "absolute"
+  command = "` + filepath.Join(opts.LayersDir, "other.buildpack.id", "layer3", "missing-binary") + `"
+  direct = true
+  buildpack-id = "other.buildpack.id"
+`)
+
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "found 2 problem(s) with the processes or launch environment")
+					assertLogEntry(t, logHandler, "Validation: command 'bin/missing-binary' for direct process type 'app' was not found in the launch PATH")
+				})
+			})
+
+			it("reports processes that reference buildpacks that are not in the group", func() {
+				writeProcesses(`[[processes]]
+  type = "web"
+  command = "some-command"
+  buildpack-id = "missing.buildpack.id"
+`)
+
+				report, err := exporter.Export(opts)
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, report.Validation, []platform.ValidationFinding{{
+					Type:        platform.ValidationUnknownBuildpack,
+					ProcessType: "web",
+					Buildpacks:  []string{"missing.buildpack.id"},
+					Message:     "process type 'web' references buildpack 'missing.buildpack.id' which is not in the group",
+				}})
+			})
+
+			it("reports launch environment variables set by more than one buildpack", func() {
+				writeProcesses(`[[processes]]
+  type = "web"
+  command = "some-command"
+  buildpack-id = "buildpack.id"
+`)
+				writeFile(filepath.Join(opts.LayersDir, "buildpack.id", "layer1", "env.launch", "SOME_VAR"), "some-value", 0644)
+				writeFile(filepath.Join(opts.LayersDir, "buildpack.id", "layer1", "env.launch", "DEFAULT_VAR.default"), "some-value", 0644)
+				writeFile(filepath.Join(opts.LayersDir, "buildpack.id", "layer1", "env.launch", "APPENDED_VAR.append"), "some-value", 0644)
+				writeFile(filepath.Join(opts.LayersDir, "buildpack.id", "layer1", "env.launch", "web", "WEB_VAR.default"), "some-value", 0644)
+				writeFile(filepath.Join(opts.LayersDir, "other.buildpack.id", "layer3", "env", "SOME_VAR.override"), "other-value", 0644)
+				writeFile(filepath.Join(opts.LayersDir, "other.buildpack.id", "layer3", "env", "DEFAULT_VAR.default"), "other-value", 0644)
+				writeFile(filepath.Join(opts.LayersDir, "other.buildpack.id", "layer3", "env.launch", "APPENDED_VAR.append"), "other-value", 0644)
+				writeFile(filepath.Join(opts.LayersDir, "other.buildpack.id", "layer3", "env.launch", "WEB_VAR"), "other-value", 0644)
+
+				report, err := exporter.Export(opts)
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, report.Validation, []platform.ValidationFinding{
+					{
+						Type:       platform.ValidationEnvConflict,
+						Name:       "DEFAULT_VAR",
+						Buildpacks: []string{"buildpack.id", "other.buildpack.id"},
+						Message:    "environment variable 'DEFAULT_VAR' is set by buildpacks 'buildpack.id', 'other.buildpack.id', only the value from 'buildpack.id' is used",
+					},
+					{
+						Type:       platform.ValidationEnvConflict,
+						Name:       "SOME_VAR",
+						Buildpacks: []string{"buildpack.id", "other.buildpack.id"},
+						Message:    "environment variable 'SOME_VAR' is set by buildpacks 'buildpack.id', 'other.buildpack.id', only the value from 'other.buildpack.id' is used",
+					},
+					{
+						Type:        platform.ValidationEnvConflict,
+						ProcessType: "web",
+						Name:        "WEB_VAR",
+						Buildpacks:  []string{"buildpack.id", "other.buildpack.id"},
+						Message:     "environment variable 'WEB_VAR' is set by buildpacks 'buildpack.id', 'other.buildpack.id', only the value from 'other.buildpack.id' is used for process type 'web'",
+					},
+				})
+			})
+
+			when("validation is strict", func() {
+				it.Before(func() {
+					opts.StrictValidation = true
+				})
+
+				it("fails when there are findings", func() {
+					writeProcesses(`[[processes]]
+  type = "web"
+  command = "some-command"
+  buildpack-id = "missing.buildpack.id"
+`)
+
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "found 1 problem(s) with the processes or launch environment")
+				})
+
+				it("succeeds when there are no findings", func() {
+					writeProcesses(`[[processes]]
+  type = "web"
+  command = "run-image-binary"
+  direct = true
+  buildpack-id = "buildpack.id"
+`)
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+				})
+			})
+		})
+
 		when("report.toml", func() {
 			when("checking the image manifest", func() {
 				var fakeRemoteManifestSize int64
@@ -1177,6 +1663,162 @@ version = "4.5.6"
 				})
 			})
 
+			when("run image is pinned to a digest", func() {
+				var runImageDigest = "sha256:a27a27006b74a056bed5d9edcebc394783880abe8691a8c87c78b7cffa6fa5ad"
+
+				it.Before(func() {
+					opts.LayersDir = filepath.Join("testdata", "exporter", "empty-metadata", "layers")
+					opts.RunImageDigest = runImageDigest
+				})
+
+				it("adds the run image digest to the metadata label", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					var meta platform.LayersMetadata
+					h.AssertNil(t, lifecycle.DecodeLabel(fakeAppImage, platform.LayerMetadataLabel, &meta))
+					h.AssertEq(t, meta.RunImage.Digest, runImageDigest)
+				})
+
+				it("adds the run image digest to the report", func() {
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, report.Image.RunImageDigest, runImageDigest)
+				})
+			})
+
+			when("the run image layers are known", func() {
+				var profilePath string
+
+				addRunImageLayer := func(headers ...*tar.Header) {
+					diffID := fmt.Sprintf("sha256:run-layer-%d", len(opts.RunImageDiffIDs))
+					layerPath := filepath.Join(tmpDir, diffID[len("sha256:"):]+".tar")
+					f, err := os.Create(layerPath)
+					h.AssertNil(t, err)
+					tw := tar.NewWriter(f)
+					// the direct process in the layers dir runs /some/command from the run image
+					headers = append(headers, &tar.Header{Name: "some/command", Typeflag: tar.TypeReg, Mode: 0755})
+					for _, hdr := range headers {
+						h.AssertNil(t, tw.WriteHeader(hdr))
+					}
+					h.AssertNil(t, tw.Close())
+					h.AssertNil(t, f.Close())
+					h.AssertNil(t, fakeAppImage.AddLayerWithDiffID(layerPath, diffID))
+					opts.RunImageDiffIDs = append(opts.RunImageDiffIDs, diffID)
+				}
+				file := func(name string) *tar.Header {
+					return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0755}
+				}
+
+				it.Before(func() {
+					h.RecursiveCopy(t, filepath.Join("testdata", "exporter", "previous-image-not-exist", "layers"), opts.LayersDir)
+					h.AssertNil(t, ioutil.WriteFile(filepath.Join(opts.LayersDir, "config", "metadata.toml"), []byte(`
+[[processes]]
+  type = "some-process-type"
+  direct = true
+  command = "/some/command"
+  buildpack-id = "buildpack.id"
+
+[[processes]]
+  type = "web"
+  command = "some-command"
+  buildpack-id = "buildpack.id"
+`), 0644))
+					layerFactory.EXPECT().
+						ProcessTypesLayer(gomock.Any()).
+						DoAndReturn(func(_ launch.Metadata) (layers.Layer, error) {
+							return createTestLayer("process-types", tmpDir)
+						}).
+						AnyTimes()
+					profilePath = filepath.Join(opts.LayersDir, "buildpack.id", "layer1", "profile.d", "some-profile")
+					h.AssertNil(t, os.MkdirAll(filepath.Dir(profilePath), 0755))
+				})
+
+				when("the run image has no shell", func() {
+					it.Before(func() {
+						addRunImageLayer(file("etc/passwd"), file("usr/bin/some-binary"))
+					})
+
+					it("warns that non-direct processes cannot be launched", func() {
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+
+						assertLogEntry(t, logHandler, "Process type 'web' is not direct but run image 'run-image-reference' has no shell at /bin/bash, the launcher will fail to launch it")
+					})
+
+					it("fails when there are profile scripts and leaves them in place", func() {
+						h.AssertNil(t, ioutil.WriteFile(profilePath, []byte("export SOME_VAR=some-value\n"), 0644))
+
+						_, err := exporter.Export(opts)
+						h.AssertError(t, err, fmt.Sprintf("run image 'run-image-reference' has no shell at /bin/bash to source profile scripts: %s", profilePath))
+						h.AssertPathExists(t, profilePath)
+						h.AssertPathDoesNotExist(t, filepath.Join(opts.LayersDir, "buildpack.id", "layer1", "env.launch"))
+					})
+
+					it("fails when the app has a profile script", func() {
+						h.AssertNil(t, os.MkdirAll(opts.AppDir, 0755))
+						h.AssertNil(t, ioutil.WriteFile(filepath.Join(opts.AppDir, ".profile"), []byte("export SOME_VAR=some-value\n"), 0644))
+
+						_, err := exporter.Export(opts)
+						h.AssertError(t, err, "run image 'run-image-reference' has no shell at /bin/bash to source profile scripts")
+					})
+
+					when("every process is direct", func() {
+						it.Before(func() {
+							h.RecursiveCopy(t, filepath.Join("testdata", "exporter", "previous-image-not-exist", "layers", "config"), filepath.Join(opts.LayersDir, "config"))
+						})
+
+						it("exports profile scripts, which are not sourced", func() {
+							h.AssertNil(t, ioutil.WriteFile(profilePath, []byte("echo some-output\n"), 0644))
+
+							_, err := exporter.Export(opts)
+							h.AssertNil(t, err)
+						})
+					})
+				})
+
+				when("the run image has a shell", func() {
+					it.Before(func() {
+						addRunImageLayer(file("./bin/bash"))
+					})
+
+					it("exports profile scripts", func() {
+						h.AssertNil(t, ioutil.WriteFile(profilePath, []byte("echo some-output\n"), 0644))
+
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+					})
+				})
+
+				when("the run image has a shell in a merged /usr", func() {
+					it.Before(func() {
+						addRunImageLayer(&tar.Header{Name: "bin", Typeflag: tar.TypeSymlink, Linkname: "usr/bin"}, file("usr/bin/bash"))
+					})
+
+					it("exports profile scripts", func() {
+						h.AssertNil(t, ioutil.WriteFile(profilePath, []byte("echo some-output\n"), 0644))
+
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+					})
+				})
+
+				when("the shell is deleted by a higher layer", func() {
+					it.Before(func() {
+						addRunImageLayer(file("bin/bash"))
+						addRunImageLayer(file("bin/.wh.bash"))
+					})
+
+					it("fails when there are profile scripts", func() {
+						h.AssertNil(t, ioutil.WriteFile(profilePath, []byte("echo some-output\n"), 0644))
+
+						_, err := exporter.Export(opts)
+						h.AssertError(t, err, "run image 'run-image-reference' has no shell at /bin/bash")
+					})
+				})
+			})
+
 			when("image has a digest identifier", func() {
 				var fakeRemoteDigest = "sha256:c27a27006b74a056bed5d9edcebc394783880abe8691a8c87c78b7cffa6fa5ad"
 
@@ -1202,6 +1844,44 @@ version = "4.5.6"
 
 					h.AssertEq(t, report.Image.Digest, fakeRemoteDigest)
 				})
+
+				it("does not add registries to the report when all names are on one registry", func() {
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, len(report.Image.Registries), 0)
+				})
+
+				when("names are on multiple registries", func() {
+					it.Before(func() {
+						opts.AdditionalNames = []string{"some-repo/app-image:foo", "dr.example.com/some-repo/app-image", "dr.example.com/some-repo/app-image:foo"}
+					})
+
+					it("saves the image to every registry", func() {
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+
+						h.AssertContains(t, fakeAppImage.SavedNames(), append(opts.AdditionalNames, fakeAppImage.Name())...)
+					})
+
+					it("adds an entry per registry to the report", func() {
+						report, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+
+						h.AssertEq(t, report.Image.Registries, []platform.RegistryReport{
+							{
+								Registry: "index.docker.io",
+								Tags:     []string{"some-repo/app-image", "some-repo/app-image:foo"},
+								Digest:   fakeRemoteDigest,
+							},
+							{
+								Registry: "dr.example.com",
+								Tags:     []string{"dr.example.com/some-repo/app-image", "dr.example.com/some-repo/app-image:foo"},
+								Digest:   fakeRemoteDigest,
+							},
+						})
+					})
+				})
 			})
 
 			when("image has an ID identifier", func() {
@@ -1221,6 +1901,14 @@ version = "4.5.6"
 
 					h.AssertEq(t, report.Image.ImageID, "some-image-id")
 				})
+
+				it("does not add registries to the report", func() {
+					opts.AdditionalNames = []string{"some-repo/app-image:foo", "dr.example.com/some-repo/app-image"}
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, len(report.Image.Registries), 0)
+				})
 			})
 		})
 
@@ -1390,6 +2078,11 @@ version = "4.5.6"
 	})
 }
 
+// noHealthcheckImage hides the SetHealthcheck method of the image it wraps
+type noHealthcheckImage struct {
+	imgutil.Image
+}
+
 func assertHasEntrypoint(t *testing.T, image *fakes.Image, entrypointPath string) {
 	ep, err := image.Entrypoint()
 	h.AssertNil(t, err)
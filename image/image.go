@@ -1,30 +1,34 @@
 package image
 
 import (
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/pkg/errors"
 )
 
 // ValidateDestinationTags ensures all tags are valid
-// daemon - when false (exporting to a registry), ensures all tags are on the same registry
-func ValidateDestinationTags(daemon bool, repoNames ...string) error {
-	var (
-		reg        string
-		registries = map[string]struct{}{}
-	)
-
+// Tags may span multiple registries, in which case the image is written to each registry in turn
+func ValidateDestinationTags(repoNames ...string) error {
 	for _, repoName := range repoNames {
-		ref, err := name.ParseReference(repoName, name.WeakValidation)
-		if err != nil {
+		if _, err := name.ParseReference(repoName, name.WeakValidation); err != nil {
 			return err
 		}
-		reg = ref.Context().RegistryStr()
-		registries[reg] = struct{}{}
 	}
+	return nil
+}
 
-	if !daemon && len(registries) != 1 {
-		return errors.New("writing to multiple registries is unsupported")
+// RemoteImage reads the image from the registry with credentials from keychain.
+// Its layers are fetched with the same credentials when they are read.
+func RemoteImage(imageRef string, keychain authn.Keychain) (v1.Image, error) {
+	ref, err := name.ParseReference(imageRef, name.WeakValidation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse image reference '%s'", imageRef)
 	}
-
-	return nil
+	img, err := remote.Image(ref, remote.WithAuthFromKeychain(keychain))
+	if err != nil {
+		return nil, errors.Wrapf(err, "get image '%s'", imageRef)
+	}
+	return img, nil
 }
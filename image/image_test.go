@@ -16,30 +16,22 @@ func TestImage(t *testing.T) {
 func testImage(t *testing.T, when spec.G, it spec.S) {
 	when("#ValidateDestinationTags", func() {
 		when("multiple registries are provided", func() {
-			when("daemon", func() {
-				it("does not return an error", func() {
-					err := image.ValidateDestinationTags(true, "some/repo", "gcr.io/other-repo:latest", "example.com/final-repo")
-					h.AssertNil(t, err)
-				})
-			})
-			when("registry", func() {
-				it("errors as unsupported", func() {
-					err := image.ValidateDestinationTags(false, "some/repo", "gcr.io/other-repo:latest", "example.com/final-repo")
-					h.AssertError(t, err, "writing to multiple registries is unsupported")
-				})
+			it("does not return an error", func() {
+				err := image.ValidateDestinationTags("some/repo", "gcr.io/other-repo:latest", "example.com/final-repo")
+				h.AssertNil(t, err)
 			})
 		})
 
 		when("a single registry is provided", func() {
 			it("does not return an error", func() {
-				err := image.ValidateDestinationTags(false, "gcr.io/some/repo", "gcr.io/other-repo:latest", "gcr.io/final-repo")
+				err := image.ValidateDestinationTags("gcr.io/some/repo", "gcr.io/other-repo:latest", "gcr.io/final-repo")
 				h.AssertNil(t, err)
 			})
 		})
 
 		when("the tag reference is invalid", func() {
 			it("errors", func() {
-				err := image.ValidateDestinationTags(false, "some/Repo")
+				err := image.ValidateDestinationTags("some/Repo")
 				h.AssertError(t, err, "could not parse reference: some/Repo")
 			})
 		})
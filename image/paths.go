@@ -0,0 +1,132 @@
+package image
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// FindPaths returns the subset of paths that exist as files in the layers of img with the given diff IDs.
+// Paths are absolute paths in the image, symlinked directories such as /bin on images with a merged /usr are resolved.
+// Files deleted by whiteouts in a higher layer do not exist.
+func FindPaths(img imgutil.Image, diffIDs []string, paths []string) (map[string]bool, error) {
+	files := map[string]bool{}
+	symlinks := map[string]string{}
+	for _, diffID := range diffIDs {
+		if err := readLayerPaths(img, diffID, files, symlinks); err != nil {
+			return nil, err
+		}
+	}
+	found := map[string]bool{}
+	for _, p := range paths {
+		if files[resolvePath(path.Clean("/"+p), symlinks)] {
+			found[p] = true
+		}
+	}
+	return found, nil
+}
+
+// readLayerPaths adds the files and symlinks of the layer to those of the layers below it,
+// after removing the files of the layers below that are deleted by its whiteouts
+func readLayerPaths(img imgutil.Image, diffID string, files map[string]bool, symlinks map[string]string) error {
+	rc, err := img.GetLayer(diffID)
+	if err != nil {
+		return errors.Wrapf(err, "get layer '%s'", diffID)
+	}
+	defer rc.Close()
+	layerFiles := map[string]bool{}
+	layerSymlinks := map[string]string{}
+	var deleted, opaqueDirs []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "read layer '%s'", diffID)
+		}
+		name := path.Clean("/" + hdr.Name)
+		base := path.Base(name)
+		switch {
+		case base == opaqueWhiteout:
+			opaqueDirs = append(opaqueDirs, path.Dir(name))
+			continue
+		case strings.HasPrefix(base, whiteoutPrefix):
+			deleted = append(deleted, path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix)))
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			target := hdr.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(name), target)
+			}
+			layerSymlinks[name] = path.Clean(target)
+			layerFiles[name] = true
+		case tar.TypeReg, tar.TypeLink:
+			layerFiles[name] = true
+		}
+	}
+
+	for _, p := range deleted {
+		removePath(p, true, files, symlinks)
+	}
+	for _, dir := range opaqueDirs {
+		removePath(dir, false, files, symlinks)
+	}
+	for name := range layerFiles {
+		files[name] = true
+	}
+	for name, target := range layerSymlinks {
+		symlinks[name] = target
+	}
+	return nil
+}
+
+// removePath removes the files and symlinks below p, and p itself when self is true
+func removePath(p string, self bool, files map[string]bool, symlinks map[string]string) {
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	matches := func(name string) bool {
+		return (self && name == p) || strings.HasPrefix(name, prefix)
+	}
+	for name := range files {
+		if matches(name) {
+			delete(files, name)
+		}
+	}
+	for name := range symlinks {
+		if matches(name) {
+			delete(symlinks, name)
+		}
+	}
+}
+
+// resolvePath replaces symlinked directories in p with their targets
+func resolvePath(p string, symlinks map[string]string) string {
+	for i := 0; i < 16; i++ {
+		resolved := false
+		parts := strings.Split(p, "/")
+		for j := 2; j < len(parts); j++ {
+			dir := strings.Join(parts[:j], "/")
+			if target, ok := symlinks[dir]; ok {
+				p = path.Join(target, strings.Join(parts[j:], "/"))
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			return p
+		}
+	}
+	return p
+}
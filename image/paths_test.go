@@ -0,0 +1,108 @@
+package image_test
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/imgutil/fakes"
+	"github.com/buildpacks/imgutil/local"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/lifecycle/image"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestFindPaths(t *testing.T) {
+	spec.Run(t, "FindPaths", testFindPaths)
+}
+
+func testFindPaths(t *testing.T, when spec.G, it spec.S) {
+	var (
+		img    *fakes.Image
+		tmpDir string
+	)
+
+	addLayer := func(diffID string, headers ...*tar.Header) {
+		t.Helper()
+		layerPath := filepath.Join(tmpDir, diffID+".tar")
+		f, err := os.Create(layerPath)
+		h.AssertNil(t, err)
+		tw := tar.NewWriter(f)
+		for _, hdr := range headers {
+			h.AssertNil(t, tw.WriteHeader(hdr))
+		}
+		h.AssertNil(t, tw.Close())
+		h.AssertNil(t, f.Close())
+		h.AssertNil(t, img.AddLayerWithDiffID(layerPath, diffID))
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.find-paths")
+		h.AssertNil(t, err)
+		img = fakes.NewImage("some-image", "", local.IDIdentifier{ImageID: "some-image-id"})
+	})
+
+	it.After(func() {
+		h.AssertNil(t, img.Cleanup())
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("finds files in any of the layers, resolving symlinked directories", func() {
+		addLayer("sha256:first",
+			&tar.Header{Name: "bin", Typeflag: tar.TypeSymlink, Linkname: "usr/bin"},
+			&tar.Header{Name: "usr/bin/", Typeflag: tar.TypeDir, Mode: 0755},
+		)
+		addLayer("sha256:second",
+			&tar.Header{Name: "./usr/bin/some-binary", Typeflag: tar.TypeReg, Mode: 0755},
+			&tar.Header{Name: "usr/local/bin/other-binary", Typeflag: tar.TypeLink, Linkname: "usr/bin/some-binary"},
+		)
+
+		found, err := image.FindPaths(img, []string{"sha256:first", "sha256:second"}, []string{
+			"/bin/some-binary",
+			"/usr/bin/some-binary",
+			"/usr/local/bin/other-binary",
+			"/usr/bin/missing-binary",
+			"/usr/bin",
+		})
+		h.AssertNil(t, err)
+
+		h.AssertEq(t, found, map[string]bool{
+			"/bin/some-binary":            true,
+			"/usr/bin/some-binary":        true,
+			"/usr/local/bin/other-binary": true,
+		})
+	})
+
+	it("does not find files deleted by whiteouts in a higher layer", func() {
+		addLayer("sha256:first",
+			&tar.Header{Name: "usr/bin/deleted-binary", Typeflag: tar.TypeReg, Mode: 0755},
+			&tar.Header{Name: "usr/bin/kept-binary", Typeflag: tar.TypeReg, Mode: 0755},
+			&tar.Header{Name: "opt/tool/bin/tool", Typeflag: tar.TypeReg, Mode: 0755},
+			&tar.Header{Name: "usr/local/bin/replaced-binary", Typeflag: tar.TypeReg, Mode: 0755},
+		)
+		addLayer("sha256:second",
+			&tar.Header{Name: "usr/bin/.wh.deleted-binary", Typeflag: tar.TypeReg},
+			&tar.Header{Name: "opt/.wh.tool", Typeflag: tar.TypeReg},
+			&tar.Header{Name: "usr/local/bin/.wh..wh..opq", Typeflag: tar.TypeReg},
+			&tar.Header{Name: "usr/local/bin/new-binary", Typeflag: tar.TypeReg, Mode: 0755},
+		)
+
+		found, err := image.FindPaths(img, []string{"sha256:first", "sha256:second"}, []string{
+			"/usr/bin/deleted-binary",
+			"/usr/bin/kept-binary",
+			"/opt/tool/bin/tool",
+			"/usr/local/bin/replaced-binary",
+			"/usr/local/bin/new-binary",
+		})
+		h.AssertNil(t, err)
+
+		h.AssertEq(t, found, map[string]bool{
+			"/usr/bin/kept-binary":      true,
+			"/usr/local/bin/new-binary": true,
+		})
+	})
+}
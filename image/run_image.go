@@ -0,0 +1,150 @@
+package image
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+type Logger interface {
+	Debugf(fmt string, v ...interface{})
+	Infof(fmt string, v ...interface{})
+}
+
+// RunImageSelector chooses a run image from an ordered list of candidates
+type RunImageSelector struct {
+	Keychain authn.Keychain
+	Logger   Logger
+	// Resolve returns the digest of the image or an error if the image cannot be resolved;
+	// it defaults to a HEAD request against the registry
+	Resolve func(ref name.Reference, auth authn.Authenticator) (string, error)
+	// Retry calls op until it succeeds or the retries are exhausted;
+	// it defaults to calling op once
+	Retry func(desc string, op func() error) error
+}
+
+// Select returns the first candidate that resolves, pinned to the digest it resolved to.
+// Candidates preferred by the platform are tried first, followed by candidates on the registry of the app image
+// whose layers can be mounted instead of pulled, followed by candidates the keychain has credentials for,
+// followed by all other candidates. The relative order of candidates within each group is preserved.
+func (s *RunImageSelector) Select(candidates []platform.RunImageCandidate) (platform.RunImage, error) {
+	type ranked struct {
+		platform.RunImageCandidate
+		ref           name.Reference
+		auth          authn.Authenticator
+		authenticated bool
+	}
+
+	var rankedCandidates []ranked
+	for _, c := range candidates {
+		ref, err := name.ParseReference(c.Reference, name.WeakValidation)
+		if err != nil {
+			s.Logger.Debugf("Skipping run image '%s': %s", c.Reference, err)
+			continue
+		}
+		auth, err := s.Keychain.Resolve(ref.Context().Registry)
+		if err != nil {
+			s.Logger.Debugf("Unable to resolve credentials for run image '%s': %s", c.Reference, err)
+			auth = authn.Anonymous
+		}
+		rankedCandidates = append(rankedCandidates, ranked{
+			RunImageCandidate: c,
+			ref:               ref,
+			auth:              auth,
+			authenticated:     auth != authn.Anonymous,
+		})
+	}
+	rank := func(r ranked) int {
+		switch {
+		case r.Preferred:
+			return 0
+		case r.SameRegistry:
+			return 1
+		case r.authenticated:
+			return 2
+		default:
+			return 3
+		}
+	}
+	sort.SliceStable(rankedCandidates, func(i, j int) bool {
+		return rank(rankedCandidates[i]) < rank(rankedCandidates[j])
+	})
+
+	resolve := s.Resolve
+	if resolve == nil {
+		resolve = headDigest
+	}
+	retry := s.Retry
+	if retry == nil {
+		retry = func(_ string, op func() error) error { return op() }
+	}
+	var failures []string
+	for _, c := range rankedCandidates {
+		var digest string
+		err := retry(fmt.Sprintf("resolving run image '%s'", c.Reference), func() error {
+			var err error
+			digest, err = resolve(c.ref, c.auth)
+			return err
+		})
+		if err != nil {
+			s.Logger.Infof("Skipping run image '%s', unable to resolve: %s", c.Reference, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", c.Reference, err))
+			continue
+		}
+		reason := c.Reason
+		if c.authenticated && !c.Preferred && !c.SameRegistry {
+			reason += ", credentials available"
+		}
+		if len(failures) > 0 {
+			reason += fmt.Sprintf(", %d higher ranked image(s) unavailable", len(failures))
+		}
+		return platform.RunImage{Reference: c.Reference, Digest: digest, Reason: reason}, nil
+	}
+	return platform.RunImage{}, errors.Errorf("no run image could be resolved: [%s]", strings.Join(failures, "; "))
+}
+
+// ResolveDigest returns the digest the given image reference currently resolves to in the registry
+func ResolveDigest(imageRef string, keychain authn.Keychain) (string, error) {
+	ref, err := name.ParseReference(imageRef, name.WeakValidation)
+	if err != nil {
+		return "", err
+	}
+	auth, err := keychain.Resolve(ref.Context().Registry)
+	if err != nil {
+		return "", err
+	}
+	digest, err := headDigest(ref, auth)
+	if err != nil {
+		return "", errors.Wrapf(err, "resolving digest for image '%s'", imageRef)
+	}
+	return digest, nil
+}
+
+// DigestReference returns a reference to the repository of imageRef pinned to digest
+func DigestReference(imageRef, digest string) (string, error) {
+	ref, err := name.ParseReference(imageRef, name.WeakValidation)
+	if err != nil {
+		return "", err
+	}
+	digestRef, err := name.NewDigest(fmt.Sprintf("%s@%s", ref.Context().Name(), digest), name.WeakValidation)
+	if err != nil {
+		return "", errors.Wrap(err, "creating digest reference")
+	}
+	return digestRef.String(), nil
+}
+
+func headDigest(ref name.Reference, auth authn.Authenticator) (string, error) {
+	desc, err := remote.Head(ref, remote.WithAuth(auth), remote.WithTransport(http.DefaultTransport))
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest.String(), nil
+}
@@ -0,0 +1,154 @@
+package image_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/auth"
+	"github.com/buildpacks/lifecycle/image"
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestRunImageSelector(t *testing.T) {
+	spec.Run(t, "RunImageSelector", testRunImageSelector)
+}
+
+func testRunImageSelector(t *testing.T, when spec.G, it spec.S) {
+	var (
+		selector    *image.RunImageSelector
+		unreachable map[string]bool
+		checked     []string
+		candidates  []platform.RunImageCandidate
+	)
+
+	it.Before(func() {
+		unreachable = map[string]bool{}
+		checked = nil
+		selector = &image.RunImageSelector{
+			Keychain: &auth.ResolvedKeychain{Auths: map[string]string{
+				"private.example.com": "Basic some-auth=",
+			}},
+			Logger: &log.Logger{Handler: &discard.Handler{}},
+			Resolve: func(ref name.Reference, _ authn.Authenticator) (string, error) {
+				checked = append(checked, ref.Context().RegistryStr())
+				if unreachable[ref.Context().RegistryStr()] {
+					return "", errors.New("connection refused")
+				}
+				return "sha256:" + ref.Context().RegistryStr(), nil
+			},
+		}
+		candidates = []platform.RunImageCandidate{
+			{Reference: "public.example.com/org/run", SameRegistry: true, Reason: "on the same registry as the app image 'public.example.com'"},
+			{Reference: "private.example.com/org/run", Reason: "stack run image mirror"},
+			{Reference: "other.example.com/org/run", Reason: "stack run image mirror"},
+		}
+	})
+
+	it("prefers images on the same registry as the app image", func() {
+		runImage, err := selector.Select(candidates)
+		h.AssertNil(t, err)
+		h.AssertEq(t, runImage.Reference, "public.example.com/org/run")
+		h.AssertEq(t, runImage.Reason, "on the same registry as the app image 'public.example.com'")
+	})
+
+	it("pins the selected image to the digest it resolved to", func() {
+		runImage, err := selector.Select(candidates)
+		h.AssertNil(t, err)
+		h.AssertEq(t, runImage.Digest, "sha256:public.example.com")
+	})
+
+	when("no image is on the same registry as the app image", func() {
+		it.Before(func() {
+			candidates = candidates[1:]
+		})
+
+		it("prefers images the keychain can authenticate to", func() {
+			runImage, err := selector.Select(candidates)
+			h.AssertNil(t, err)
+			h.AssertEq(t, runImage.Reference, "private.example.com/org/run")
+			h.AssertEq(t, runImage.Reason, "stack run image mirror, credentials available")
+		})
+	})
+
+	when("an image is preferred by the platform", func() {
+		it.Before(func() {
+			candidates = append([]platform.RunImageCandidate{
+				{Reference: "preferred.example.com/org/run", Preferred: true, Reason: "matches platform preference 'preferred.example.com'"},
+			}, candidates...)
+		})
+
+		it("selects the preferred image", func() {
+			runImage, err := selector.Select(candidates)
+			h.AssertNil(t, err)
+			h.AssertEq(t, runImage.Reference, "preferred.example.com/org/run")
+			h.AssertEq(t, runImage.Reason, "matches platform preference 'preferred.example.com'")
+		})
+	})
+
+	when("images fail to resolve", func() {
+		it.Before(func() {
+			unreachable["private.example.com"] = true
+			unreachable["public.example.com"] = true
+		})
+
+		it("falls back to the next image that resolves", func() {
+			runImage, err := selector.Select(candidates)
+			h.AssertNil(t, err)
+			h.AssertEq(t, runImage.Reference, "other.example.com/org/run")
+			h.AssertEq(t, runImage.Reason, "stack run image mirror, 2 higher ranked image(s) unavailable")
+			h.AssertEq(t, checked, []string{"public.example.com", "private.example.com", "other.example.com"})
+		})
+
+		when("resolving is retried", func() {
+			it.Before(func() {
+				selector.Retry = lifecycle.Retry{Retries: 1, Backoff: time.Millisecond}.Do
+				resolve := selector.Resolve
+				selector.Resolve = func(ref name.Reference, auth authn.Authenticator) (string, error) {
+					digest, err := resolve(ref, auth)
+					// the registry recovers after the first attempt
+					delete(unreachable, ref.Context().RegistryStr())
+					return digest, err
+				}
+			})
+
+			it("selects the image that resolves when retried", func() {
+				runImage, err := selector.Select(candidates)
+				h.AssertNil(t, err)
+				h.AssertEq(t, runImage.Reference, "public.example.com/org/run")
+				h.AssertEq(t, checked, []string{"public.example.com", "public.example.com"})
+			})
+		})
+
+		when("no image resolves", func() {
+			it.Before(func() {
+				unreachable["other.example.com"] = true
+			})
+
+			it("errors", func() {
+				_, err := selector.Select(candidates)
+				h.AssertNotNil(t, err)
+				h.AssertStringContains(t, err.Error(), "no run image could be resolved")
+				h.AssertStringContains(t, err.Error(), "other.example.com/org/run: connection refused")
+			})
+		})
+	})
+
+	when("#DigestReference", func() {
+		it("pins the repository of the reference to the digest", func() {
+			digest := "sha256:" + strings.Repeat("a", 64)
+			ref, err := image.DigestReference("gcr.io/org/run:tag", digest)
+			h.AssertNil(t, err)
+			h.AssertEq(t, ref, "gcr.io/org/run@"+digest)
+		})
+	})
+}
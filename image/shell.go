@@ -0,0 +1,36 @@
+package image
+
+import (
+	"github.com/buildpacks/imgutil"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/pkg/errors"
+)
+
+// ShellPath is the path of the shell the launcher runs non-direct processes and profile scripts with
+const ShellPath = "/bin/bash"
+
+// HasShell returns true if ShellPath exists in the layers of img with the given diff IDs
+func HasShell(img imgutil.Image, diffIDs []string) (bool, error) {
+	found, err := FindPaths(img, diffIDs, []string{ShellPath})
+	if err != nil {
+		return false, err
+	}
+	return found[ShellPath], nil
+}
+
+// RemoteDiffIDs returns the diff IDs of the layers of the image in the registry, from the bottom up
+func RemoteDiffIDs(imageRef string, keychain authn.Keychain) ([]string, error) {
+	img, err := RemoteImage(imageRef, keychain)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, errors.Wrapf(err, "get config of image '%s'", imageRef)
+	}
+	var diffIDs []string
+	for _, diffID := range cfg.RootFS.DiffIDs {
+		diffIDs = append(diffIDs, diffID.String())
+	}
+	return diffIDs, nil
+}
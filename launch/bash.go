@@ -2,10 +2,13 @@ package launch
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/pkg/errors"
 )
 
+const bashPath = "/bin/bash"
+
 var (
 	bashCommandWithScript = `exec bash -c "$@"` // for processes w/o arguments
 )
@@ -31,10 +34,13 @@ func (b *BashShell) Launch(proc ShellProcess) error {
 		bashCommand = bashCommandWithTokens(len(proc.Args) + 1)
 	}
 	launcher += bashCommand
-	if err := b.Exec("/bin/bash", append([]string{
+	if err := b.Exec(bashPath, append([]string{
 		"bash", "-c",
 		launcher, proc.Caller, proc.Command,
 	}, proc.Args...), proc.Env); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.Errorf("the process is not direct and requires a shell, but the image has no shell at %s", bashPath)
+		}
 		return errors.Wrap(err, "bash exec")
 	}
 	return nil
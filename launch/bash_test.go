@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"syscall"
 	"testing"
 
 	"github.com/sclevine/spec"
@@ -40,6 +41,17 @@ func testBash(t *testing.T, when spec.G, it spec.S) {
 	when("#Launch", func() {
 		var process launch.ShellProcess
 
+		when("the image has no shell", func() {
+			it("fails", func() {
+				shell = &launch.BashShell{Exec: func(string, []string, []string) error {
+					return &os.PathError{Op: "exec", Path: "/bin/bash", Err: syscall.ENOENT}
+				}}
+
+				err := shell.Launch(launch.ShellProcess{Command: "some-command"})
+				h.AssertError(t, err, "the process is not direct and requires a shell, but the image has no shell at /bin/bash")
+			})
+		})
+
 		when("script", func() {
 			when("there are profiles", func() {
 				it.Before(func() {
@@ -0,0 +1,224 @@
+package launch
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/env"
+)
+
+// Description describes what the launcher would do for each process type
+type Description struct {
+	Processes      []ProcessDescription `json:"processes"`
+	DefaultProcess string               `json:"defaultProcess,omitempty"`
+}
+
+type ProcessDescription struct {
+	Process
+	Env []EnvVarDescription `json:"env"`
+}
+
+// EnvVarDescription is an environment variable in the computed environment of a process.
+// Sources lists every modification made to the variable in the order they were applied, the last source set the value.
+// Variables without sources are inherited from the container environment.
+type EnvVarDescription struct {
+	Name    string      `json:"name"`
+	Value   string      `json:"value"`
+	Sources []EnvSource `json:"sources,omitempty"`
+}
+
+const (
+	EnvSourceRoot    = "root"    // a bin or lib directory in the layer
+	EnvSourceEnv     = "env"     // an env file in the layer
+	EnvSourceExecD   = "exec.d"  // an exec.d binary in the layer
+	EnvSourceProfile = "profile" // a profile script in the layer, or the app profile script
+)
+
+type EnvSource struct {
+	Buildpack string `json:"buildpack,omitempty"`
+	Layer     string `json:"layer,omitempty"`
+	Type      string `json:"type"`
+	Path      string `json:"path,omitempty"`
+}
+
+// Describe computes the environment of each process type, recording which buildpack and layer set each variable.
+// Exec.d binaries and profile scripts are run to compute the environment, but the processes themselves are not.
+func (l *Launcher) Describe() (Description, error) {
+	if l.NewEnv == nil {
+		return Description{}, errors.New("describing processes requires a new environment for each process")
+	}
+	if err := os.Chdir(l.AppDir); err != nil {
+		return Description{}, errors.Wrap(err, "change to app directory")
+	}
+	desc := Description{DefaultProcess: l.DefaultProcessType}
+	for _, proc := range l.Processes {
+		vars, err := l.describeEnv(proc)
+		if err != nil {
+			return Description{}, errors.Wrapf(err, "describe env for process type '%s'", proc.Type)
+		}
+		desc.Processes = append(desc.Processes, ProcessDescription{Process: proc, Env: vars})
+	}
+	return desc, nil
+}
+
+func (l *Launcher) describeEnv(proc Process) ([]EnvVarDescription, error) {
+	dl := *l
+	dl.Env = l.NewEnv(os.Environ())
+	trace := &envTrace{env: dl.Env, sources: map[string][]EnvSource{}}
+
+	bpIDs := map[string]string{}
+	for _, bp := range l.Buildpacks {
+		bpIDs[filepath.Join(l.LayersDir, EscapeID(bp.ID))] = bp.ID
+	}
+	source := func(srcType, path string) EnvSource {
+		for bpDir, bpID := range bpIDs {
+			if rel, err := filepath.Rel(bpDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+				return EnvSource{Buildpack: bpID, Layer: strings.Split(filepath.ToSlash(rel), "/")[0], Type: srcType, Path: path}
+			}
+		}
+		return EnvSource{Type: srcType, Path: path}
+	}
+	record := func(srcType string, action dirAction) dirAction {
+		return func(path string) error {
+			src := source(srcType, path)
+			if srcType != EnvSourceExecD {
+				src.Path = ""
+			}
+			return trace.record(src, func() error { return action(path) })
+		}
+	}
+
+	if err := dl.eachBuildpack(func(bpAPI *api.Version, bpDir string) error {
+		if err := eachLayer(bpDir, record(EnvSourceRoot, dl.doLayerRoot())); err != nil {
+			return errors.Wrap(err, "add layer root")
+		}
+		if err := eachLayer(bpDir, record(EnvSourceEnv, dl.doLayerEnvFiles(proc.Type, env.DefaultActionType(bpAPI)))); err != nil {
+			return errors.Wrap(err, "add layer env")
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "modify env")
+	}
+	if err := dl.doExecDWith(proc.Type, func(b execDBinary, set func() error) error {
+		return trace.record(EnvSource{Buildpack: b.buildpackID, Layer: b.layer, Type: EnvSourceExecD, Path: b.path}, set)
+	}); err != nil {
+		return nil, errors.Wrap(err, "exec.d")
+	}
+
+	vars := trace.snapshot()
+	var err error
+	if !proc.Direct {
+		if vars, err = dl.describeProfiles(proc, trace, source); err != nil {
+			return nil, errors.Wrap(err, "profiles")
+		}
+	}
+
+	var described []EnvVarDescription
+	for name, value := range vars {
+		described = append(described, EnvVarDescription{Name: name, Value: value, Sources: trace.sources[name]})
+	}
+	sort.Slice(described, func(i, j int) bool {
+		return described[i].Name < described[j].Name
+	})
+	return described, nil
+}
+
+// describeProfiles sources the profile scripts for proc once, in order, in a single shell,
+// recording the changes each script makes to the environment, and returns the resulting environment
+func (l *Launcher) describeProfiles(proc Process, trace *envTrace, source func(srcType, path string) EnvSource) (map[string]string, error) {
+	profiles, err := l.getProfiles(proc.Type)
+	if err != nil {
+		return nil, errors.Wrap(err, "find profiles")
+	}
+	envs, err := l.profilesEnv(profiles)
+	if err != nil {
+		return nil, err
+	}
+	for i, profile := range profiles {
+		src := source(EnvSourceProfile, profile)
+		for name, value := range envs[i+1] {
+			if old, ok := envs[i][name]; !ok || old != value {
+				trace.sources[name] = append(trace.sources[name], src)
+			}
+		}
+	}
+	return envs[len(profiles)], nil
+}
+
+// profilesEnv sources the given profile scripts in a shell and returns the environment of the shell
+// before any of them and after each of them
+func (l *Launcher) profilesEnv(profiles []string) ([]map[string]string, error) {
+	var out bytes.Buffer
+	shell := NewShell(func(argv0 string, argv []string, envv []string) error {
+		cmd := exec.Command(argv0, argv[1:]...)
+		cmd.Env = envv
+		cmd.Stdout = &out
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	})
+	proc := profilesEnvProcess(profiles)
+	proc.Env = l.Env.List()
+	err := shell.Launch(proc)
+
+	var envs []map[string]string
+	for _, dump := range strings.Split(out.String(), envSeparator+envSeparator) {
+		if len(envs) == len(profiles)+1 {
+			break
+		}
+		vars := map[string]string{}
+		for _, kv := range strings.Split(dump, envSeparator) {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) == 2 && parts[0] != "" {
+				vars[parts[0]] = parts[1]
+			}
+		}
+		envs = append(envs, vars)
+	}
+	if err == nil && len(envs) < len(profiles)+1 {
+		err = errors.New("shell exited before printing the environment")
+	}
+	if err != nil {
+		if len(envs) > 0 && len(envs) <= len(profiles) {
+			return nil, errors.Wrapf(err, "source profile '%s'", profiles[len(envs)-1])
+		}
+		return nil, err
+	}
+	return envs, nil
+}
+
+// envTrace records the source of each change made to env
+type envTrace struct {
+	env     Env
+	sources map[string][]EnvSource
+}
+
+func (t *envTrace) record(src EnvSource, action func() error) error {
+	before := t.snapshot()
+	if err := action(); err != nil {
+		return err
+	}
+	for name, value := range t.snapshot() {
+		if old, ok := before[name]; !ok || old != value {
+			t.sources[name] = append(t.sources[name], src)
+		}
+	}
+	return nil
+}
+
+func (t *envTrace) snapshot() map[string]string {
+	vars := map[string]string{}
+	for _, kv := range t.env.List() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			vars[parts[0]] = parts[1]
+		}
+	}
+	return vars
+}
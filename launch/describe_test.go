@@ -0,0 +1,218 @@
+// +build linux darwin
+
+package launch_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/env"
+	"github.com/buildpacks/lifecycle/launch"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestDescribe(t *testing.T) {
+	spec.Run(t, "Describe", testDescribe, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testDescribe(t *testing.T, when spec.G, it spec.S) {
+	var (
+		launcher  *launch.Launcher
+		tmpDir    string
+		layersDir string
+		appDir    string
+		wd        string
+	)
+
+	write := func(path, contents string, mode os.FileMode) {
+		t.Helper()
+		h.AssertNil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		h.AssertNil(t, ioutil.WriteFile(path, []byte(contents), mode))
+	}
+
+	findVar := func(proc launch.ProcessDescription, name string) launch.EnvVarDescription {
+		t.Helper()
+		for _, v := range proc.Env {
+			if v.Name == name {
+				return v
+			}
+		}
+		t.Fatalf("env var '%s' not found in process type '%s'", name, proc.Type)
+		return launch.EnvVarDescription{}
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.describe")
+		h.AssertNil(t, err)
+		wd, err = os.Getwd()
+		h.AssertNil(t, err)
+		layersDir = filepath.Join(tmpDir, "layers")
+		appDir = filepath.Join(tmpDir, "app")
+		h.AssertNil(t, os.MkdirAll(appDir, 0755))
+
+		layerDir := filepath.Join(layersDir, "some_buildpack", "some-layer")
+		h.AssertNil(t, os.MkdirAll(filepath.Join(layerDir, "bin"), 0755))
+		write(filepath.Join(layerDir, "env.launch", "SOME_VAR"), "some-value", 0644)
+		write(filepath.Join(layerDir, "env.launch", "web", "WEB_VAR"), "web-value", 0644)
+		write(filepath.Join(layerDir, "exec.d", "some-execd"), "#!/bin/sh\necho 'EXECD_VAR = \"execd-value\"' >&3\n", 0755)
+		write(filepath.Join(layersDir, "other_buildpack", "other-layer", "profile.d", "some-profile"), "export PROFILE_VAR=profile-value\n", 0644)
+		write(filepath.Join(appDir, ".profile"), "export SOME_VAR=app-value\n", 0644)
+
+		var out bytes.Buffer
+		newEnv := func([]string) launch.Env {
+			return env.NewLaunchEnv([]string{"PATH=/usr/bin:/bin"}, launch.ProcessDir, launch.LifecycleDir)
+		}
+		launcher = &launch.Launcher{
+			AppDir:             appDir,
+			LayersDir:          layersDir,
+			DefaultProcessType: "web",
+			PlatformAPI:        api.MustParse("0.5"),
+			Buildpacks: []launch.Buildpack{
+				{API: "0.5", ID: "some/buildpack"},
+				{API: "0.5", ID: "other/buildpack"},
+			},
+			Processes: []launch.Process{
+				{Type: "web", Command: "some-command", BuildpackID: "some/buildpack"},
+				{Type: "worker", Command: "other-command", Direct: true, BuildpackID: "other/buildpack"},
+			},
+			Env:    newEnv(nil),
+			NewEnv: newEnv,
+			ExecD:  &launch.ExecDRunner{Out: &out, Err: &out},
+		}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.Chdir(wd))
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#Describe", func() {
+		it("describes the processes and the default process", func() {
+			desc, err := launcher.Describe()
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, desc.DefaultProcess, "web")
+			h.AssertEq(t, len(desc.Processes), 2)
+			h.AssertEq(t, desc.Processes[0].Process, launcher.Processes[0])
+			h.AssertEq(t, desc.Processes[1].Process, launcher.Processes[1])
+		})
+
+		it("records the buildpack and layer that set each variable", func() {
+			desc, err := launcher.Describe()
+			h.AssertNil(t, err)
+			web := desc.Processes[0]
+
+			path := findVar(web, "PATH")
+			h.AssertEq(t, path.Value[:len(filepath.Join(layersDir, "some_buildpack", "some-layer", "bin"))], filepath.Join(layersDir, "some_buildpack", "some-layer", "bin"))
+			h.AssertEq(t, path.Sources[0], launch.EnvSource{Buildpack: "some/buildpack", Layer: "some-layer", Type: launch.EnvSourceRoot})
+
+			h.AssertEq(t, findVar(web, "WEB_VAR"), launch.EnvVarDescription{
+				Name:    "WEB_VAR",
+				Value:   "web-value",
+				Sources: []launch.EnvSource{{Buildpack: "some/buildpack", Layer: "some-layer", Type: launch.EnvSourceEnv}},
+			})
+			h.AssertEq(t, findVar(web, "EXECD_VAR"), launch.EnvVarDescription{
+				Name:  "EXECD_VAR",
+				Value: "execd-value",
+				Sources: []launch.EnvSource{{
+					Buildpack: "some/buildpack",
+					Layer:     "some-layer",
+					Type:      launch.EnvSourceExecD,
+					Path:      filepath.Join(layersDir, "some_buildpack", "some-layer", "exec.d", "some-execd"),
+				}},
+			})
+			h.AssertEq(t, findVar(web, "PROFILE_VAR"), launch.EnvVarDescription{
+				Name:  "PROFILE_VAR",
+				Value: "profile-value",
+				Sources: []launch.EnvSource{{
+					Buildpack: "other/buildpack",
+					Layer:     "other-layer",
+					Type:      launch.EnvSourceProfile,
+					Path:      filepath.Join(layersDir, "other_buildpack", "other-layer", "profile.d", "some-profile"),
+				}},
+			})
+		})
+
+		it("records every source of a variable set more than once, in order", func() {
+			desc, err := launcher.Describe()
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, findVar(desc.Processes[0], "SOME_VAR"), launch.EnvVarDescription{
+				Name:  "SOME_VAR",
+				Value: "app-value",
+				Sources: []launch.EnvSource{
+					{Buildpack: "some/buildpack", Layer: "some-layer", Type: launch.EnvSourceEnv},
+					{Type: launch.EnvSourceProfile, Path: ".profile"},
+				},
+			})
+		})
+
+		it("computes the environment of each process type separately", func() {
+			desc, err := launcher.Describe()
+			h.AssertNil(t, err)
+			worker := desc.Processes[1]
+
+			for _, v := range worker.Env {
+				if v.Name == "WEB_VAR" || v.Name == "PROFILE_VAR" {
+					t.Fatalf("unexpected env var '%s' for process type 'worker'", v.Name)
+				}
+			}
+			// profiles are not sourced for direct processes
+			h.AssertEq(t, findVar(worker, "SOME_VAR").Value, "some-value")
+		})
+
+		it("sources each profile script once", func() {
+			countFile := filepath.Join(tmpDir, "sourced")
+			write(filepath.Join(layersDir, "other_buildpack", "other-layer", "profile.d", "some-profile"),
+				"echo sourced >> "+countFile+"\nexport PROFILE_VAR=profile-value\n", 0644)
+
+			desc, err := launcher.Describe()
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, findVar(desc.Processes[0], "PROFILE_VAR").Value, "profile-value")
+			sourced, err := ioutil.ReadFile(countFile)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(sourced), "sourced\n")
+		})
+
+		when("exec.d binaries run concurrently", func() {
+			it.Before(func() {
+				launcher.ConcurrentExecD = true
+				write(filepath.Join(layersDir, "other_buildpack", "other-layer", "exec.d", "other-execd"),
+					"#!/bin/sh\necho \"EXECD_VAR = \\\"other-value-${EXECD_VAR}\\\"\" >&3\n", 0755)
+			})
+
+			it("runs each binary with the environment from before any of them ran", func() {
+				desc, err := launcher.Describe()
+				h.AssertNil(t, err)
+
+				h.AssertEq(t, findVar(desc.Processes[0], "EXECD_VAR"), launch.EnvVarDescription{
+					Name:  "EXECD_VAR",
+					Value: "other-value-",
+					Sources: []launch.EnvSource{
+						{
+							Buildpack: "some/buildpack",
+							Layer:     "some-layer",
+							Type:      launch.EnvSourceExecD,
+							Path:      filepath.Join(layersDir, "some_buildpack", "some-layer", "exec.d", "some-execd"),
+						},
+						{
+							Buildpack: "other/buildpack",
+							Layer:     "other-layer",
+							Type:      launch.EnvSourceExecD,
+							Path:      filepath.Join(layersDir, "other_buildpack", "other-layer", "exec.d", "other-execd"),
+						},
+					},
+				})
+			})
+		})
+	})
+}
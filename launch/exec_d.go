@@ -1,25 +1,40 @@
 package launch
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pkg/errors"
 )
 
+const (
+	DefaultExecDTimeout       = time.Minute
+	DefaultExecDMaxOutputSize = 1024 * 1024
+
+	// execDDrainPeriod is how long the output is read after the binary exits
+	execDDrainPeriod = 100 * time.Millisecond
+)
+
 // ExecDRunner is responsible for running ExecD binaries.
 type ExecDRunner struct {
-	Out, Err io.Writer // Out and Err can be used to configure Stdout and Stderr processes run by ExecDRunner.
+	Out, Err      io.Writer     // Out and Err can be used to configure Stdout and Stderr processes run by ExecDRunner.
+	Timeout       time.Duration // Timeout is the time each binary may run before it is killed, zero means no timeout.
+	MaxOutputSize int64         // MaxOutputSize is the maximum size in bytes of the output of each binary, zero means no limit.
 }
 
-// NewExecDRunner creates an ExecDRunner with Out and Err set to stdout and stderr
+// NewExecDRunner creates an ExecDRunner with Out and Err set to stdout and stderr and the default timeout and output size limit
 func NewExecDRunner() *ExecDRunner {
 	return &ExecDRunner{
-		Out: os.Stdout,
-		Err: os.Stderr,
+		Out:           os.Stdout,
+		Err:           os.Stderr,
+		Timeout:       DefaultExecDTimeout,
+		MaxOutputSize: DefaultExecDMaxOutputSize,
 	}
 }
 
@@ -30,35 +45,116 @@ func (e *ExecDRunner) ExecD(path string, env Env) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to create pipe")
 	}
+	defer pr.Close()
+
+	cmd := exec.Command(path)
+	cmd.Stdout = e.Out
+	cmd.Stderr = e.Err
+	cmd.Env = env.List()
+	var timedOut bool
 	errChan := make(chan error, 1)
 	go func() {
 		defer pw.Close()
-		cmd := exec.Command(path)
-		cmd.Stdout = e.Out
-		cmd.Stderr = e.Err
-		cmd.Env = env.List()
 		if err := setHandle(cmd, pw); err != nil {
 			errChan <- err
-		} else {
-			errChan <- cmd.Run()
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			errChan <- err
+			return
 		}
+		if e.Timeout == 0 {
+			errChan <- cmd.Wait()
+			return
+		}
+		fired := make(chan struct{})
+		timer := time.AfterFunc(e.Timeout, func() {
+			defer close(fired)
+			// the kill fails if the binary has already exited
+			if err := cmd.Process.Kill(); err == nil {
+				timedOut = true
+				// unblock the read if a child of the binary still holds the output handle
+				_ = pr.Close()
+			}
+		})
+		err := cmd.Wait()
+		if !timer.Stop() {
+			<-fired
+		}
+		errChan <- err
+	}()
+
+	type readResult struct {
+		out []byte
+		err error
+	}
+	readChan := make(chan readResult, 1)
+	go func() {
+		out, err := e.readOutput(pr)
+		readChan <- readResult{out, err}
 	}()
 
-	out, err := ioutil.ReadAll(pr)
-	if cmdErr := <-errChan; cmdErr != nil {
+	var (
+		read   readResult
+		cmdErr error
+	)
+	select {
+	case read = <-readChan:
+		if read.err == errExecDOutputSize {
+			// stop the binary from blocking on a full pipe
+			_ = pr.Close()
+		}
+		cmdErr = <-errChan
+	case cmdErr = <-errChan:
+		select {
+		case read = <-readChan:
+		case <-time.After(execDDrainPeriod):
+			// a child of the binary still holds the output handle, keep the output written before the binary exited
+			_ = pr.Close()
+			if read = <-readChan; errors.Is(read.err, os.ErrClosed) {
+				read.err = nil
+			}
+		}
+	}
+	out, readErr := read.out, read.err
+	if timedOut {
+		return fmt.Errorf("exec.d file at path '%s' did not exit within %s", path, e.Timeout)
+	}
+	if readErr == errExecDOutputSize {
+		return fmt.Errorf("output from exec.d file at path '%s' exceeds %d bytes", path, e.MaxOutputSize)
+	}
+	if cmdErr != nil {
 		// prefer the error from the command
 		return errors.Wrapf(cmdErr, "failed to execute exec.d file at path '%s'", path)
-	} else if err != nil {
+	} else if readErr != nil {
 		// return the read error only if the command succeeded
-		return errors.Wrapf(err, "failed to read output from exec.d file at path '%s'", path)
+		return errors.Wrapf(readErr, "failed to read output from exec.d file at path '%s'", path)
 	}
 
 	envVars := map[string]string{}
 	if _, err := toml.Decode(string(out), &envVars); err != nil {
 		return errors.Wrapf(err, "failed to decode output from exec.d file at path '%s'", path)
 	}
+	for k := range envVars {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return fmt.Errorf("output from exec.d file at path '%s' sets invalid environment variable name '%s'", path, k)
+		}
+	}
 	for k, v := range envVars {
 		env.Set(k, v)
 	}
 	return nil
 }
+
+var errExecDOutputSize = errors.New("output size exceeded")
+
+func (e *ExecDRunner) readOutput(r io.Reader) ([]byte, error) {
+	if e.MaxOutputSize <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	out, err := ioutil.ReadAll(io.LimitReader(r, e.MaxOutputSize+1))
+	if int64(len(out)) > e.MaxOutputSize {
+		return nil, errExecDOutputSize
+	}
+	return out, err
+}
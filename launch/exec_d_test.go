@@ -2,6 +2,7 @@ package launch_test
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -98,5 +99,51 @@ func testExecD(t *testing.T, when spec.G, it spec.S) {
 			h.AssertNil(t, runner.ExecD(path, env))
 			h.AssertEq(t, errOut.String(), "stderr from execd\n")
 		})
+
+		it("errors when the binary does not exit within the timeout", func() {
+			runner.Timeout = 100 * time.Millisecond
+			env.EXPECT().List().Return([]string{"SLEEP=10s"})
+
+			start := time.Now()
+			err := runner.ExecD(path, env)
+			h.AssertError(t, err, fmt.Sprintf("exec.d file at path '%s' did not exit within 100ms", path))
+			h.AssertEq(t, time.Since(start) < 5*time.Second, true)
+		})
+
+		it("does not wait for a child of the binary that holds the output handle", func() {
+			if runtime.GOOS == "windows" {
+				t.Skip("the test binary does not start child processes on windows")
+			}
+			env.EXPECT().List().Return([]string{"CHILD_SLEEP=10"})
+			env.EXPECT().Set("APPEND_VAR", "SOME_VAL")
+			env.EXPECT().Set("OTHER_VAR", "OTHER_VAL")
+
+			start := time.Now()
+			h.AssertNil(t, runner.ExecD(path, env))
+			h.AssertEq(t, time.Since(start) < 5*time.Second, true)
+		})
+
+		it("errors when the output exceeds the maximum size", func() {
+			runner.MaxOutputSize = 1024
+			env.EXPECT().List().Return([]string{"EXTRA_OUTPUT_SIZE=2048"})
+
+			err := runner.ExecD(path, env)
+			h.AssertError(t, err, fmt.Sprintf("output from exec.d file at path '%s' exceeds 1024 bytes", path))
+		})
+
+		it("allows output within the maximum size", func() {
+			runner.MaxOutputSize = 1024
+			env.EXPECT().List().Return([]string{"EXTRA_OUTPUT_SIZE=512"})
+			env.EXPECT().Set(gomock.Any(), gomock.Any()).Times(2)
+
+			h.AssertNil(t, runner.ExecD(path, env))
+		})
+
+		it("errors when the output sets an invalid variable name", func() {
+			env.EXPECT().List().Return([]string{"INVALID_NAME=true"})
+
+			err := runner.ExecD(path, env)
+			h.AssertError(t, err, "sets invalid environment variable name 'INVALID=NAME'")
+		})
 	})
 }
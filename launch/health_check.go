@@ -0,0 +1,244 @@
+package launch
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HealthCheckFlag is the launcher argument that runs the health check of a process type instead of launching it
+const HealthCheckFlag = "--health-check"
+
+const (
+	HealthCheckHTTP = "http"
+	HealthCheckTCP  = "tcp"
+	HealthCheckExec = "exec"
+
+	DefaultHealthCheckTimeout = 30 * time.Second
+)
+
+// HealthCheck is the health check a buildpack declares for a process type in launch.toml.
+//
+// HTTP checks succeed when a GET request to Path on Port returns a 2xx or 3xx status,
+// TCP checks succeed when a connection to Port can be opened,
+// and exec checks succeed when Command exits with status 0.
+// When Port is unset the port is read from $PORT in the process environment.
+type HealthCheck struct {
+	Type        string   `toml:"type" json:"type"`
+	Path        string   `toml:"path,omitempty" json:"path,omitempty"`
+	Port        int      `toml:"port,omitempty" json:"port,omitempty"`
+	Command     []string `toml:"command,omitempty" json:"command,omitempty"`
+	Interval    string   `toml:"interval,omitempty" json:"interval,omitempty"`
+	Timeout     string   `toml:"timeout,omitempty" json:"timeout,omitempty"`
+	StartPeriod string   `toml:"start-period,omitempty" json:"startPeriod,omitempty"`
+	Retries     int      `toml:"retries,omitempty" json:"retries,omitempty"`
+}
+
+// HealthCheckTimings are the parsed durations of a health check, unset durations are zero
+type HealthCheckTimings struct {
+	Interval    time.Duration
+	Timeout     time.Duration
+	StartPeriod time.Duration
+}
+
+// Validate returns an error describing the first invalid field of the health check
+func (hc HealthCheck) Validate() error {
+	switch hc.Type {
+	case HealthCheckHTTP, HealthCheckTCP:
+		if hc.Port < 0 || hc.Port > 65535 {
+			return fmt.Errorf("port %d is out of range", hc.Port)
+		}
+	case HealthCheckExec:
+		if len(hc.Command) == 0 {
+			return errors.New("exec health checks require a command")
+		}
+	default:
+		return fmt.Errorf("unknown health check type '%s', must be one of '%s', '%s' or '%s'", hc.Type, HealthCheckHTTP, HealthCheckTCP, HealthCheckExec)
+	}
+	if hc.Retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	_, err := hc.Timings()
+	return err
+}
+
+// Timings parses the durations of the health check
+func (hc HealthCheck) Timings() (HealthCheckTimings, error) {
+	var (
+		timings HealthCheckTimings
+		err     error
+	)
+	for _, d := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"interval", hc.Interval, &timings.Interval},
+		{"timeout", hc.Timeout, &timings.Timeout},
+		{"start-period", hc.StartPeriod, &timings.StartPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if *d.dest, err = time.ParseDuration(d.value); err != nil {
+			return HealthCheckTimings{}, errors.Wrapf(err, "parse %s", d.name)
+		}
+		if *d.dest < 0 {
+			return HealthCheckTimings{}, fmt.Errorf("%s must not be negative", d.name)
+		}
+	}
+	return timings, nil
+}
+
+// CheckHealth runs the health check declared by the process type once.
+// Exec checks are launched like a direct process, with the environment the process type would have.
+func (l *Launcher) CheckHealth(proc Process) error {
+	if proc.HealthCheck == nil {
+		return fmt.Errorf("process type '%s' does not declare a health check", proc.Type)
+	}
+	hc := *proc.HealthCheck
+	timings, err := hc.Timings()
+	if err != nil {
+		return err
+	}
+	timeout := timings.Timeout
+	if timeout == 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	switch hc.Type {
+	case HealthCheckHTTP, HealthCheckTCP:
+		procEnv, err := l.processEnv(proc.Type)
+		if err != nil {
+			return err
+		}
+		port, err := healthCheckPort(hc, procEnv)
+		if err != nil {
+			return err
+		}
+		addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+		if hc.Type == HealthCheckTCP {
+			conn, err := net.DialTimeout("tcp", addr, timeout)
+			if err != nil {
+				return errors.Wrapf(err, "connect to %s", addr)
+			}
+			return conn.Close()
+		}
+		return checkHTTP("http://"+addr+healthCheckPath(hc), timeout)
+	case HealthCheckExec:
+		cl := l.checkLauncher()
+		cl.Exec = func(argv0 string, argv []string, envv []string) error {
+			cmd := exec.Command(argv0, argv[1:]...)
+			cmd.Env = envv
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			if err := cmd.Start(); err != nil {
+				return err
+			}
+			done := make(chan error, 1)
+			go func() { done <- cmd.Wait() }()
+			select {
+			case err := <-done:
+				return err
+			case <-time.After(timeout):
+				_ = cmd.Process.Kill()
+				<-done
+				return fmt.Errorf("command did not exit within %s", timeout)
+			}
+		}
+		return cl.LaunchProcess(proc.Type, Process{
+			Type:        proc.Type,
+			Command:     hc.Command[0],
+			Args:        hc.Command[1:],
+			Direct:      true,
+			BuildpackID: proc.BuildpackID,
+		})
+	default:
+		return fmt.Errorf("unknown health check type '%s'", hc.Type)
+	}
+}
+
+// WaitHealthy runs the health check declared by the process type until it succeeds or wait elapses,
+// it returns the error from the last check
+func (l *Launcher) WaitHealthy(proc Process, wait time.Duration) error {
+	interval := time.Second
+	if proc.HealthCheck != nil {
+		if timings, err := proc.HealthCheck.Timings(); err == nil && timings.Interval > 0 && timings.Interval < interval {
+			interval = timings.Interval
+		}
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		err := l.CheckHealth(proc)
+		if err == nil || time.Now().Add(interval).After(deadline) {
+			return err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// checkLauncher returns a copy of the launcher for a single check.
+// Each check starts from a fresh environment so that repeated checks do not modify it twice.
+func (l *Launcher) checkLauncher() Launcher {
+	cl := *l
+	if l.NewEnv != nil {
+		cl.Env = l.NewEnv(os.Environ())
+	}
+	return cl
+}
+
+// processEnv returns the environment the launcher builds for the process type, including buildpack env and exec.d output
+func (l *Launcher) processEnv(procType string) (Env, error) {
+	cl := l.checkLauncher()
+	if err := cl.doEnv(procType); err != nil {
+		return nil, errors.Wrap(err, "modify env")
+	}
+	if err := cl.doExecD(procType); err != nil {
+		return nil, errors.Wrap(err, "exec.d")
+	}
+	return cl.Env, nil
+}
+
+func checkHTTP(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url) // #nosec G107
+	if err != nil {
+		return errors.Wrapf(err, "request %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("request %s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+func healthCheckPort(hc HealthCheck, env Env) (int, error) {
+	if hc.Port != 0 {
+		return hc.Port, nil
+	}
+	val := env.Get("PORT")
+	if val == "" {
+		return 0, errors.New("health check has no port and PORT is not set")
+	}
+	port, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse PORT '%s'", val)
+	}
+	return port, nil
+}
+
+func healthCheckPath(hc HealthCheck) string {
+	switch {
+	case hc.Path == "":
+		return "/"
+	case hc.Path[0] != '/':
+		return "/" + hc.Path
+	default:
+		return hc.Path
+	}
+}
@@ -0,0 +1,212 @@
+package launch_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/env"
+	"github.com/buildpacks/lifecycle/launch"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestHealthCheck(t *testing.T) {
+	spec.Run(t, "HealthCheck", testHealthCheck, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testHealthCheck(t *testing.T, when spec.G, it spec.S) {
+	portOf := func(addr string) int {
+		t.Helper()
+		_, port, err := net.SplitHostPort(addr)
+		h.AssertNil(t, err)
+		p, err := strconv.Atoi(port)
+		h.AssertNil(t, err)
+		return p
+	}
+
+	when("#Validate", func() {
+		it("accepts valid health checks", func() {
+			for _, hc := range []launch.HealthCheck{
+				{Type: "http"},
+				{Type: "http", Path: "/healthz", Port: 8080, Interval: "10s", Timeout: "1s", StartPeriod: "1m", Retries: 3},
+				{Type: "tcp", Port: 5432},
+				{Type: "exec", Command: []string{"some-command", "some-arg"}},
+			} {
+				h.AssertNil(t, hc.Validate())
+			}
+		})
+
+		it("errors for invalid health checks", func() {
+			for _, tc := range []struct {
+				hc       launch.HealthCheck
+				expected string
+			}{
+				{launch.HealthCheck{Type: "udp"}, "unknown health check type 'udp'"},
+				{launch.HealthCheck{Type: "tcp", Port: 70000}, "port 70000 is out of range"},
+				{launch.HealthCheck{Type: "exec"}, "exec health checks require a command"},
+				{launch.HealthCheck{Type: "http", Interval: "often"}, "parse interval"},
+				{launch.HealthCheck{Type: "http", Timeout: "-1s"}, "timeout must not be negative"},
+				{launch.HealthCheck{Type: "http", Retries: -1}, "retries must not be negative"},
+			} {
+				err := tc.hc.Validate()
+				h.AssertNotNil(t, err)
+				h.AssertStringContains(t, err.Error(), tc.expected)
+			}
+		})
+	})
+
+	when("#CheckHealth", func() {
+		var (
+			launcher *launch.Launcher
+			tmpDir   string
+			wd       string
+		)
+
+		it.Before(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "lifecycle.health-check")
+			h.AssertNil(t, err)
+			wd, err = os.Getwd()
+			h.AssertNil(t, err)
+			launcher = &launch.Launcher{
+				AppDir:      tmpDir,
+				LayersDir:   tmpDir,
+				PlatformAPI: api.MustParse("0.5"),
+				Env:         env.NewLaunchEnv(os.Environ(), "", ""),
+				ExecD:       launch.NewExecDRunner(),
+				Setenv:      func(string, string) error { return nil },
+			}
+		})
+
+		it.After(func() {
+			h.AssertNil(t, os.Chdir(wd))
+			h.AssertNil(t, os.RemoveAll(tmpDir))
+		})
+
+		when("the health check is http", func() {
+			var (
+				server *httptest.Server
+				status int
+			)
+
+			it.Before(func() {
+				status = http.StatusOK
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != "/healthz" {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.WriteHeader(status)
+				}))
+			})
+
+			it.After(func() {
+				server.Close()
+			})
+
+			it("succeeds when the request succeeds", func() {
+				proc := launch.Process{Type: "web", HealthCheck: &launch.HealthCheck{Type: "http", Path: "healthz", Port: portOf(server.Listener.Addr().String())}}
+				h.AssertNil(t, launcher.CheckHealth(proc))
+			})
+
+			it("reads the port from PORT when it is not set", func() {
+				launcher.Env.Set("PORT", strconv.Itoa(portOf(server.Listener.Addr().String())))
+				proc := launch.Process{Type: "web", HealthCheck: &launch.HealthCheck{Type: "http", Path: "/healthz"}}
+				h.AssertNil(t, launcher.CheckHealth(proc))
+			})
+
+			it("reads PORT from the environment the process would have", func() {
+				launcher.Buildpacks = []launch.Buildpack{{ID: "some/buildpack", API: "0.5"}}
+				envDir := filepath.Join(tmpDir, "some_buildpack", "some-layer", "env.launch", "web")
+				h.AssertNil(t, os.MkdirAll(envDir, 0755))
+				port := strconv.Itoa(portOf(server.Listener.Addr().String()))
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(envDir, "PORT"), []byte(port), 0600))
+
+				proc := launch.Process{Type: "web", HealthCheck: &launch.HealthCheck{Type: "http", Path: "/healthz"}}
+				h.AssertNil(t, launcher.CheckHealth(proc))
+			})
+
+			it("fails when the request returns an error status", func() {
+				status = http.StatusServiceUnavailable
+				proc := launch.Process{Type: "web", HealthCheck: &launch.HealthCheck{Type: "http", Path: "/healthz", Port: portOf(server.Listener.Addr().String())}}
+				err := launcher.CheckHealth(proc)
+				h.AssertNotNil(t, err)
+				h.AssertStringContains(t, err.Error(), "returned status 503")
+			})
+		})
+
+		when("the health check is tcp", func() {
+			it("succeeds when the port accepts connections and fails when it does not", func() {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				h.AssertNil(t, err)
+				proc := launch.Process{Type: "db", HealthCheck: &launch.HealthCheck{Type: "tcp", Port: portOf(listener.Addr().String())}}
+
+				h.AssertNil(t, launcher.CheckHealth(proc))
+				h.AssertNil(t, listener.Close())
+				h.AssertNotNil(t, launcher.CheckHealth(proc))
+			})
+		})
+
+		when("the health check is exec", func() {
+			it.Before(func() {
+				if runtime.GOOS == "windows" {
+					t.Skip("exec health check tests use sh")
+				}
+			})
+
+			it("succeeds when the command exits with status 0", func() {
+				proc := launch.Process{Type: "worker", HealthCheck: &launch.HealthCheck{Type: "exec", Command: []string{"sh", "-c", "exit 0"}}}
+				h.AssertNil(t, launcher.CheckHealth(proc))
+			})
+
+			it("fails when the command exits with a non-zero status", func() {
+				proc := launch.Process{Type: "worker", HealthCheck: &launch.HealthCheck{Type: "exec", Command: []string{"sh", "-c", "exit 1"}}}
+				h.AssertNotNil(t, launcher.CheckHealth(proc))
+			})
+
+			it("fails when the command does not exit within the timeout", func() {
+				proc := launch.Process{Type: "worker", HealthCheck: &launch.HealthCheck{Type: "exec", Command: []string{"sleep", "5"}, Timeout: "100ms"}}
+				err := launcher.CheckHealth(proc)
+				h.AssertNotNil(t, err)
+				h.AssertStringContains(t, err.Error(), "did not exit within 100ms")
+			})
+		})
+
+		it("errors when the process type does not declare a health check", func() {
+			err := launcher.CheckHealth(launch.Process{Type: "web"})
+			h.AssertError(t, err, "process type 'web' does not declare a health check")
+		})
+	})
+
+	when("#WaitHealthy", func() {
+		it("retries until the health check succeeds", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			h.AssertNil(t, err)
+			addr := listener.Addr().String()
+			h.AssertNil(t, listener.Close())
+
+			go func() {
+				time.Sleep(300 * time.Millisecond)
+				if l, err := net.Listen("tcp", addr); err == nil {
+					defer l.Close()
+					time.Sleep(2 * time.Second)
+				}
+			}()
+
+			launcher := &launch.Launcher{Env: env.NewLaunchEnv(nil, "", "")}
+			proc := launch.Process{Type: "db", HealthCheck: &launch.HealthCheck{Type: "tcp", Port: portOf(addr), Interval: "100ms"}}
+			h.AssertNil(t, launcher.WaitHealthy(proc, 2*time.Second))
+		})
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -21,12 +23,14 @@ var (
 type Launcher struct {
 	AppDir             string
 	Buildpacks         []Buildpack
+	ConcurrentExecD    bool // ConcurrentExecD runs exec.d binaries concurrently, each with the environment from before any of them ran
 	DefaultProcessType string
 	Env                Env
 	Exec               ExecFunc
 	ExecD              ExecD
 	Shell              Shell
 	LayersDir          string
+	NewEnv             func(environ []string) Env // NewEnv creates the environment of each process launched by LaunchProcesses from environ
 	PlatformAPI        *api.Version
 	Processes          []Process
 	Setenv             func(string, string) error
@@ -106,12 +110,129 @@ func (l *Launcher) doEnv(procType string) error {
 }
 
 func (l *Launcher) doExecD(procType string) error {
-	return l.eachBuildpack(func(bpAPI *api.Version, bpDir string) error {
+	return l.doExecDWith(procType, func(_ execDBinary, set func() error) error {
+		return set()
+	})
+}
+
+// doExecDWith runs the exec.d binaries for procType, calling record with each binary
+// and a function that sets the variables returned by the binary in the environment
+func (l *Launcher) doExecDWith(procType string, record execDRecordFunc) error {
+	binaries, err := l.execDBinaries(procType)
+	if err != nil {
+		return err
+	}
+	if l.ConcurrentExecD {
+		return l.doExecDConcurrently(binaries, record)
+	}
+	for _, b := range binaries {
+		b := b
+		if err := record(b, func() error { return l.ExecD.ExecD(b.path, l.Env) }); err != nil {
+			return b.wrap(err)
+		}
+	}
+	return nil
+}
+
+type execDRecordFunc func(b execDBinary, set func() error) error
+
+// doExecDConcurrently runs the binaries concurrently, each with the environment from before any of them ran,
+// then sets the variables returned by each binary in the order the binaries would have run sequentially
+func (l *Launcher) doExecDConcurrently(binaries []execDBinary, record execDRecordFunc) error {
+	results := make([]*execDEnv, len(binaries))
+	errs := make([]error, len(binaries))
+	var wg sync.WaitGroup
+	for i, b := range binaries {
+		results[i] = &execDEnv{Env: l.Env, vars: map[string]string{}}
+		wg.Add(1)
+		go func(i int, b execDBinary) {
+			defer wg.Done()
+			errs[i] = l.ExecD.ExecD(b.path, results[i])
+		}(i, b)
+	}
+	wg.Wait()
+	for i, b := range binaries {
+		if errs[i] != nil {
+			return b.wrap(errs[i])
+		}
+	}
+	for i, b := range binaries {
+		result := results[i]
+		if err := record(b, func() error {
+			result.apply(l.Env)
+			return nil
+		}); err != nil {
+			return b.wrap(err)
+		}
+	}
+	return nil
+}
+
+// execDBinary is an exec.d binary and the buildpack and layer that provided it
+type execDBinary struct {
+	path        string
+	buildpackID string
+	layer       string
+}
+
+func (b execDBinary) wrap(err error) error {
+	return errors.Wrapf(err, "buildpack '%s' layer '%s'", b.buildpackID, b.layer)
+}
+
+// execDBinaries returns the exec.d binaries for procType in the order they run
+func (l *Launcher) execDBinaries(procType string) ([]execDBinary, error) {
+	var binaries []execDBinary
+	err := l.eachBuildpack(func(bpAPI *api.Version, bpDir string) error {
 		if !supportsExecD(bpAPI) {
 			return nil
 		}
-		return eachLayer(bpDir, l.doLayerExecD(procType))
+		bpID := l.buildpackID(bpDir)
+		return eachLayer(bpDir, func(layerDir string) error {
+			add := func(path string) error {
+				binaries = append(binaries, execDBinary{path: path, buildpackID: bpID, layer: filepath.Base(layerDir)})
+				return nil
+			}
+			if err := eachFile(filepath.Join(layerDir, "exec.d"), add); err != nil {
+				return err
+			}
+			if procType == "" {
+				return nil
+			}
+			return eachFile(filepath.Join(layerDir, "exec.d", procType), add)
+		})
 	})
+	return binaries, err
+}
+
+func (l *Launcher) buildpackID(bpDir string) string {
+	for _, bp := range l.Buildpacks {
+		if filepath.Join(l.LayersDir, EscapeID(bp.ID)) == bpDir {
+			return bp.ID
+		}
+	}
+	return filepath.Base(bpDir)
+}
+
+// execDEnv is the environment of an exec.d binary run concurrently with others,
+// it records the variables set by the binary instead of setting them in the shared environment
+type execDEnv struct {
+	Env
+	vars map[string]string
+}
+
+func (e *execDEnv) Set(name, val string) {
+	e.vars[name] = val
+}
+
+func (e *execDEnv) apply(env Env) {
+	names := make([]string, 0, len(e.vars))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env.Set(name, e.vars[name])
+	}
 }
 
 func supportsExecD(bpAPI *api.Version) bool {
@@ -161,22 +282,6 @@ func (l *Launcher) doLayerEnvFiles(procType string, defaultAction env.ActionType
 	}
 }
 
-func (l *Launcher) doLayerExecD(procType string) dirAction {
-	return func(path string) error {
-		if err := eachFile(filepath.Join(path, "exec.d"), func(path string) error {
-			return l.ExecD.ExecD(path, l.Env)
-		}); err != nil {
-			return err
-		}
-		if procType == "" {
-			return nil
-		}
-		return eachFile(filepath.Join(path, "exec.d", procType), func(path string) error {
-			return l.ExecD.ExecD(path, l.Env)
-		})
-	}
-}
-
 func eachLayer(bpDir string, action dirAction) error {
 	return eachInDir(bpDir, action, func(fi os.FileInfo) bool {
 		return fi.IsDir()
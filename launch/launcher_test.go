@@ -1,6 +1,7 @@
 package launch_test
 
 import (
+	"errors"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -313,6 +314,69 @@ func testLauncher(t *testing.T, when spec.G, it spec.S) {
 						}
 					})
 
+					it("should name the buildpack and layer when an exec.d binary fails", func() {
+						mockEnv.EXPECT().AddRootDir(gomock.Any()).AnyTimes()
+						mockEnv.EXPECT().AddEnvDir(gomock.Any(), gomock.Any()).AnyTimes()
+						execd.EXPECT().ExecD(
+							filepath.Join(tmpDir, "launch", "0.5_buildpack", "layer5", "exec.d", "exec_d_1"),
+							mockEnv,
+						).Return(errors.New("some-error"))
+
+						err := launcher.LaunchProcess("", process)
+						h.AssertError(t, err, "buildpack '0.5/buildpack' layer 'layer5': some-error")
+					})
+
+					when("exec.d binaries run concurrently", func() {
+						it.Before(func() {
+							launcher.ConcurrentExecD = true
+							mockEnv.EXPECT().AddRootDir(gomock.Any()).AnyTimes()
+							mockEnv.EXPECT().AddEnvDir(gomock.Any(), gomock.Any()).AnyTimes()
+						})
+
+						it("should set the returned variables in the order the binaries would run sequentially", func() {
+							execd.EXPECT().ExecD(
+								filepath.Join(tmpDir, "launch", "0.5_buildpack", "layer5", "exec.d", "exec_d_1"),
+								gomock.Any(),
+							).DoAndReturn(func(_ string, env launch.Env) error {
+								time.Sleep(100 * time.Millisecond) // finish after exec_d_2
+								env.Set("SOME_VAR", "exec_d_1")
+								env.Set("OTHER_VAR", "exec_d_1")
+								return nil
+							})
+							execd.EXPECT().ExecD(
+								filepath.Join(tmpDir, "launch", "0.5_buildpack", "layer5", "exec.d", "exec_d_2"),
+								gomock.Any(),
+							).DoAndReturn(func(_ string, env launch.Env) error {
+								env.Set("SOME_VAR", "exec_d_2")
+								return nil
+							})
+							gomock.InOrder(
+								mockEnv.EXPECT().Set("OTHER_VAR", "exec_d_1"),
+								mockEnv.EXPECT().Set("SOME_VAR", "exec_d_1"),
+								mockEnv.EXPECT().Set("SOME_VAR", "exec_d_2"),
+							)
+
+							h.AssertNil(t, launcher.LaunchProcess("", process))
+						})
+
+						it("should not set any variables when a binary fails", func() {
+							execd.EXPECT().ExecD(
+								filepath.Join(tmpDir, "launch", "0.5_buildpack", "layer5", "exec.d", "exec_d_1"),
+								gomock.Any(),
+							).DoAndReturn(func(_ string, env launch.Env) error {
+								env.Set("SOME_VAR", "exec_d_1")
+								return nil
+							})
+							execd.EXPECT().ExecD(
+								filepath.Join(tmpDir, "launch", "0.5_buildpack", "layer5", "exec.d", "exec_d_2"),
+								gomock.Any(),
+							).Return(errors.New("some-error"))
+
+							err := launcher.LaunchProcess("", process)
+							h.AssertError(t, err, "buildpack '0.5/buildpack' layer 'layer5': some-error")
+						})
+					})
+
 					when("process is buildpack-provided", func() {
 						it.Before(func() {
 							process.Type = "some-process-type"
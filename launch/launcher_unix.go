@@ -2,15 +2,38 @@
 
 package launch
 
-import "syscall"
+import (
+	"fmt"
+	"syscall"
+)
 
 const (
 	CNBDir     = `/cnb`
 	exe        = ""
 	appProfile = ".profile"
+
+	// envCommand prints the environment of the shell, each variable terminated by envSeparator
+	envCommand   = "env -0"
+	envSeparator = "\x00"
 )
 
 var (
 	OSExecFunc   = syscall.Exec
 	DefaultShell = &BashShell{Exec: OSExecFunc}
 )
+
+// NewShell returns the default shell for the OS, launching processes with execFunc
+func NewShell(execFunc ExecFunc) Shell {
+	return &BashShell{Exec: execFunc}
+}
+
+// profilesEnvProcess returns a shell process that sources profiles in order,
+// printing the environment before and after each of them, each environment followed by an extra envSeparator
+func profilesEnvProcess(profiles []string) ShellProcess {
+	printEnv := envCommand + ` && printf '\0'`
+	script := printEnv
+	for _, profile := range profiles {
+		script += fmt.Sprintf("\nsource \"%s\"\n%s", profile, printEnv)
+	}
+	return ShellProcess{Script: true, Command: script}
+}
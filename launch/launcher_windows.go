@@ -9,12 +9,21 @@ const (
 	CNBDir     = `c:\cnb`
 	exe        = ".exe"
 	appProfile = ".profile.bat"
+
+	// envCommand prints the environment of the shell, each variable terminated by envSeparator
+	envCommand   = "set"
+	envSeparator = "\r\n"
 )
 
 var (
 	DefaultShell = &CmdShell{Exec: OSExecFunc}
 )
 
+// NewShell returns the default shell for the OS, launching processes with execFunc
+func NewShell(execFunc ExecFunc) Shell {
+	return &CmdShell{Exec: execFunc}
+}
+
 func OSExecFunc(argv0 string, argv []string, envv []string) error {
 	c := exec.Command(argv[0], argv[1:]...)
 	c.Env = envv
@@ -23,3 +32,13 @@ func OSExecFunc(argv0 string, argv []string, envv []string) error {
 	c.Stderr = os.Stderr
 	return c.Run()
 }
+
+// profilesEnvProcess returns a shell process that calls profiles in order,
+// printing the environment before and after each of them, each environment followed by an extra envSeparator
+func profilesEnvProcess(profiles []string) ShellProcess {
+	args := []string{"&&", "echo."}
+	for _, profile := range profiles {
+		args = append(args, "&&", "call", profile, "&&", envCommand, "&&", "echo.")
+	}
+	return ShellProcess{Command: envCommand, Args: args}
+}
@@ -0,0 +1,237 @@
+package launch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ExitPolicy string
+
+const (
+	// ExitPolicyAny stops every process in the group when the first process exits
+	ExitPolicyAny ExitPolicy = "any"
+	// ExitPolicyAll waits for every process in the group to exit
+	ExitPolicyAll ExitPolicy = "all"
+)
+
+// ParseExitPolicy returns the ExitPolicy named by s
+func ParseExitPolicy(s string) (ExitPolicy, error) {
+	switch policy := ExitPolicy(s); policy {
+	case ExitPolicyAny, ExitPolicyAll:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown exit policy '%s', must be one of '%s' or '%s'", s, ExitPolicyAny, ExitPolicyAll)
+	}
+}
+
+// GroupProcess is a fully resolved command, ready to be started as part of a ProcessGroup
+type GroupProcess struct {
+	Type  string
+	Argv0 string
+	Argv  []string
+	Env   []string
+}
+
+// ProcessGroup runs several processes together as children of the launcher.
+// Each line a process writes to stdout or stderr is prefixed with its process type.
+type ProcessGroup struct {
+	ExitPolicy ExitPolicy
+	// GracePeriod is how long the remaining processes have to exit after they are asked to stop before they are killed
+	GracePeriod time.Duration
+	Logger      Logger
+	Out, Err    io.Writer
+}
+
+// NewProcessGroup creates a ProcessGroup that writes to the launcher's stdout and stderr
+func NewProcessGroup(policy ExitPolicy, logger Logger) *ProcessGroup {
+	return &ProcessGroup{
+		ExitPolicy:  policy,
+		GracePeriod: 10 * time.Second,
+		Logger:      logger,
+		Out:         os.Stdout,
+		Err:         os.Stderr,
+	}
+}
+
+// LaunchProcesses launches the given process types together in a ProcessGroup.
+// Each process gets its own environment, modified by the env files, exec.d binaries and profile scripts for its type.
+// For direct=false processes, self is used to set argv0 during profile script execution
+func (l *Launcher) LaunchProcesses(self string, types []string, group *ProcessGroup) error {
+	if l.NewEnv == nil {
+		return errors.New("launching multiple process types requires a new environment for each process")
+	}
+	// launching a direct process sets PATH in the environment of the launcher,
+	// so every process environment is created from the environment before any process was prepared
+	environ := os.Environ()
+	var procs []GroupProcess
+	for _, pType := range types {
+		proc, ok := l.findProcessType(pType)
+		if !ok {
+			return fmt.Errorf("process type %s was not found", pType)
+		}
+		// the environment of each process is resolved one at a time,
+		// the resulting commands are collected and started together once every process is resolved
+		procLauncher := *l
+		procLauncher.Env = l.NewEnv(environ)
+		procLauncher.Exec = func(argv0 string, argv []string, envv []string) error {
+			procs = append(procs, GroupProcess{Type: pType, Argv0: argv0, Argv: argv, Env: envv})
+			return nil
+		}
+		procLauncher.Shell = NewShell(procLauncher.Exec)
+		if err := procLauncher.LaunchProcess(self, proc); err != nil {
+			return errors.Wrapf(err, "prepare process type '%s'", pType)
+		}
+	}
+	return group.Run(procs)
+}
+
+type groupExit struct {
+	index int
+	code  int
+}
+
+// Run starts procs and waits for them to exit according to the exit policy.
+// Signals received by the launcher are forwarded to every running process.
+// Run returns nil if the processes succeeded and an *ExitError otherwise.
+// With ExitPolicyAny the exit code is that of the first process to exit,
+// with ExitPolicyAll it is the first non-zero exit code.
+func (g *ProcessGroup) Run(procs []GroupProcess) error {
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals, groupSignals...)
+	defer signal.Stop(signals)
+
+	var (
+		mu      sync.Mutex // serializes lines written by different processes
+		cmds    []*exec.Cmd
+		running = map[int]bool{}
+		exits   = make(chan groupExit, len(procs))
+	)
+	for i, proc := range procs {
+		prefix := fmt.Sprintf("[%s] ", proc.Type)
+		stdout := &prefixWriter{prefix: prefix, out: g.Out, mu: &mu}
+		stderr := &prefixWriter{prefix: prefix, out: g.Err, mu: &mu}
+		cmd := &exec.Cmd{
+			Path:   proc.Argv0,
+			Args:   proc.Argv,
+			Env:    proc.Env,
+			Stdout: stdout,
+			Stderr: stderr,
+		}
+		if err := cmd.Start(); err != nil {
+			g.stop(cmds, running)
+			for range running {
+				<-exits
+			}
+			return errors.Wrapf(err, "start process type '%s'", proc.Type)
+		}
+		cmds = append(cmds, cmd)
+		running[i] = true
+		go func(index int) {
+			if err := cmd.Wait(); err != nil && cmd.ProcessState == nil {
+				g.Logger.Warnf("Unable to wait for process type '%s': %s", procs[index].Type, err)
+			}
+			stdout.Flush()
+			stderr.Flush()
+			exits <- groupExit{index: index, code: processStateCode(cmd.ProcessState)}
+		}(i)
+	}
+
+	var (
+		code      int
+		exited    bool
+		stopping  bool
+		killTimer <-chan time.Time
+	)
+	for len(running) > 0 {
+		select {
+		case exit := <-exits:
+			delete(running, exit.index)
+			g.Logger.Infof("Process type '%s' exited with status %d", procs[exit.index].Type, exit.code)
+			if (g.ExitPolicy == ExitPolicyAny && !exited) || (g.ExitPolicy == ExitPolicyAll && code == 0) {
+				code = exit.code
+			}
+			exited = true
+			if g.ExitPolicy == ExitPolicyAny && !stopping && len(running) > 0 {
+				stopping = true
+				g.stop(cmds, running)
+				killTimer = time.After(g.GracePeriod)
+			}
+		case sig := <-signals:
+			for i := range running {
+				if err := cmds[i].Process.Signal(sig); err != nil {
+					g.Logger.Warnf("Unable to forward signal '%s' to process type '%s': %s", sig, procs[i].Type, err)
+				}
+			}
+			if isStopSignal(sig) && !stopping {
+				stopping = true
+				killTimer = time.After(g.GracePeriod)
+			}
+		case <-killTimer:
+			for i := range running {
+				g.Logger.Warnf("Process type '%s' did not exit within %s, killing it", procs[i].Type, g.GracePeriod)
+				if err := cmds[i].Process.Kill(); err != nil {
+					g.Logger.Warnf("Unable to kill process type '%s': %s", procs[i].Type, err)
+				}
+			}
+			killTimer = nil
+		}
+	}
+	if code != 0 {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+func (g *ProcessGroup) stop(cmds []*exec.Cmd, running map[int]bool) {
+	for i := range running {
+		if err := terminate(cmds[i].Process); err != nil {
+			g.Logger.Warnf("Unable to stop process: %s", err)
+		}
+	}
+}
+
+// prefixWriter prefixes each line written to out, holding partial lines until they are completed or flushed
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes any partial line, terminated with a newline
+func (w *prefixWriter) Flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+	_ = w.writeLine(append(w.buf, '\n'))
+	w.buf = nil
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(append([]byte(w.prefix), line...))
+	return err
+}
@@ -0,0 +1,195 @@
+// +build linux darwin
+
+package launch_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/env"
+	"github.com/buildpacks/lifecycle/launch"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestProcessGroup(t *testing.T) {
+	spec.Run(t, "ProcessGroup", testProcessGroup, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testProcessGroup(t *testing.T, when spec.G, it spec.S) {
+	var (
+		group      *launch.ProcessGroup
+		logHandler *memory.Handler
+		stdout     *bytes.Buffer
+		stderr     *bytes.Buffer
+	)
+
+	it.Before(func() {
+		logHandler = memory.New()
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+		group = launch.NewProcessGroup(launch.ExitPolicyAny, &log.Logger{Handler: logHandler, Level: log.DebugLevel})
+		group.Out, group.Err = stdout, stderr
+	})
+
+	waitFor := func(path string) string {
+		return "while [ ! -f " + path + " ]; do sleep 0.05; done; "
+	}
+
+	sh := func(pType, script string) launch.GroupProcess {
+		return launch.GroupProcess{Type: pType, Argv0: "/bin/sh", Argv: []string{"sh", "-c", script}, Env: os.Environ()}
+	}
+
+	when("#Run", func() {
+		it("prefixes the output of each process with its type", func() {
+			h.AssertNil(t, group.Run([]launch.GroupProcess{
+				sh("web", "echo web-out; echo web-err >&2; printf partial"),
+			}))
+
+			h.AssertEq(t, stdout.String(), "[web] web-out\n[web] partial\n")
+			h.AssertEq(t, stderr.String(), "[web] web-err\n")
+		})
+
+		when("the exit policy is any", func() {
+			var ready string
+
+			it.Before(func() {
+				tmpDir, err := ioutil.TempDir("", "lifecycle.process-group")
+				h.AssertNil(t, err)
+				ready = filepath.Join(tmpDir, "ready")
+			})
+
+			it.After(func() {
+				h.AssertNil(t, os.RemoveAll(filepath.Dir(ready)))
+			})
+
+			it("stops the other processes when one exits", func() {
+				start := time.Now()
+				err := group.Run([]launch.GroupProcess{
+					sh("web", waitFor(ready)+"exit 3"),
+					sh("worker", "trap 'exit 0' TERM; touch "+ready+"; while true; do sleep 0.1; done"),
+				})
+
+				h.AssertEq(t, err.(*launch.ExitError).Code, 3)
+				h.AssertEq(t, time.Since(start) < 5*time.Second, true)
+				h.AssertStringContains(t, h.AllLogs(logHandler), "Process type 'worker' exited with status 0")
+			})
+
+			it("kills processes that do not stop within the grace period", func() {
+				group.GracePeriod = 100 * time.Millisecond
+				err := group.Run([]launch.GroupProcess{
+					sh("web", waitFor(ready)),
+					sh("worker", "trap '' TERM; touch "+ready+"; while true; do sleep 0.1; done"),
+				})
+
+				h.AssertNil(t, err)
+				h.AssertStringContains(t, h.AllLogs(logHandler), "Process type 'worker' did not exit within 100ms, killing it")
+			})
+		})
+
+		when("the exit policy is all", func() {
+			it.Before(func() {
+				group.ExitPolicy = launch.ExitPolicyAll
+			})
+
+			it("waits for every process and returns the first non-zero exit code", func() {
+				err := group.Run([]launch.GroupProcess{
+					sh("web", "exit 0"),
+					sh("worker", "sleep 0.2; exit 4"),
+					sh("other", "sleep 0.4; exit 5"),
+				})
+
+				h.AssertEq(t, err.(*launch.ExitError).Code, 4)
+				h.AssertStringContains(t, h.AllLogs(logHandler), "Process type 'other' exited with status 5")
+			})
+		})
+	})
+
+	when("#LaunchProcesses", func() {
+		var (
+			launcher *launch.Launcher
+			tmpDir   string
+			wd       string
+			path     string
+		)
+
+		it.Before(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "lifecycle.process-group")
+			h.AssertNil(t, err)
+			wd, err = os.Getwd()
+			h.AssertNil(t, err)
+			path = os.Getenv("PATH")
+
+			layersDir := filepath.Join(tmpDir, "layers")
+			appDir := filepath.Join(tmpDir, "app")
+			h.AssertNil(t, os.MkdirAll(appDir, 0755))
+			for pType, val := range map[string]string{"web": "web-value", "worker": "worker-value"} {
+				envDir := filepath.Join(layersDir, "some_buildpack", "some-layer", "env.launch", pType)
+				h.AssertNil(t, os.MkdirAll(envDir, 0755))
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(envDir, "SOME_VAR"), []byte(val), 0600))
+			}
+
+			newEnv := func(environ []string) launch.Env {
+				return env.NewLaunchEnv(environ, launch.ProcessDir, launch.LifecycleDir)
+			}
+			launcher = &launch.Launcher{
+				AppDir:      appDir,
+				LayersDir:   layersDir,
+				PlatformAPI: api.MustParse("0.5"),
+				Buildpacks:  []launch.Buildpack{{API: "0.5", ID: "some/buildpack"}},
+				Processes: []launch.Process{
+					{Type: "web", Command: "sh", Args: []string{"-c", "echo $SOME_VAR"}, Direct: true, BuildpackID: "some/buildpack"},
+					{Type: "worker", Command: "echo $SOME_VAR", BuildpackID: "some/buildpack"},
+				},
+				Env:    newEnv(os.Environ()),
+				NewEnv: newEnv,
+				ExecD:  launch.NewExecDRunner(),
+				Setenv: os.Setenv,
+			}
+			group.ExitPolicy = launch.ExitPolicyAll
+		})
+
+		it.After(func() {
+			h.AssertNil(t, os.Setenv("PATH", path))
+			h.AssertNil(t, os.Chdir(wd))
+			h.AssertNil(t, os.RemoveAll(tmpDir))
+		})
+
+		it("launches each process type with its own environment", func() {
+			h.AssertNil(t, launcher.LaunchProcesses("launcher", []string{"web", "worker"}, group))
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			h.AssertContains(t, lines, "[web] web-value", "[worker] worker-value")
+		})
+
+		it("does not leak the PATH of a direct process into the next process", func() {
+			envDir := filepath.Join(launcher.LayersDir, "some_buildpack", "some-layer", "env.launch", "web")
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(envDir, "PATH.prepend"), []byte("/web-only-path"), 0600))
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(envDir, "PATH.delim"), []byte(":"), 0600))
+			launcher.Processes[1].Command = "echo $PATH"
+
+			h.AssertNil(t, launcher.LaunchProcesses("launcher", []string{"web", "worker"}, group))
+
+			for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+				if strings.HasPrefix(line, "[worker]") {
+					h.AssertStringDoesNotContain(t, line, "/web-only-path")
+				}
+			}
+		})
+
+		it("errors when a process type does not exist", func() {
+			err := launcher.LaunchProcesses("launcher", []string{"web", "missing"}, group)
+			h.AssertError(t, err, "process type missing was not found")
+		})
+	})
+}
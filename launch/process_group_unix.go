@@ -0,0 +1,25 @@
+//+build linux darwin
+
+package launch
+
+import (
+	"os"
+	"syscall"
+)
+
+var groupSignals = forwardedSignals
+
+func isStopSignal(sig os.Signal) bool {
+	return sig == syscall.SIGTERM || sig == syscall.SIGINT
+}
+
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+func processStateCode(state *os.ProcessState) int {
+	if state == nil {
+		return 1
+	}
+	return exitCode(state.Sys().(syscall.WaitStatus))
+}
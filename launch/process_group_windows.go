@@ -0,0 +1,23 @@
+package launch
+
+import (
+	"os"
+)
+
+var groupSignals = []os.Signal{os.Interrupt}
+
+func isStopSignal(sig os.Signal) bool {
+	return sig == os.Interrupt
+}
+
+// terminate kills p, Windows processes cannot be asked to stop
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
+
+func processStateCode(state *os.ProcessState) int {
+	if state == nil {
+		return 1
+	}
+	return state.ExitCode()
+}
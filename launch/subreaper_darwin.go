@@ -0,0 +1,6 @@
+package launch
+
+// setChildSubreaper is a no-op, orphaned descendants are only reaped when the launcher is PID 1
+func setChildSubreaper() error {
+	return nil
+}
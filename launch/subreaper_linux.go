@@ -0,0 +1,9 @@
+package launch
+
+import "golang.org/x/sys/unix"
+
+// setChildSubreaper makes orphaned descendants become children of this process so that they can be reaped,
+// this is only necessary when the launcher is not PID 1
+func setChildSubreaper() error {
+	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
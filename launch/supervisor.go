@@ -0,0 +1,86 @@
+package launch
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+type Logger interface {
+	Infof(fmt string, v ...interface{})
+	Warnf(fmt string, v ...interface{})
+}
+
+// Supervisor runs a process as a child of the launcher instead of replacing the launcher with it.
+// While the child runs, the supervisor reaps orphaned descendants, forwards signals to the child,
+// and optionally restarts the child when it crashes.
+// Supervisor.Exec can be used wherever an ExecFunc is expected.
+type Supervisor struct {
+	// GracePeriod is how long the child has to exit after a forwarded SIGTERM or SIGINT before it is killed
+	GracePeriod time.Duration
+	// Restart enables restarting the child when it exits with a non-zero status
+	Restart bool
+	// MaxRestarts limits the number of restarts, zero means unlimited
+	MaxRestarts int
+	// RestartBackoff is the delay before the first restart, it is doubled before each subsequent restart
+	RestartBackoff time.Duration
+	// MaxRestartBackoff caps the delay between restarts, zero means uncapped
+	MaxRestartBackoff time.Duration
+	Logger            Logger
+
+	// Stdin, Stdout and Stderr are passed to the child directly, so that no output is lost when the supervisor exits
+	Stdin          *os.File
+	Stdout, Stderr *os.File
+}
+
+// NewSupervisor creates a Supervisor connected to the launcher's stdin, stdout and stderr
+func NewSupervisor(logger Logger) *Supervisor {
+	return &Supervisor{
+		GracePeriod:       10 * time.Second,
+		RestartBackoff:    time.Second,
+		MaxRestartBackoff: time.Minute,
+		Logger:            logger,
+		Stdin:             os.Stdin,
+		Stdout:            os.Stdout,
+		Stderr:            os.Stderr,
+	}
+}
+
+// ExitError is returned by Supervisor.Exec when the supervised process exits with a non-zero status.
+// Processes killed by a signal exit with 128 plus the signal number, following shell convention.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("process exited with status %d", e.Code)
+}
+
+// Exec runs argv as a child process and returns when it exits without being restarted.
+// It returns nil if the process exited successfully and an *ExitError otherwise.
+func (s *Supervisor) Exec(argv0 string, argv []string, envv []string) error {
+	signals := s.notify()
+	defer s.stopNotify(signals)
+
+	backoff := s.RestartBackoff
+	for restarts := 0; ; restarts++ {
+		code, stopped, err := s.run(argv0, argv, envv, signals)
+		if err != nil {
+			return err
+		}
+		if code == 0 {
+			return nil
+		}
+		if stopped || !s.Restart || (s.MaxRestarts > 0 && restarts >= s.MaxRestarts) {
+			return &ExitError{Code: code}
+		}
+		s.Logger.Warnf("Process exited with status %d, restarting in %s", code, backoff)
+		if stopped := s.wait(backoff, signals); stopped {
+			return &ExitError{Code: code}
+		}
+		backoff *= 2
+		if s.MaxRestartBackoff > 0 && backoff > s.MaxRestartBackoff {
+			backoff = s.MaxRestartBackoff
+		}
+	}
+}
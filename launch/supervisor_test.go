@@ -0,0 +1,157 @@
+// +build linux darwin
+
+package launch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/launch"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestSupervisor(t *testing.T) {
+	spec.Run(t, "Supervisor", testSupervisor, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testSupervisor(t *testing.T, when spec.G, it spec.S) {
+	var (
+		supervisor *launch.Supervisor
+		logHandler *memory.Handler
+		tmpDir     string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.supervisor")
+		h.AssertNil(t, err)
+		logHandler = memory.New()
+		supervisor = launch.NewSupervisor(&log.Logger{Handler: logHandler, Level: log.DebugLevel})
+		supervisor.RestartBackoff = time.Millisecond
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	sh := func(script string) error {
+		return supervisor.Exec("/bin/sh", []string{"sh", "-c", script}, os.Environ())
+	}
+
+	waitForFile := func(path string) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(path); err == nil {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for '%s'", path)
+	}
+
+	when("#Exec", func() {
+		it("returns nil when the process succeeds", func() {
+			h.AssertNil(t, sh("exit 0"))
+		})
+
+		it("returns the exit code of the process", func() {
+			err := sh("exit 3")
+			exitErr, ok := err.(*launch.ExitError)
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, exitErr.Code, 3)
+		})
+
+		it("returns 128 plus the signal number when the process is killed by a signal", func() {
+			err := sh("kill -KILL $$")
+			exitErr, ok := err.(*launch.ExitError)
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, exitErr.Code, 128+int(syscall.SIGKILL))
+		})
+
+		it("errors when the process cannot be started", func() {
+			err := supervisor.Exec(filepath.Join(tmpDir, "missing"), []string{"missing"}, os.Environ())
+			h.AssertError(t, err, "start process")
+		})
+
+		when("restart is enabled", func() {
+			it.Before(func() {
+				supervisor.Restart = true
+				supervisor.MaxRestarts = 2
+			})
+
+			it("restarts a crashing process up to the maximum number of restarts", func() {
+				counter := filepath.Join(tmpDir, "counter")
+				err := sh("echo run >> " + counter + "; exit 1")
+				h.AssertEq(t, err.(*launch.ExitError).Code, 1)
+
+				contents, err := ioutil.ReadFile(counter)
+				h.AssertNil(t, err)
+				h.AssertEq(t, strings.Count(string(contents), "run"), 3)
+				h.AssertStringContains(t, h.AllLogs(logHandler), "Process exited with status 1, restarting in")
+			})
+
+			it("does not restart a process that succeeds", func() {
+				counter := filepath.Join(tmpDir, "counter")
+				h.AssertNil(t, sh("echo run >> "+counter))
+
+				contents, err := ioutil.ReadFile(counter)
+				h.AssertNil(t, err)
+				h.AssertEq(t, strings.Count(string(contents), "run"), 1)
+			})
+		})
+
+		when("the launcher receives SIGTERM", func() {
+			it.Before(func() {
+				supervisor.Restart = true
+			})
+
+			it("forwards the signal and does not restart the process", func() {
+				ready := filepath.Join(tmpDir, "ready")
+				go func() {
+					waitForFile(ready)
+					h.AssertNil(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+				}()
+
+				err := sh("trap 'exit 143' TERM; touch " + ready + "; while true; do sleep 0.1; done")
+				h.AssertEq(t, err.(*launch.ExitError).Code, 143)
+			})
+
+			it("kills the process when it does not exit within the grace period", func() {
+				supervisor.GracePeriod = 100 * time.Millisecond
+				ready := filepath.Join(tmpDir, "ready")
+				go func() {
+					waitForFile(ready)
+					h.AssertNil(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+				}()
+
+				err := sh("trap '' TERM; touch " + ready + "; while true; do sleep 0.1; done")
+				h.AssertEq(t, err.(*launch.ExitError).Code, 128+int(syscall.SIGKILL))
+				h.AssertStringContains(t, h.AllLogs(logHandler), "Process did not exit within 100ms, killing it")
+			})
+		})
+
+		it("reaps orphaned processes", func() {
+			pidFile := filepath.Join(tmpDir, "orphan.pid")
+			h.AssertNil(t, sh("(sleep 0.2 & echo $! > "+pidFile+"); sleep 0.5"))
+
+			contents, err := ioutil.ReadFile(pidFile)
+			h.AssertNil(t, err)
+			pid := strings.TrimSpace(string(contents))
+			if _, err := os.Stat(filepath.Join("/proc", pid)); err == nil {
+				status, err := ioutil.ReadFile(filepath.Join("/proc", pid, "status"))
+				h.AssertNil(t, err)
+				h.AssertStringDoesNotContain(t, string(status), "zombie")
+			}
+		})
+	})
+}
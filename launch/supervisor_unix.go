@@ -0,0 +1,133 @@
+//+build linux darwin
+
+package launch
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// reapInterval bounds how long a zombie can go unreaped if its SIGCHLD was coalesced with another
+const reapInterval = time.Second
+
+var forwardedSignals = []os.Signal{
+	syscall.SIGTERM,
+	syscall.SIGINT,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+func (s *Supervisor) notify() chan os.Signal {
+	if err := setChildSubreaper(); err != nil {
+		s.Logger.Warnf("Unable to become a subreaper, orphaned processes will not be reaped: %s", err)
+	}
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals, append(forwardedSignals, syscall.SIGCHLD)...)
+	return signals
+}
+
+func (s *Supervisor) stopNotify(signals chan os.Signal) {
+	signal.Stop(signals)
+}
+
+// run starts the child and supervises it until it exits, returning its exit code
+// and whether it exited because it was asked to stop
+func (s *Supervisor) run(argv0 string, argv []string, envv []string, signals chan os.Signal) (int, bool, error) {
+	cmd := &exec.Cmd{
+		Path:   argv0,
+		Args:   argv,
+		Env:    envv,
+		Stdin:  s.Stdin,
+		Stdout: s.Stdout,
+		Stderr: s.Stderr,
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, false, errors.Wrap(err, "start process")
+	}
+	pid := cmd.Process.Pid
+
+	reapTicker := time.NewTicker(reapInterval)
+	defer reapTicker.Stop()
+	var (
+		stopped   bool
+		killTimer <-chan time.Time
+	)
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGCHLD {
+				break
+			}
+			if err := cmd.Process.Signal(sig); err != nil {
+				s.Logger.Warnf("Unable to forward signal '%s' to process: %s", sig, err)
+			}
+			if (sig == syscall.SIGTERM || sig == syscall.SIGINT) && !stopped {
+				stopped = true
+				killTimer = time.After(s.GracePeriod)
+			}
+		case <-reapTicker.C:
+		case <-killTimer:
+			s.Logger.Warnf("Process did not exit within %s, killing it", s.GracePeriod)
+			if err := cmd.Process.Kill(); err != nil {
+				s.Logger.Warnf("Unable to kill process: %s", err)
+			}
+			killTimer = nil
+		}
+		if status, ok := reap(pid); ok {
+			return exitCode(status), stopped, nil
+		}
+	}
+}
+
+// wait waits for d while reaping orphans, it returns true if a stop signal was received
+func (s *Supervisor) wait(d time.Duration, signals chan os.Signal) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGTERM || sig == syscall.SIGINT {
+				return true
+			}
+			reap(0)
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// reap collects the exit status of every exited descendant,
+// it returns the wait status of the child with the given pid and true if that child exited
+func reap(pid int) (syscall.WaitStatus, bool) {
+	var (
+		childStatus syscall.WaitStatus
+		childExited bool
+	)
+	for {
+		var status syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || wpid <= 0 {
+			return childStatus, childExited
+		}
+		if wpid == pid && (status.Exited() || status.Signaled()) {
+			childStatus, childExited = status, true
+		}
+	}
+}
+
+func exitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,40 @@
+package launch
+
+import (
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (s *Supervisor) notify() chan os.Signal {
+	return make(chan os.Signal)
+}
+
+func (s *Supervisor) stopNotify(signals chan os.Signal) {}
+
+// run starts the child and waits for it to exit, returning its exit code.
+// Windows has no zombies to reap and no signals to forward.
+func (s *Supervisor) run(argv0 string, argv []string, envv []string, _ chan os.Signal) (int, bool, error) {
+	cmd := &exec.Cmd{
+		Path:   argv0,
+		Args:   argv,
+		Env:    envv,
+		Stdin:  s.Stdin,
+		Stdout: s.Stdout,
+		Stderr: s.Stderr,
+	}
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), false, nil
+		}
+		return 0, false, errors.Wrap(err, "run process")
+	}
+	return 0, false, nil
+}
+
+func (s *Supervisor) wait(d time.Duration, _ chan os.Signal) bool {
+	time.Sleep(d)
+	return false
+}
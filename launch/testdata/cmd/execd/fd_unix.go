@@ -2,8 +2,18 @@
 
 package main
 
-import "os"
+import (
+	"os"
+	"os/exec"
+)
 
 func outputFile() (*os.File, error) {
 	return os.NewFile(3, "outputFile"), nil
 }
+
+// startChild starts a process that inherits the output file and outlives the binary
+func startChild(f *os.File, seconds string) error {
+	cmd := exec.Command("/bin/sleep", seconds)
+	cmd.ExtraFiles = []*os.File{f}
+	return cmd.Start()
+}
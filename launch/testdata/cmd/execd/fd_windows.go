@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"strconv"
 )
@@ -15,3 +16,7 @@ func outputFile() (*os.File, error) {
 
 	return os.NewFile(uintptr(handle), "outputFile"), nil
 }
+
+func startChild(_ *os.File, _ string) error {
+	return errors.New("child processes are not supported on windows")
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -34,5 +37,26 @@ func main() {
 		fmt.Println("ERROR: failed to write to output file:", err)
 		os.Exit(1)
 	}
+	if size, err := strconv.Atoi(os.Getenv("EXTRA_OUTPUT_SIZE")); err == nil {
+		if _, err := f.WriteString("# " + strings.Repeat("x", size) + "\n"); err != nil {
+			fmt.Println("ERROR: failed to write to output file:", err)
+			os.Exit(1)
+		}
+	}
+	if os.Getenv("INVALID_NAME") != "" {
+		if _, err := f.WriteString("\"INVALID=NAME\" = \"SOME_VAL\"\n"); err != nil {
+			fmt.Println("ERROR: failed to write to output file:", err)
+			os.Exit(1)
+		}
+	}
+	if d := os.Getenv("CHILD_SLEEP"); d != "" {
+		if err := startChild(f, d); err != nil {
+			fmt.Println("ERROR: failed to start child:", err)
+			os.Exit(1)
+		}
+	}
+	if d, err := time.ParseDuration(os.Getenv("SLEEP")); err == nil {
+		time.Sleep(d)
+	}
 	os.Exit(0)
 }
@@ -0,0 +1,154 @@
+package layers_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/layers"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestCompression(t *testing.T) {
+	spec.Run(t, "Compression", testCompression, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testCompression(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir string
+		layer  []byte
+		diffID string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "layers.compression")
+		h.AssertNil(t, err)
+
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "some-file", Mode: 0644, Size: 9, Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte("some-data"))
+		h.AssertNil(t, err)
+		h.AssertNil(t, tw.Close())
+		layer = buf.Bytes()
+		diffID = fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	gzipped := func() []byte {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		_, err := gw.Write(layer)
+		h.AssertNil(t, err)
+		h.AssertNil(t, gw.Close())
+		return buf.Bytes()
+	}
+
+	zstded := func() []byte {
+		buf := &bytes.Buffer{}
+		zw, err := zstd.NewWriter(buf)
+		h.AssertNil(t, err)
+		_, err = zw.Write(layer)
+		h.AssertNil(t, err)
+		h.AssertNil(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	assertExtracted := func() {
+		t.Helper()
+		contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "some-file"))
+		h.AssertNil(t, err)
+		h.AssertEq(t, string(contents), "some-data")
+	}
+
+	when("#Decompress", func() {
+		it("decompresses gzip compressed layers", func() {
+			rc, err := layers.Decompress(bytes.NewReader(gzipped()))
+			h.AssertNil(t, err)
+			defer rc.Close()
+
+			got, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, got, layer)
+		})
+
+		it("decompresses zstd compressed layers", func() {
+			rc, err := layers.Decompress(bytes.NewReader(zstded()))
+			h.AssertNil(t, err)
+			defer rc.Close()
+
+			got, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, got, layer)
+		})
+
+		it("passes through uncompressed layers", func() {
+			rc, err := layers.Decompress(bytes.NewReader(layer))
+			h.AssertNil(t, err)
+			defer rc.Close()
+
+			got, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, got, layer)
+		})
+
+		it("reads empty layers", func() {
+			rc, err := layers.Decompress(bytes.NewReader(nil))
+			h.AssertNil(t, err)
+			defer rc.Close()
+
+			got, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(got), 0)
+		})
+	})
+
+	when("#Extract", func() {
+		it("extracts gzip compressed layers", func() {
+			h.AssertNil(t, layers.Extract(bytes.NewReader(gzipped()), tmpDir))
+			assertExtracted()
+		})
+
+		it("extracts zstd compressed layers", func() {
+			h.AssertNil(t, layers.Extract(bytes.NewReader(zstded()), tmpDir))
+			assertExtracted()
+		})
+	})
+
+	when("#ExtractVerified", func() {
+		it("verifies compressed layers against their uncompressed diffID", func() {
+			h.AssertNil(t, layers.ExtractVerified(bytes.NewReader(gzipped()), tmpDir, "", diffID))
+			assertExtracted()
+
+			h.AssertNil(t, layers.ExtractVerified(bytes.NewReader(zstded()), tmpDir, "", diffID))
+			assertExtracted()
+		})
+
+		it("returns a digest mismatch error when a compressed layer is corrupt", func() {
+			corrupt := gzipped()
+			corrupt = corrupt[:len(corrupt)/2]
+
+			err := layers.ExtractVerified(bytes.NewReader(corrupt), tmpDir, "", diffID)
+
+			var mismatch *layers.DigestMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("expected digest mismatch error, got: %v", err)
+			}
+		})
+	})
+}
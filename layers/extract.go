@@ -9,14 +9,28 @@ import (
 )
 
 // Extract extracts entries from r to the dest directory
-// Contents of r should be an OCI layer.
+// Contents of r should be an OCI layer, which may be gzip or zstd compressed.
 // If dest is an empty string files with be extracted to `/` or `c:\` on unix and windows filesystems respectively
 func Extract(r io.Reader, dest string) error {
-	tr := tarReader(r, dest)
-	return archive.Extract(tr)
+	rc, err := Decompress(r)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return extract(rc, dest, "")
+}
+
+// extract extracts entries from r to the dest directory, refusing entries outside of root.
+// If root is an empty string entries are confined to dest.
+func extract(r io.Reader, dest, root string) error {
+	tr, dest := tarReader(r, dest)
+	if root == "" {
+		root = dest
+	}
+	return archive.Extract(tr, root)
 }
 
-func tarReader(r io.Reader, dest string) archive.TarReader {
+func tarReader(r io.Reader, dest string) (archive.TarReader, string) {
 	tr := archive.NewNormalizingTarReader(tar.NewReader(r))
 	if runtime.GOOS == "windows" {
 		tr.ExcludePaths([]string{"Hives"})
@@ -29,5 +43,5 @@ func tarReader(r io.Reader, dest string) archive.TarReader {
 		dest = `/`
 	}
 	tr.PrependDir(dest)
-	return tr
+	return tr, dest
 }
@@ -0,0 +1,210 @@
+package layers
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/archive"
+)
+
+const appIndexFile = "app-index.json"
+
+// SliceIndex records the files in an app layer, so that the layer can be reused by a later build
+// when none of its files have changed, without writing it again
+type SliceIndex struct {
+	Digest string      `json:"digest"`
+	Files  []FileIndex `json:"files,omitempty"`
+}
+
+// FileIndex records a file as it is written to an app layer
+type FileIndex struct {
+	Path    string            `json:"path"`
+	Type    byte              `json:"type"`
+	Mode    int64             `json:"mode"`
+	UID     int               `json:"uid"`
+	GID     int               `json:"gid"`
+	Size    int64             `json:"size,omitempty"`
+	ModTime int64             `json:"mtime,omitempty"` // unix nanoseconds, not written to the layer
+	Link    string            `json:"link,omitempty"`
+	SHA     string            `json:"sha,omitempty"` // regular files only
+	PAX     map[string]string `json:"pax,omitempty"`
+}
+
+// AppIndexLayer creates a Layer containing the index of the app layers, so that the index can be cached
+// as a layer instead of growing the cache metadata with the size of the app
+func (f *Factory) AppIndexLayer(index []SliceIndex) (Layer, error) {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return Layer{}, errors.Wrap(err, "encoding app index")
+	}
+	return f.writeLayer("app-index", func(tw *archive.NormalizingTarWriter) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     appIndexFile,
+			Size:     int64(len(data)),
+			Mode:     0644,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	})
+}
+
+// ReadAppIndex reads the index of the app layers from the contents of a layer created by AppIndexLayer
+func ReadAppIndex(r io.Reader) ([]SliceIndex, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("layer does not contain an app index")
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading app index layer")
+		}
+		if path.Base(hdr.Name) != appIndexFile {
+			continue
+		}
+		var index []SliceIndex
+		if err := json.NewDecoder(tr).Decode(&index); err != nil {
+			return nil, errors.Wrap(err, "decoding app index")
+		}
+		return index, nil
+	}
+}
+
+// previousIndex is the index of the app layers of a previous build
+type previousIndex struct {
+	slices []SliceIndex
+	files  map[string]FileIndex
+}
+
+func newPreviousIndex(slices []SliceIndex) *previousIndex {
+	idx := &previousIndex{slices: slices, files: map[string]FileIndex{}}
+	for _, slice := range slices {
+		for _, file := range slice.Files {
+			idx.files[file.Path] = file
+		}
+	}
+	return idx
+}
+
+// hash returns the recorded SHA of a file that has the same size, mode and modification time as it did previously.
+// Modification times are not trusted when they are normalized, as platforms may normalize the times of app files.
+func (idx *previousIndex) hash(file FileIndex) (string, bool) {
+	prev, ok := idx.files[file.Path]
+	if !ok || prev.SHA == "" || file.ModTime == 0 || file.ModTime == archive.NormalizedModTime.UnixNano() {
+		return "", false
+	}
+	if prev.Size != file.Size || prev.Mode != file.Mode || prev.ModTime != file.ModTime {
+		return "", false
+	}
+	return prev.SHA, true
+}
+
+// find returns the digest of a previous layer with the same files
+func (idx *previousIndex) find(files []FileIndex) (string, bool) {
+	for _, slice := range idx.slices {
+		if sameFiles(slice.Files, files) {
+			return slice.Digest, true
+		}
+	}
+	return "", false
+}
+
+func sameFiles(a, b []FileIndex) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		x.ModTime, y.ModTime = 0, 0
+		if len(x.PAX) == 0 {
+			x.PAX = nil
+		}
+		if len(y.PAX) == 0 {
+			y.PAX = nil
+		}
+		if !reflect.DeepEqual(x, y) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexFiles returns the index of the entries createLayerFromFiles writes for files, which must be sorted
+func (f *Factory) indexFiles(sdir *sliceableDir, files []archive.PathInfo, prev *previousIndex) ([]FileIndex, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	var index []FileIndex
+	for _, parent := range sdir.parentDirs {
+		entry, err := indexFile(parent, prev)
+		if err != nil {
+			return nil, err
+		}
+		index = append(index, entry)
+	}
+	for _, file := range files {
+		if file.Info.Mode()&os.ModeSocket != 0 {
+			continue
+		}
+		entry, err := indexFile(file, prev)
+		if err != nil {
+			return nil, err
+		}
+		entry.UID, entry.GID = f.UID, f.GID
+		index = append(index, entry)
+	}
+	return index, nil
+}
+
+func indexFile(file archive.PathInfo, prev *previousIndex) (FileIndex, error) {
+	hdr, err := archive.FileHeader(file.Path, file.Info)
+	if err != nil {
+		return FileIndex{}, err
+	}
+	entry := FileIndex{
+		Path:    hdr.Name,
+		Type:    hdr.Typeflag,
+		Mode:    hdr.Mode,
+		UID:     hdr.Uid,
+		GID:     hdr.Gid,
+		Size:    hdr.Size,
+		ModTime: file.Info.ModTime().UnixNano(),
+		Link:    hdr.Linkname,
+		PAX:     hdr.PAXRecords,
+	}
+	if !file.Info.Mode().IsRegular() {
+		return entry, nil
+	}
+	if sha, ok := prev.hash(entry); ok {
+		entry.SHA = sha
+		return entry, nil
+	}
+	if entry.SHA, err = hashFile(file.Path); err != nil {
+		return FileIndex{}, err
+	}
+	return entry, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", hasher.Sum(nil)), nil
+}
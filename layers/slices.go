@@ -23,45 +23,78 @@ type Slice struct {
 // * The final layer will contain any files in dir that were not included in a previous layer
 // Some layers may be empty
 func (f *Factory) SliceLayers(dir string, slices []Slice) ([]Layer, error) {
-	var sliceLayers []Layer
+	sliceLayers, _, err := f.SliceLayersWithIndex(dir, slices, nil)
+	return sliceLayers, err
+}
+
+// SliceLayersWithIndex divides dir into layers like SliceLayers and returns the index of each layer.
+// A layer with the same files as a layer in previous is not written, it is returned with the previous digest and no TarPath.
+func (f *Factory) SliceLayersWithIndex(dir string, slices []Slice, previous []SliceIndex) ([]Layer, []SliceIndex, error) {
+	var (
+		sliceLayers []Layer
+		index       []SliceIndex
+	)
 	dir, err := filepath.Abs(dir)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	sdir, err := newSlicableDir(dir)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	prev := newPreviousIndex(previous)
 
 	//add one layer per slice
 	for i, slice := range slices {
 		layerID := fmt.Sprintf("slice-%d", i+1)
-		layer, err := f.createLayerFromSlice(slice, sdir, layerID)
+		files, err := sliceMatches(slice, sdir)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		layer, sliceIndex, err := f.createIndexedLayer(layerID, sdir, files, prev)
+		if err != nil {
+			return nil, nil, err
 		}
 		sliceLayers = append(sliceLayers, layer)
+		index = append(index, sliceIndex)
 	}
 
 	//add remaining files in a single layer
 	layerID := fmt.Sprintf("slice-%d", len(slices)+1)
-	finalLayer, err := f.createLayerFromFiles(layerID, sdir, sdir.remainingFiles())
+	finalLayer, finalIndex, err := f.createIndexedLayer(layerID, sdir, sdir.remainingFiles(), prev)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return append(sliceLayers, finalLayer), nil
+	return append(sliceLayers, finalLayer), append(index, finalIndex), nil
 }
 
-func (f *Factory) createLayerFromSlice(slice Slice, sdir *sliceableDir, layerID string) (Layer, error) {
+func sliceMatches(slice Slice, sdir *sliceableDir) ([]archive.PathInfo, error) {
 	var matches []string
 	for _, path := range slice.Paths {
 		globMatches, err := glob(sdir, path)
 		if err != nil {
-			return Layer{}, err
+			return nil, err
 		}
 		matches = append(matches, globMatches...)
 	}
-	return f.createLayerFromFiles(layerID, sdir, sdir.sliceFiles(matches))
+	return sdir.sliceFiles(matches), nil
+}
+
+func (f *Factory) createIndexedLayer(layerID string, sdir *sliceableDir, files []archive.PathInfo, prev *previousIndex) (Layer, SliceIndex, error) {
+	sortFiles(files)
+	fileIndex, err := f.indexFiles(sdir, files, prev)
+	if err != nil {
+		return Layer{}, SliceIndex{}, err
+	}
+	if digest, ok := prev.find(fileIndex); ok {
+		f.Logger.Debugf("Files in layer %q are unchanged, reusing SHA: %s\n", layerID, digest)
+		return Layer{ID: layerID, Digest: digest}, SliceIndex{Digest: digest, Files: fileIndex}, nil
+	}
+	layer, err := f.createLayerFromFiles(layerID, sdir, files)
+	if err != nil {
+		return Layer{}, SliceIndex{}, err
+	}
+	return layer, SliceIndex{Digest: layer.Digest, Files: fileIndex}, nil
 }
 
 func glob(sdir *sliceableDir, pattern string) ([]string, error) {
@@ -92,10 +125,14 @@ func glob(sdir *sliceableDir, pattern string) ([]string, error) {
 	return matches, nil
 }
 
-func (f *Factory) createLayerFromFiles(layerID string, sdir *sliceableDir, files []archive.PathInfo) (layer Layer, err error) {
+func sortFiles(files []archive.PathInfo) {
 	sort.SliceStable(files, func(i, j int) bool {
 		return files[i].Path < files[j].Path
 	})
+}
+
+func (f *Factory) createLayerFromFiles(layerID string, sdir *sliceableDir, files []archive.PathInfo) (layer Layer, err error) {
+	sortFiles(files)
 	return f.writeLayer(layerID, func(tw *archive.NormalizingTarWriter) error {
 		if len(files) != 0 {
 			if err := archive.AddFilesToArchive(tw, sdir.parentDirs); err != nil {
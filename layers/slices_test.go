@@ -2,15 +2,20 @@ package layers_test
 
 import (
 	"archive/tar"
+	"crypto/sha256"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
 
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
+	"github.com/buildpacks/lifecycle/archive"
 	"github.com/buildpacks/lifecycle/layers"
 	h "github.com/buildpacks/lifecycle/testhelpers"
 )
@@ -392,4 +397,104 @@ func testSlices(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 	})
+
+	when("#SliceLayersWithIndex", func() {
+		var appDir string
+
+		it.Before(func() {
+			var err error
+			appDir, err = ioutil.TempDir("", "layers.slices.app")
+			h.AssertNil(t, err)
+			h.Mkdir(t, filepath.Join(appDir, "static"))
+			h.Mkfile(t, "some-content", filepath.Join(appDir, "static", "some-file.txt"))
+			h.Mkfile(t, "other-content", filepath.Join(appDir, "other-file.txt"))
+			factory.Logger = &log.Logger{Handler: memory.New()}
+		})
+
+		it.After(func() {
+			os.RemoveAll(appDir)
+		})
+
+		slices := []layers.Slice{{Paths: []string{"static"}}}
+
+		it("returns the index of each layer", func() {
+			sliceLayers, index, err := factory.SliceLayersWithIndex(appDir, slices, nil)
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(index), 2)
+			h.AssertEq(t, index[0].Digest, sliceLayers[0].Digest)
+			h.AssertEq(t, index[1].Digest, sliceLayers[1].Digest)
+
+			var found bool
+			for _, file := range index[0].Files {
+				if file.Path == filepath.Join(appDir, "static", "some-file.txt") {
+					found = true
+					h.AssertEq(t, file.Size, int64(len("some-content")))
+					h.AssertEq(t, file.UID, factory.UID)
+					h.AssertEq(t, file.GID, factory.GID)
+					h.AssertEq(t, file.SHA, "sha256:"+sha256Hex("some-content"))
+				}
+			}
+			h.AssertEq(t, found, true)
+		})
+
+		it("does not write layers whose files are unchanged", func() {
+			_, index, err := factory.SliceLayersWithIndex(appDir, slices, nil)
+			h.AssertNil(t, err)
+			h.Mkfile(t, "changed-content", filepath.Join(appDir, "other-file.txt"))
+
+			h.AssertNil(t, os.RemoveAll(factory.ArtifactsDir))
+			factory.ArtifactsDir, err = ioutil.TempDir("", "layers.slices.layer")
+			h.AssertNil(t, err)
+			sliceLayers, newIndex, err := factory.SliceLayersWithIndex(appDir, slices, index)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, sliceLayers[0].TarPath, "")
+			h.AssertEq(t, sliceLayers[0].Digest, index[0].Digest)
+			h.AssertEq(t, newIndex[0].Digest, index[0].Digest)
+
+			if sliceLayers[1].TarPath == "" {
+				t.Fatalf("Expected the layer with a changed file to be written")
+			}
+			if sliceLayers[1].Digest == index[1].Digest {
+				t.Fatalf("Expected the layer with a changed file to have a new digest")
+			}
+		})
+
+		it("rehashes files when their modification time is normalized", func() {
+			someFile := filepath.Join(appDir, "static", "some-file.txt")
+			h.AssertNil(t, os.Chtimes(someFile, archive.NormalizedModTime, archive.NormalizedModTime))
+			_, index, err := factory.SliceLayersWithIndex(appDir, slices, nil)
+			h.AssertNil(t, err)
+
+			h.Mkfile(t, "same-length!", someFile)
+			h.AssertNil(t, os.Chtimes(someFile, archive.NormalizedModTime, archive.NormalizedModTime))
+			h.AssertNil(t, os.RemoveAll(factory.ArtifactsDir))
+			factory.ArtifactsDir, err = ioutil.TempDir("", "layers.slices.layer")
+			h.AssertNil(t, err)
+			sliceLayers, _, err := factory.SliceLayersWithIndex(appDir, slices, index)
+			h.AssertNil(t, err)
+
+			if sliceLayers[0].TarPath == "" {
+				t.Fatalf("Expected the layer with a changed file to be written")
+			}
+		})
+
+		it("writes the index to a layer that can be read back", func() {
+			_, index, err := factory.SliceLayersWithIndex(appDir, slices, nil)
+			h.AssertNil(t, err)
+
+			indexLayer, err := factory.AppIndexLayer(index)
+			h.AssertNil(t, err)
+			f, err := os.Open(indexLayer.TarPath)
+			h.AssertNil(t, err)
+			defer f.Close()
+			readIndex, err := layers.ReadAppIndex(f)
+			h.AssertNil(t, err)
+			h.AssertEq(t, readIndex, index)
+		})
+	})
+}
+
+func sha256Hex(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
 }
@@ -0,0 +1,86 @@
+package layers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DigestMismatchError is returned when the contents of a layer do not match its diffID
+type DigestMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("layer digest '%s' does not match '%s'", e.Actual, e.Expected)
+}
+
+// VerifyDigest reads r to the end and checks that its uncompressed digest is diffID
+func VerifyDigest(r io.Reader, diffID string) error {
+	hasher, err := newDiffIDHasher(diffID)
+	if err != nil {
+		return err
+	}
+	rc, err := Decompress(r)
+	if err != nil {
+		return unreadable(hasher, diffID, err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(hasher, rc); err != nil {
+		return errors.Wrap(err, "reading layer")
+	}
+	return checkDigest(hasher, diffID)
+}
+
+// ExtractVerified extracts r to the dest directory like Extract while checking that its uncompressed digest is diffID.
+// Entries outside of root are refused, if root is an empty string entries are confined to dest.
+// A *DigestMismatchError is returned when it is not, any files that were extracted should not be used.
+func ExtractVerified(r io.Reader, dest, root, diffID string) error {
+	hasher, err := newDiffIDHasher(diffID)
+	if err != nil {
+		return err
+	}
+	rc, err := Decompress(r)
+	if err != nil {
+		return unreadable(hasher, diffID, err)
+	}
+	defer rc.Close()
+	tr := io.TeeReader(rc, hasher)
+	extractErr := extract(tr, dest, root)
+	// the tar reader stops at the end of archive marker, any padding that follows is part of the digest
+	if _, err := io.Copy(ioutil.Discard, tr); err != nil && extractErr == nil {
+		extractErr = errors.Wrap(err, "reading layer")
+	}
+	if err := checkDigest(hasher, diffID); err != nil {
+		return err
+	}
+	return extractErr
+}
+
+// unreadable treats a layer that could not be decompressed as corrupt, unless diffID is the digest of no data
+func unreadable(hasher hash.Hash, diffID string, err error) error {
+	if mismatch := checkDigest(hasher, diffID); mismatch != nil {
+		return mismatch
+	}
+	return err
+}
+
+func newDiffIDHasher(diffID string) (hash.Hash, error) {
+	if !strings.HasPrefix(diffID, "sha256:") {
+		return nil, errors.Errorf("unsupported digest '%s'", diffID)
+	}
+	return sha256.New(), nil
+}
+
+func checkDigest(hasher hash.Hash, diffID string) error {
+	if actual := fmt.Sprintf("sha256:%x", hasher.Sum(nil)); actual != diffID {
+		return &DigestMismatchError{Expected: diffID, Actual: actual}
+	}
+	return nil
+}
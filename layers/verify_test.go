@@ -0,0 +1,109 @@
+package layers_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/layers"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestVerify(t *testing.T) {
+	spec.Run(t, "Verify", testVerify, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testVerify(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir string
+		layer  []byte
+		diffID string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "layers.verify")
+		h.AssertNil(t, err)
+
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "some-file", Mode: 0644, Size: 9, Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte("some-data"))
+		h.AssertNil(t, err)
+		h.AssertNil(t, tw.Close())
+		buf.Write(make([]byte, 1024)) // padding after the end of archive marker
+		layer = buf.Bytes()
+		diffID = fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	when("#ExtractVerified", func() {
+		it("extracts a layer that matches its diffID", func() {
+			h.AssertNil(t, layers.ExtractVerified(bytes.NewReader(layer), tmpDir, "", diffID))
+
+			contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "some-file"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "some-data")
+		})
+
+		it("returns a digest mismatch error when the layer does not match its diffID", func() {
+			corrupt := append([]byte{}, layer...)
+			corrupt[len(corrupt)-1] = 1
+
+			err := layers.ExtractVerified(bytes.NewReader(corrupt), tmpDir, "", diffID)
+
+			var mismatch *layers.DigestMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("expected digest mismatch error, got: %v", err)
+			}
+			h.AssertEq(t, mismatch.Expected, diffID)
+		})
+
+		it("refuses entries outside of root", func() {
+			err := layers.ExtractVerified(bytes.NewReader(layer), tmpDir, filepath.Join(tmpDir, "some-layer"), diffID)
+
+			h.AssertError(t, err, "refusing to extract")
+			h.AssertPathDoesNotExist(t, filepath.Join(tmpDir, "some-file"))
+		})
+
+		it("returns a digest mismatch error when the layer is not a valid tar", func() {
+			err := layers.ExtractVerified(bytes.NewReader([]byte("garbage")), tmpDir, "", diffID)
+
+			var mismatch *layers.DigestMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("expected digest mismatch error, got: %v", err)
+			}
+		})
+	})
+
+	when("#VerifyDigest", func() {
+		it("succeeds when the layer matches its diffID", func() {
+			h.AssertNil(t, layers.VerifyDigest(bytes.NewReader(layer), diffID))
+		})
+
+		it("returns a digest mismatch error when the layer does not match its diffID", func() {
+			err := layers.VerifyDigest(bytes.NewReader(layer[1:]), diffID)
+
+			var mismatch *layers.DigestMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("expected digest mismatch error, got: %v", err)
+			}
+		})
+
+		it("fails for unsupported digests", func() {
+			h.AssertError(t, layers.VerifyDigest(bytes.NewReader(layer), "md5:abc"), "unsupported digest 'md5:abc'")
+		})
+	})
+}
@@ -2,6 +2,7 @@ package platform
 
 type CacheMetadata struct {
 	Buildpacks []BuildpackLayersMetadata `json:"buildpacks"`
+	AppIndex   string                    `json:"app-index,omitempty"` // AppIndex is the digest of the cache layer indexing the app layers of the last export
 }
 
 func (cm *CacheMetadata) MetadataForBuildpack(id string) BuildpackLayersMetadata {
@@ -3,6 +3,8 @@
 package platform
 
 import (
+	"fmt"
+
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
 
@@ -17,6 +19,14 @@ import (
 type AnalyzedMetadata struct {
 	Image    *ImageIdentifier `toml:"image"`
 	Metadata LayersMetadata   `toml:"metadata"`
+	RunImage *RunImage        `toml:"run-image,omitempty"`
+}
+
+// RunImage records the run image selected during analysis and the reason it was selected
+type RunImage struct {
+	Reference string `toml:"reference"`
+	Digest    string `toml:"digest,omitempty"`
+	Reason    string `toml:"reason,omitempty"`
 }
 
 // FIXME: fix key names to be accurate in the daemon case
@@ -76,6 +86,33 @@ type BuildpackLayerMetadata struct {
 type RunImageMetadata struct {
 	TopLayer  string `json:"topLayer" toml:"top-layer"`
 	Reference string `json:"reference" toml:"reference"`
+	Digest    string `json:"digest,omitempty" toml:"digest,omitempty"`
+}
+
+// analysis explanation, written by the analyzer in dry-run mode
+
+// LayerDecision is what analyzing and restoring would do with a buildpack layer
+type LayerDecision string
+
+const (
+	LayerRestoredFromImage   LayerDecision = "restored-from-image"   // metadata is restored from the previous image, data is reused at export
+	LayerRestorableFromCache LayerDecision = "restorable-from-cache" // metadata is restored and data can be restored from the cache
+	LayerRemoved             LayerDecision = "removed"               // metadata is restored but the restorer removes the layer
+	LayerSHAMismatch         LayerDecision = "sha-mismatch"          // metadata is restored but the restorer removes the layer, its cached data is for another sha
+	LayerSkipped             LayerDecision = "skipped"               // metadata is not restored
+)
+
+type AnalysisExplanation struct {
+	Layers []LayerExplanation `json:"layers"`
+}
+
+type LayerExplanation struct {
+	Buildpack string        `json:"buildpack"`
+	Layer     string        `json:"layer"`
+	Decision  LayerDecision `json:"decision"`
+	Reason    string        `json:"reason"`
+	ImageSHA  string        `json:"imageSHA,omitempty"`
+	CacheSHA  string        `json:"cacheSHA,omitempty"`
 }
 
 // metadata.toml
@@ -187,8 +224,51 @@ type ProjectSource struct {
 // report.toml
 
 type ExportReport struct {
-	Build BuildReport `toml:"build,omitempty"`
-	Image ImageReport `toml:"image"`
+	Build      BuildReport         `toml:"build,omitempty"`
+	Cache      *CacheReport        `toml:"cache,omitempty"`
+	Image      ImageReport         `toml:"image"`
+	Validation []ValidationFinding `toml:"validation,omitempty"`
+}
+
+// CacheReport records how effective caching was for the buildpack layers of a build, in total and per buildpack
+type CacheReport struct {
+	CacheMetrics
+	Buildpacks []BuildpackCacheReport `toml:"buildpacks,omitempty"`
+}
+
+type BuildpackCacheReport struct {
+	ID string `toml:"id"`
+	CacheMetrics
+	Types map[string]CacheMetrics `toml:"types,omitempty"` // keyed by layer type: launch, build or cache
+}
+
+type CacheMetrics struct {
+	Hits             int   `toml:"hits"`               // cache=true layers restored from the cache
+	Misses           int   `toml:"misses"`             // cache=true layers removed because they were not in the cache, had the wrong sha or were corrupt
+	HitBytes         int64 `toml:"hit-bytes"`          // bytes read from the cache while restoring
+	ImageReused      int   `toml:"image-reused"`       // layers reused from the previous image or cache image at export
+	ImageAdded       int   `toml:"image-added"`        // layers added to the image at export
+	ImageReusedBytes int64 `toml:"image-reused-bytes"` // size of reused layers, unknown for layers without local contents
+	ImageAddedBytes  int64 `toml:"image-added-bytes"`
+	CacheReused      int   `toml:"cache-reused"` // layers reused from the previous cache at export
+	CacheAdded       int   `toml:"cache-added"`  // layers added to the cache at export
+	CacheReusedBytes int64 `toml:"cache-reused-bytes"`
+	CacheAddedBytes  int64 `toml:"cache-added-bytes"`
+}
+
+// Add adds the counts and byte totals of other to m
+func (m *CacheMetrics) Add(other CacheMetrics) {
+	m.Hits += other.Hits
+	m.Misses += other.Misses
+	m.HitBytes += other.HitBytes
+	m.ImageReused += other.ImageReused
+	m.ImageAdded += other.ImageAdded
+	m.ImageReusedBytes += other.ImageReusedBytes
+	m.ImageAddedBytes += other.ImageAddedBytes
+	m.CacheReused += other.CacheReused
+	m.CacheAdded += other.CacheAdded
+	m.CacheReusedBytes += other.CacheReusedBytes
+	m.CacheAddedBytes += other.CacheAddedBytes
 }
 
 type BuildReport struct {
@@ -196,10 +276,34 @@ type BuildReport struct {
 }
 
 type ImageReport struct {
-	Tags         []string `toml:"tags"`
-	ImageID      string   `toml:"image-id,omitempty"`
-	Digest       string   `toml:"digest,omitempty"`
-	ManifestSize int64    `toml:"manifest-size,omitzero"`
+	Tags           []string `toml:"tags"`
+	ImageID        string   `toml:"image-id,omitempty"`
+	Digest         string   `toml:"digest,omitempty"`
+	ManifestSize   int64    `toml:"manifest-size,omitzero"`
+	RunImageDigest string   `toml:"run-image-digest,omitempty"`
+	// Registries is populated when the image was written to more than one registry
+	Registries []RegistryReport `toml:"registries,omitempty"`
+}
+
+type RegistryReport struct {
+	Registry string   `toml:"registry"`
+	Tags     []string `toml:"tags"`
+	Digest   string   `toml:"digest,omitempty"`
+}
+
+const (
+	ValidationMissingCommand   = "missing-command"   // a direct process command is not in the launch PATH
+	ValidationUnknownBuildpack = "unknown-buildpack" // a process references a buildpack that is not in the group
+	ValidationEnvConflict      = "env-conflict"      // more than one buildpack sets a launch environment variable
+)
+
+// ValidationFinding is a problem found with the processes or launch environment of the exported image
+type ValidationFinding struct {
+	Type        string   `toml:"type"`
+	ProcessType string   `toml:"process-type,omitempty"`
+	Name        string   `toml:"name,omitempty"` // the command or environment variable the finding is about
+	Buildpacks  []string `toml:"buildpacks,omitempty"`
+	Message     string   `toml:"message"`
 }
 
 // stack.toml
@@ -226,6 +330,75 @@ func (sm *StackMetadata) BestRunImageMirror(registry string) (string, error) {
 	return runImageRef, nil
 }
 
+type RunImageCandidate struct {
+	Reference    string
+	Preferred    bool   // Preferred is true when the platform asked for this image
+	SameRegistry bool   // SameRegistry is true when the image is on the registry of the app image
+	Reason       string // Reason describes why the candidate was ranked where it was
+}
+
+// RunImageCandidates returns the run image and all of its mirrors ordered by preference:
+// images matching an entry in preferred (either a full image reference or a registry) come first, in the order
+// given by preferred, followed by images on the given registry, followed by the remaining images in stack order.
+// Images that cannot be parsed are skipped.
+func (sm *StackMetadata) RunImageCandidates(registry string, preferred []string) ([]RunImageCandidate, error) {
+	if sm.RunImage.Image == "" {
+		return nil, errors.New("missing run-image metadata")
+	}
+	images := append([]string{sm.RunImage.Image}, sm.RunImage.Mirrors...)
+
+	var candidates []RunImageCandidate
+	added := map[string]bool{}
+	add := func(ref name.Reference, img string, isPreferred bool, reason string) {
+		if added[img] {
+			return
+		}
+		added[img] = true
+		candidates = append(candidates, RunImageCandidate{
+			Reference:    img,
+			Preferred:    isPreferred,
+			SameRegistry: registry == ref.Context().RegistryStr(),
+			Reason:       reason,
+		})
+	}
+
+	for _, pref := range preferred {
+		for _, img := range images {
+			ref, err := name.ParseReference(img, name.WeakValidation)
+			if err != nil {
+				continue
+			}
+			if pref == img || pref == ref.Context().RegistryStr() {
+				add(ref, img, true, fmt.Sprintf("matches platform preference '%s'", pref))
+			}
+		}
+	}
+	for _, img := range images {
+		ref, err := name.ParseReference(img, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+		if registry == ref.Context().RegistryStr() {
+			add(ref, img, false, fmt.Sprintf("on the same registry as the app image '%s'", registry))
+		}
+	}
+	for i, img := range images {
+		ref, err := name.ParseReference(img, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+		if i == 0 {
+			add(ref, img, false, "stack run image")
+		} else {
+			add(ref, img, false, "stack run image mirror")
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("no valid run image references found in stack metadata")
+	}
+	return candidates, nil
+}
+
 func byRegistry(reg string, imgs []string) (string, error) {
 	if len(imgs) < 1 {
 		return "", errors.New("no images provided to search")
@@ -72,4 +72,77 @@ func testMetadata(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 	})
+
+	when("RunImageCandidates", func() {
+		var stackMD *platform.StackMetadata
+
+		it.Before(func() {
+			stackMD = &platform.StackMetadata{RunImage: platform.StackRunImageMetadata{
+				Image: "first.com/org/repo",
+				Mirrors: []string{
+					"myorg/myrepo",
+					"zonal.gcr.io/org/repo",
+					"gcr.io/org/repo",
+				},
+			}}
+		})
+
+		references := func(candidates []platform.RunImageCandidate) []string {
+			var refs []string
+			for _, c := range candidates {
+				refs = append(refs, c.Reference)
+			}
+			return refs
+		}
+
+		it("puts images on the registry first followed by the remaining images in stack order", func() {
+			candidates, err := stackMD.RunImageCandidates("gcr.io", nil)
+			h.AssertNil(t, err)
+			h.AssertEq(t, references(candidates), []string{
+				"gcr.io/org/repo",
+				"first.com/org/repo",
+				"myorg/myrepo",
+				"zonal.gcr.io/org/repo",
+			})
+			h.AssertEq(t, candidates[0].Preferred, false)
+			h.AssertEq(t, candidates[0].SameRegistry, true)
+			h.AssertEq(t, candidates[1].SameRegistry, false)
+		})
+
+		when("there is a platform preference", func() {
+			it("puts preferred images first in the order of preference", func() {
+				candidates, err := stackMD.RunImageCandidates("gcr.io", []string{"zonal.gcr.io", "myorg/myrepo"})
+				h.AssertNil(t, err)
+				h.AssertEq(t, references(candidates), []string{
+					"zonal.gcr.io/org/repo",
+					"myorg/myrepo",
+					"gcr.io/org/repo",
+					"first.com/org/repo",
+				})
+				h.AssertEq(t, candidates[0].Preferred, true)
+				h.AssertEq(t, candidates[0].Reason, "matches platform preference 'zonal.gcr.io'")
+				h.AssertEq(t, candidates[1].Preferred, true)
+				h.AssertEq(t, candidates[2].Preferred, false)
+			})
+		})
+
+		when("one of the images is non-parsable", func() {
+			it.Before(func() {
+				stackMD.RunImage.Mirrors = []string{"as@ohd@as@op", "gcr.io/myorg/myrepo"}
+			})
+
+			it("skips over it", func() {
+				candidates, err := stackMD.RunImageCandidates("gcr.io", nil)
+				h.AssertNil(t, err)
+				h.AssertEq(t, references(candidates), []string{"gcr.io/myorg/myrepo", "first.com/org/repo"})
+			})
+		})
+
+		when("there is no run image", func() {
+			it("errors", func() {
+				_, err := (&platform.StackMetadata{}).RunImageCandidates("gcr.io", nil)
+				h.AssertError(t, err, "missing run-image metadata")
+			})
+		})
+	})
 }
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle/api"
@@ -16,6 +17,7 @@ import (
 type Rebaser struct {
 	Logger      Logger
 	PlatformAPI *api.Version
+	Retry       Retry
 }
 
 type RebaseReport struct {
@@ -68,6 +70,10 @@ func (r *Rebaser) Rebase(appImage imgutil.Image, newBaseImage imgutil.Image, add
 		return RebaseReport{}, errors.Wrap(err, "get run image id or digest")
 	}
 	origMetadata.RunImage.Reference = identifier.String()
+	origMetadata.RunImage.Digest = ""
+	if digestID, ok := identifier.(remote.DigestIdentifier); ok {
+		origMetadata.RunImage.Digest = digestID.Digest.DigestStr()
+	}
 
 	data, err := json.Marshal(origMetadata)
 	if err != nil {
@@ -84,7 +90,7 @@ func (r *Rebaser) Rebase(appImage imgutil.Image, newBaseImage imgutil.Image, add
 	}
 
 	report := RebaseReport{}
-	report.Image, err = saveImage(appImage, additionalNames, r.Logger)
+	report.Image, err = saveImage(appImage, additionalNames, r.Retry, r.Logger)
 	if err != nil {
 		return RebaseReport{}, err
 	}
@@ -92,6 +98,7 @@ func (r *Rebaser) Rebase(appImage imgutil.Image, newBaseImage imgutil.Image, add
 		// unset manifest size in report.toml for old platform API versions
 		report.Image.ManifestSize = 0
 	}
+	report.Image.RunImageDigest = origMetadata.RunImage.Digest
 
 	return report, err
 }
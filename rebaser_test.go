@@ -102,6 +102,41 @@ func testRebaser(t *testing.T, when spec.G, it spec.S) {
 				h.AssertEq(t, md.RunImage.Reference, "new-run-id")
 			})
 
+			when("new base image has a digest identifier", func() {
+				var runImageDigest = "sha256:a27a27006b74a056bed5d9edcebc394783880abe8691a8c87c78b7cffa6fa5ad"
+
+				it.Before(func() {
+					digestRef, err := name.NewDigest("some-repo/new-base-image@" + runImageDigest)
+					h.AssertNil(t, err)
+					fakeNewBaseImage.SetIdentifier(remote.DigestIdentifier{
+						Digest: digestRef,
+					})
+				})
+
+				it("records the run image digest in the metadata and report", func() {
+					report, err := rebaser.Rebase(fakeAppImage, fakeNewBaseImage, additionalNames)
+					h.AssertNil(t, err)
+					h.AssertNil(t, lifecycle.DecodeLabel(fakeAppImage, platform.LayerMetadataLabel, &md))
+
+					h.AssertEq(t, md.RunImage.Digest, runImageDigest)
+					h.AssertEq(t, report.Image.RunImageDigest, runImageDigest)
+				})
+			})
+
+			when("new base image has an ID identifier", func() {
+				it("clears a previously recorded run image digest", func() {
+					h.AssertNil(t, fakeAppImage.SetLabel(
+						platform.LayerMetadataLabel,
+						`{"runImage": {"digest": "sha256:old"}}`,
+					))
+					_, err := rebaser.Rebase(fakeAppImage, fakeNewBaseImage, additionalNames)
+					h.AssertNil(t, err)
+					h.AssertNil(t, lifecycle.DecodeLabel(fakeAppImage, platform.LayerMetadataLabel, &md))
+
+					h.AssertEq(t, md.RunImage.Digest, "")
+				})
+			})
+
 			it("preserves other existing metadata", func() {
 				h.AssertNil(t, fakeAppImage.SetLabel(
 					platform.LayerMetadataLabel,
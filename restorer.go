@@ -1,10 +1,16 @@
 package lifecycle
 
 import (
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/buildpack/layertypes"
 	"github.com/buildpacks/lifecycle/layers"
 	"github.com/buildpacks/lifecycle/platform"
 )
@@ -13,6 +19,11 @@ type Restorer struct {
 	LayersDir  string
 	Buildpacks []buildpack.GroupBuildpack
 	Logger     Logger
+	Workers    int // maximum number of layers restored concurrently, 0 is unlimited
+
+	metrics     cacheMetrics
+	mu          sync.Mutex
+	quarantined []string // quarantined are written to the layers directory for the exporter
 }
 
 // Restore attempts to restore layer data for cache=true layers, removing the layer when unsuccessful.
@@ -25,7 +36,7 @@ func (r *Restorer) Restore(cache Cache) error {
 		if !cache.Exists() {
 			r.Logger.Info("Layer cache not found")
 		}
-		meta, err = cache.RetrieveMetadata()
+		meta, err = retrieveCacheMetadata(cache, r.Logger)
 		if err != nil {
 			return errors.Wrapf(err, "retrieving cache metadata")
 		}
@@ -34,6 +45,27 @@ func (r *Restorer) Restore(cache Cache) error {
 	}
 
 	var g errgroup.Group
+	err := r.startRestores(&g, cache, meta)
+	// wait for the layers already being restored, even when starting the others failed
+	if waitErr := g.Wait(); err == nil && waitErr != nil {
+		err = errors.Wrap(waitErr, "restoring data")
+	}
+	if err != nil {
+		return err
+	}
+	if err := WriteTOML(filepath.Join(r.LayersDir, restoreMetricsFile), r.metrics.report()); err != nil {
+		return errors.Wrap(err, "writing restore metrics")
+	}
+	sort.Strings(r.quarantined)
+	if err := WriteTOML(filepath.Join(r.LayersDir, quarantineFile), quarantineRecord{Layers: r.quarantined}); err != nil {
+		return errors.Wrap(err, "writing quarantined layers")
+	}
+	return nil
+}
+
+// startRestores removes the cached layers that cannot be restored and starts restoring the others in g
+func (r *Restorer) startRestores(g *errgroup.Group, cache Cache, meta platform.CacheMetadata) error {
+	workers := newWorkerPool(r.Workers)
 	for _, buildpack := range r.Buildpacks {
 		buildpackDir, err := readBuildpackLayersDir(r.LayersDir, buildpack, r.Logger)
 		if err != nil {
@@ -42,10 +74,13 @@ func (r *Restorer) Restore(cache Cache) error {
 
 		cachedLayers := meta.MetadataForBuildpack(buildpack.ID).Layers
 		for _, bpLayer := range buildpackDir.findLayers(forCached) {
+			bpLayer := bpLayer
 			name := bpLayer.name()
 			cachedLayer, exists := cachedLayers[name]
 			if !exists {
 				r.Logger.Infof("Removing %q, not in cache", bpLayer.Identifier())
+				// the layer types are not known without cache metadata
+				r.metrics.add(buildpack.ID, layertypes.LayerMetadataFile{}, platform.CacheMetrics{Misses: 1})
 				if err := bpLayer.remove(); err != nil {
 					return errors.Wrapf(err, "removing layer")
 				}
@@ -58,34 +93,101 @@ func (r *Restorer) Restore(cache Cache) error {
 			if data.SHA != cachedLayer.SHA {
 				r.Logger.Infof("Removing %q, wrong sha", bpLayer.Identifier())
 				r.Logger.Debugf("Layer sha: %q, cache sha: %q", data.SHA, cachedLayer.SHA)
+				r.metrics.add(buildpack.ID, cachedLayer.LayerMetadataFile, platform.CacheMetrics{Misses: 1})
 				if err := bpLayer.remove(); err != nil {
 					return errors.Wrapf(err, "removing layer")
 				}
 			} else {
 				r.Logger.Infof("Restoring data for %q from cache", bpLayer.Identifier())
+				bpID := buildpack.ID
+				workers.acquire()
 				g.Go(func() error {
-					return r.restoreLayer(cache, cachedLayer.SHA)
+					defer workers.release()
+					size, err := r.restoreLayer(cache, bpLayer.Path(), cachedLayer.SHA)
+					if err == nil {
+						r.metrics.add(bpID, cachedLayer.LayerMetadataFile, platform.CacheMetrics{Hits: 1, HitBytes: size})
+					}
+					if errors.Is(err, ErrLayerNotFound) {
+						// the layer may have been removed by the retention policy of the cache
+						r.metrics.add(bpID, cachedLayer.LayerMetadataFile, platform.CacheMetrics{Misses: 1})
+						r.Logger.Infof("Removing %q, not in cache", bpLayer.Identifier())
+						if err := bpLayer.remove(); err != nil {
+							return errors.Wrapf(err, "removing layer")
+						}
+						return nil
+					}
+					var mismatch *layers.DigestMismatchError
+					if !errors.As(err, &mismatch) {
+						return err
+					}
+					r.metrics.add(bpID, cachedLayer.LayerMetadataFile, platform.CacheMetrics{Misses: 1})
+					r.Logger.Warnf("Removing %q, cached data is corrupt: %s", bpLayer.Identifier(), err)
+					if err := cache.QuarantineLayer(cachedLayer.SHA); err != nil {
+						return errors.Wrapf(err, "quarantining layer")
+					}
+					r.mu.Lock()
+					r.quarantined = append(r.quarantined, cachedLayer.SHA)
+					r.mu.Unlock()
+					if err := bpLayer.remove(); err != nil {
+						return errors.Wrapf(err, "removing layer")
+					}
+					return nil
 				})
 			}
 		}
 	}
-	if err := g.Wait(); err != nil {
-		return errors.Wrap(err, "restoring data")
-	}
 	return nil
 }
 
-func (r *Restorer) restoreLayer(cache Cache, sha string) error {
+// workerPool bounds the number of goroutines started by an errgroup.Group
+type workerPool chan struct{}
+
+func newWorkerPool(size int) workerPool {
+	if size <= 0 {
+		return nil
+	}
+	return make(workerPool, size)
+}
+
+// acquire blocks until a worker is available
+func (p workerPool) acquire() {
+	if p != nil {
+		p <- struct{}{}
+	}
+}
+
+func (p workerPool) release() {
+	if p != nil {
+		<-p
+	}
+}
+
+// restoreLayer extracts the cached layer sha, refusing any entries outside of the layer directory at path.
+// It returns the number of bytes read from the cache.
+func (r *Restorer) restoreLayer(cache Cache, path, sha string) (int64, error) {
 	// Sanity check to prevent panic.
 	if cache == nil {
-		return errors.New("restoring layer: cache not provided")
+		return 0, errors.New("restoring layer: cache not provided")
 	}
 	r.Logger.Debugf("Retrieving data for %q", sha)
 	rc, err := cache.RetrieveLayer(sha)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer rc.Close()
 
-	return layers.Extract(rc, "")
+	counter := &countingReader{r: rc}
+	err = layers.ExtractVerified(counter, "", path, sha)
+	return counter.n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
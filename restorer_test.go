@@ -1,12 +1,17 @@
 package lifecycle_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/discard"
 	"github.com/pkg/errors"
@@ -19,6 +24,7 @@ import (
 	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/layers"
+	"github.com/buildpacks/lifecycle/platform"
 	h "github.com/buildpacks/lifecycle/testhelpers"
 )
 
@@ -320,6 +326,91 @@ func testRestorer(t *testing.T, when spec.G, it spec.S) {
 				it("does not restore layer data", func() {
 					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-true"))
 				})
+				it("records a cache miss", func() {
+					metrics := readRestoreMetrics(t, layersDir)
+					h.AssertEq(t, metrics.Misses, 1)
+					h.AssertEq(t, metrics.Hits, 0)
+				})
+			})
+
+			when("there is a cache=true layer with corrupt data in the cache", func() {
+				var layerPath string
+
+				it.Before(func() {
+					var err error
+					layerPath, err = testCache.(*cache.VolumeCache).RetrieveLayerFile(cacheOnlyLayerSHA)
+					h.AssertNil(t, err)
+					h.AssertNil(t, ioutil.WriteFile(layerPath, []byte("corrupt data"), 0666))
+
+					meta := "[types]\n  cache=true"
+					h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-only", meta, cacheOnlyLayerSHA))
+					h.AssertNil(t, restorer.Restore(testCache))
+				})
+
+				it("removes metadata and sha file", func() {
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only.toml"))
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only.sha"))
+				})
+				it("does not restore layer data", func() {
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only"))
+				})
+				it("quarantines the cached layer", func() {
+					_, err := testCache.RetrieveLayer(cacheOnlyLayerSHA)
+					h.AssertError(t, err, "is quarantined")
+					h.AssertPathExists(t, filepath.Join(cacheDir, "quarantine", filepath.Base(layerPath)))
+				})
+				it("records the quarantined layer for the exporter", func() {
+					var record struct {
+						Layers []string `toml:"layers"`
+					}
+					_, err := toml.DecodeFile(filepath.Join(layersDir, "quarantine.toml"), &record)
+					h.AssertNil(t, err)
+					h.AssertEq(t, record.Layers, []string{cacheOnlyLayerSHA})
+				})
+			})
+
+			when("there is a cache=true layer missing from the cache", func() {
+				it.Before(func() {
+					layerPath, err := testCache.(*cache.VolumeCache).RetrieveLayerFile(cacheOnlyLayerSHA)
+					h.AssertNil(t, err)
+					h.AssertNil(t, os.Remove(layerPath))
+
+					meta := "[types]\n  cache=true"
+					h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-only", meta, cacheOnlyLayerSHA))
+					h.AssertNil(t, restorer.Restore(testCache))
+				})
+
+				it("removes metadata and sha file", func() {
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only.toml"))
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only.sha"))
+				})
+				it("does not restore layer data", func() {
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only"))
+				})
+			})
+
+			when("there is a cache=true layer compressed in the cache", func() {
+				it.Before(func() {
+					layerPath, err := testCache.(*cache.VolumeCache).RetrieveLayerFile(cacheOnlyLayerSHA)
+					h.AssertNil(t, err)
+					uncompressed, err := ioutil.ReadFile(layerPath)
+					h.AssertNil(t, err)
+					buf := &bytes.Buffer{}
+					gw := gzip.NewWriter(buf)
+					_, err = gw.Write(uncompressed)
+					h.AssertNil(t, err)
+					h.AssertNil(t, gw.Close())
+					h.AssertNil(t, ioutil.WriteFile(layerPath, buf.Bytes(), 0666))
+
+					meta := "[types]\n  cache=true"
+					h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-only", meta, cacheOnlyLayerSHA))
+					h.AssertNil(t, restorer.Restore(testCache))
+				})
+
+				it("restores data", func() {
+					got := h.MustReadFile(t, filepath.Join(layersDir, "buildpack.id", "cache-only", "file-from-cache-only-layer"))
+					h.AssertEq(t, string(got), "echo text from cache-only layer\n")
+				})
 			})
 
 			when("there is a cache=true layer not in cache", func() {
@@ -428,11 +519,71 @@ func testRestorer(t *testing.T, when spec.G, it spec.S) {
 					want = "echo text from escaped bp layer\n"
 					h.AssertEq(t, string(got), want)
 				})
+
+				it("records cache hits for all layers", func() {
+					metrics := readRestoreMetrics(t, layersDir)
+					h.AssertEq(t, metrics.Hits, 3)
+					h.AssertEq(t, metrics.Misses, 0)
+					if metrics.HitBytes == 0 {
+						t.Fatalf("expected bytes read from the cache to be recorded")
+					}
+					h.AssertEq(t, len(metrics.Buildpacks), 2)
+					for _, bp := range metrics.Buildpacks {
+						if bp.ID == "buildpack.id" {
+							h.AssertEq(t, bp.Hits, 2)
+							h.AssertEq(t, bp.Types["cache"].Hits, 2)
+							h.AssertEq(t, bp.Types["launch"].Hits, 1)
+						}
+					}
+				})
+
+				when("a buildpack's layers cannot be read after other layers have started restoring", func() {
+					it("waits for the started restores before returning", func() {
+						h.AssertNil(t, os.RemoveAll(filepath.Join(layersDir, "buildpack.id", "cache-only")))
+						h.AssertNil(t, ioutil.WriteFile(filepath.Join(layersDir, "escaped_buildpack_id", "store.toml"), []byte("[metadata"), 0600))
+						blocking := &blockingCache{Cache: testCache, started: make(chan struct{}, 3), release: make(chan struct{})}
+
+						done := make(chan error)
+						go func() { done <- restorer.Restore(blocking) }()
+						<-blocking.started
+						select {
+						case err := <-done:
+							t.Fatalf("expected restore to wait for the started restores, it returned: %v", err)
+						case <-time.After(100 * time.Millisecond):
+						}
+						close(blocking.release)
+
+						h.AssertError(t, <-done, "reading buildpack layer directory")
+						h.AssertPathExists(t, filepath.Join(layersDir, "buildpack.id", "cache-only", "file-from-cache-only-layer"))
+					})
+				})
+
+				when("restores are limited to one worker", func() {
+					it.Before(func() {
+						restorer.Workers = 1
+						h.AssertNil(t, restorer.Restore(testCache))
+					})
+
+					it("restores data for all layers", func() {
+						got := h.MustReadFile(t, filepath.Join(layersDir, "buildpack.id", "cache-launch", "file-from-cache-launch-layer"))
+						h.AssertEq(t, string(got), "echo text from cache launch layer\n")
+						got = h.MustReadFile(t, filepath.Join(layersDir, "escaped_buildpack_id", "escaped-bp-layer", "file-from-escaped-bp"))
+						h.AssertEq(t, string(got), "echo text from escaped bp layer\n")
+					})
+				})
 			})
 		})
 	})
 }
 
+func readRestoreMetrics(t *testing.T, layersDir string) platform.CacheReport {
+	t.Helper()
+	var metrics platform.CacheReport
+	_, err := toml.DecodeFile(filepath.Join(layersDir, "restore-metrics.toml"), &metrics)
+	h.AssertNil(t, err)
+	return metrics
+}
+
 func writeLayer(layersDir, buildpack, name, metadata, sha string) error {
 	buildpackDir := filepath.Join(layersDir, buildpack)
 	if err := os.MkdirAll(buildpackDir, 0755); err != nil {
@@ -468,3 +619,16 @@ func TestWriteLayer(t *testing.T) {
 
 	h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "test-buildpack", "test-layer"))
 }
+
+// blockingCache signals when a layer is retrieved and blocks retrieving it until released
+type blockingCache struct {
+	lifecycle.Cache
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCache) RetrieveLayer(sha string) (io.ReadCloser, error) {
+	c.started <- struct{}{}
+	<-c.release
+	return c.Cache.RetrieveLayer(sha)
+}
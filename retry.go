@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pkg/errors"
+)
+
+// Retry retries registry operations that fail with transient errors.
+// The zero value performs each operation exactly once.
+type Retry struct {
+	// Retries is the number of additional attempts made after the first attempt fails
+	Retries int
+	// Backoff is the delay before the first retry, it is doubled before each subsequent retry
+	Backoff time.Duration
+	Logger  Logger
+}
+
+// Do calls op until it succeeds, fails with an error that is not transient, or the retries are exhausted.
+// Layers that were uploaded by a failed attempt are not uploaded again,
+// the registry client skips blobs that already exist in the destination repository.
+func (r Retry) Do(desc string, op func() error) error {
+	backoff := r.Backoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= r.Retries || !IsTransientError(err) {
+			return err
+		}
+		if r.Logger != nil {
+			r.Logger.Warnf("Retrying %s in %s (retry %d of %d): %s", desc, backoff, attempt+1, r.Retries, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// IsTransientError returns true if err is likely to succeed when retried,
+// such as a registry that is temporarily unavailable, rate limiting, or a dropped connection.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var saveErr imgutil.SaveError
+	if errors.As(err, &saveErr) {
+		for _, d := range saveErr.Errors {
+			if !IsTransientError(d.Cause) {
+				return false
+			}
+		}
+		return len(saveErr.Errors) > 0
+	}
+
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return transportErr.Temporary() ||
+			transportErr.StatusCode == http.StatusTooManyRequests ||
+			transportErr.StatusCode == http.StatusGatewayTimeout ||
+			transportErr.StatusCode == http.StatusRequestTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// imgutil flattens errors from reading images into strings, so the cause can only be recovered from the message
+	return transientMessage.MatchString(err.Error())
+}
+
+var transientMessage = regexp.MustCompile(`unexpected status code (5\d\d|429)|connection reset by peer|connection refused|broken pipe|i/o timeout|unexpected EOF`)
@@ -0,0 +1,156 @@
+package lifecycle_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestRetry(t *testing.T) {
+	spec.Run(t, "Retry", testRetry, spec.Report(report.Terminal{}))
+}
+
+func testRetry(t *testing.T, when spec.G, it spec.S) {
+	var retry lifecycle.Retry
+
+	it.Before(func() {
+		retry = lifecycle.Retry{
+			Retries: 2,
+			Backoff: time.Millisecond,
+			Logger:  &log.Logger{Handler: &discard.Handler{}},
+		}
+	})
+
+	when("#Do", func() {
+		it("retries transient errors until the operation succeeds", func() {
+			var attempts int
+			err := retry.Do("some operation", func() error {
+				attempts++
+				if attempts < 3 {
+					return &transport.Error{StatusCode: http.StatusServiceUnavailable}
+				}
+				return nil
+			})
+			h.AssertNil(t, err)
+			h.AssertEq(t, attempts, 3)
+		})
+
+		it("returns the last error when the retries are exhausted", func() {
+			var attempts int
+			err := retry.Do("some operation", func() error {
+				attempts++
+				return fmt.Errorf("attempt %d: %w", attempts, syscall.ECONNRESET)
+			})
+			h.AssertError(t, err, "attempt 3")
+			h.AssertEq(t, attempts, 3)
+		})
+
+		it("does not retry errors that are not transient", func() {
+			var attempts int
+			err := retry.Do("some operation", func() error {
+				attempts++
+				return &transport.Error{StatusCode: http.StatusUnauthorized}
+			})
+			h.AssertNotNil(t, err)
+			h.AssertEq(t, attempts, 1)
+		})
+
+		when("the zero value is used", func() {
+			it("attempts the operation once", func() {
+				var attempts int
+				err := lifecycle.Retry{}.Do("some operation", func() error {
+					attempts++
+					return unavailableErr()
+				})
+				h.AssertNotNil(t, err)
+				h.AssertEq(t, attempts, 1)
+			})
+		})
+	})
+
+	when("#IsTransientError", func() {
+		it("is true for retryable registry responses", func() {
+			h.AssertEq(t, lifecycle.IsTransientError(unavailableErr()), true)
+			h.AssertEq(t, lifecycle.IsTransientError(&transport.Error{StatusCode: http.StatusTooManyRequests}), true)
+		})
+
+		it("is true for dropped connections", func() {
+			h.AssertEq(t, lifecycle.IsTransientError(fmt.Errorf("writing: %w", syscall.ECONNRESET)), true)
+		})
+
+		it("is false for other errors", func() {
+			h.AssertEq(t, lifecycle.IsTransientError(&transport.Error{StatusCode: http.StatusNotFound}), false)
+			h.AssertEq(t, lifecycle.IsTransientError(errors.New("some error")), false)
+		})
+
+		it("is true for save errors only when every tag failed with a transient error", func() {
+			transient := imgutil.SaveError{Errors: []imgutil.SaveDiagnostic{
+				{ImageName: "some-image", Cause: unavailableErr()},
+			}}
+			h.AssertEq(t, lifecycle.IsTransientError(transient), true)
+
+			mixed := imgutil.SaveError{Errors: []imgutil.SaveDiagnostic{
+				{ImageName: "some-image", Cause: unavailableErr()},
+				{ImageName: "other-image", Cause: errors.New("some error")},
+			}}
+			h.AssertEq(t, lifecycle.IsTransientError(mixed), false)
+		})
+	})
+
+	when("saving to a registry that fails", func() {
+		var (
+			registry *h.FaultyRegistry
+			tmpDir   string
+		)
+
+		it.Before(func() {
+			var err error
+			registry = h.NewFaultyRegistry()
+			tmpDir, err = ioutil.TempDir("", "lifecycle.retry")
+			h.AssertNil(t, err)
+		})
+
+		it.After(func() {
+			registry.Close()
+			h.AssertNil(t, os.RemoveAll(tmpDir))
+		})
+
+		it("retries the save without uploading existing layers again", func() {
+			img, err := remote.NewImage(registry.Host()+"/some/app", authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			layerPath, _, _ := h.RandomLayer(t, tmpDir)
+			h.AssertNil(t, img.AddLayer(layerPath))
+
+			registry.FailNext(http.MethodPut, "/manifests/", 2, http.StatusServiceUnavailable)
+
+			h.AssertNil(t, retry.Do("saving image", func() error {
+				return img.Save()
+			}))
+
+			h.AssertEq(t, registry.Requests(http.MethodPut, "/manifests/"), 3)
+			// one upload for the layer and one for the config, both made by the first attempt only
+			h.AssertEq(t, registry.Requests(http.MethodPost, "/blobs/uploads/"), 2)
+		})
+	})
+}
+
+func unavailableErr() error {
+	return &transport.Error{StatusCode: http.StatusServiceUnavailable}
+}
@@ -2,7 +2,9 @@ package lifecycle
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/imgutil"
@@ -12,11 +14,22 @@ import (
 	"github.com/buildpacks/lifecycle/platform"
 )
 
-func saveImage(image imgutil.Image, additionalNames []string, logger Logger) (platform.ImageReport, error) {
+func saveImage(image imgutil.Image, additionalNames []string, retry Retry, logger Logger) (platform.ImageReport, error) {
 	var saveErr error
 	imageReport := platform.ImageReport{}
 	logger.Infof("Saving %s...\n", image.Name())
-	if err := image.Save(additionalNames...); err != nil {
+	names := append([]string{image.Name()}, additionalNames...)
+	if err := retry.Do("saving image", func() error {
+		err := saveNames(image, names)
+		if saveErr, ok := err.(imgutil.SaveError); ok {
+			// only the names that failed are saved again
+			names = nil
+			for _, d := range saveErr.Errors {
+				names = append(names, d.ImageName)
+			}
+		}
+		return err
+	}); err != nil {
 		var ok bool
 		if saveErr, ok = err.(imgutil.SaveError); !ok {
 			return platform.ImageReport{}, errors.Wrap(err, "saving image")
@@ -47,6 +60,13 @@ func saveImage(image imgutil.Image, additionalNames []string, logger Logger) (pl
 	case remote.DigestIdentifier:
 		imageReport.Digest = v.Digest.DigestStr()
 		logger.Debugf("\n*** Digest: %s\n", v.Digest.DigestStr())
+		// tags of a daemon image are not pushed, only registry images are written to registries
+		if registries := registryReports(imageReport.Tags, imageReport.Digest); len(registries) > 1 {
+			imageReport.Registries = registries
+			for _, r := range registries {
+				logger.Debugf("\n*** Registry %s: %s\n", r.Registry, strings.Join(r.Tags, ", "))
+			}
+		}
 	default:
 	}
 
@@ -62,6 +82,15 @@ func saveImage(image imgutil.Image, additionalNames []string, logger Logger) (pl
 	return imageReport, saveErr
 }
 
+// saveNames saves image with the given names, the image is renamed to the first name while it is saved
+func saveNames(image imgutil.Image, names []string) error {
+	if name := image.Name(); names[0] != name {
+		image.Rename(names[0])
+		defer image.Rename(name)
+	}
+	return image.Save(names[1:]...)
+}
+
 type MultiError struct {
 	Errors []error
 }
@@ -81,6 +110,28 @@ func shortID(identifier imgutil.Identifier) string {
 	}
 }
 
+// registryReports groups the saved tags by registry.
+// The manifest written to each registry is identical, so every registry shares the digest.
+func registryReports(tags []string, digest string) []platform.RegistryReport {
+	var reports []platform.RegistryReport
+	indexes := map[string]int{}
+	for _, tag := range tags {
+		ref, err := name.ParseReference(tag, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+		registry := ref.Context().RegistryStr()
+		idx, ok := indexes[registry]
+		if !ok {
+			idx = len(reports)
+			indexes[registry] = idx
+			reports = append(reports, platform.RegistryReport{Registry: registry, Digest: digest})
+		}
+		reports[idx].Tags = append(reports[idx].Tags, tag)
+	}
+	return reports
+}
+
 func getSaveStatus(err error, imageName string) (bool, string) {
 	if err != nil {
 		if saveErr, ok := err.(imgutil.SaveError); ok {
@@ -0,0 +1,331 @@
+package testhelpers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5" // #nosec G501
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ObjectStore is an in-process stand-in for an S3 compatible object store.
+// It supports getting, putting and multipart uploading objects addressed by path and can be told to fail requests.
+type ObjectStore struct {
+	server    *httptest.Server
+	accessKey string
+	secretKey string
+
+	mu        sync.Mutex
+	objects   map[string][]byte
+	uploads   map[string]map[int][]byte
+	maxBody   int64
+	faults    []*fault
+	requests  []string
+	uploadIDs int
+}
+
+// NewObjectStore returns a running object store, requests must be signed with accessKey and secretKey unless accessKey is empty
+func NewObjectStore(accessKey, secretKey string) *ObjectStore {
+	s := &ObjectStore{accessKey: accessKey, secretKey: secretKey, objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// URL returns an s3 URL for prefix in bucket that uses this object store as the endpoint
+func (s *ObjectStore) URL(bucket, prefix string) string {
+	return fmt.Sprintf("s3://%s/%s?endpoint=%s", bucket, prefix, url.QueryEscape(s.server.URL))
+}
+
+// Object returns the contents of the object at path (<bucket>/<key>), and whether it exists
+func (s *ObjectStore) Object(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects["/"+path]
+	return data, ok
+}
+
+// SetObject replaces the contents of the object at path (<bucket>/<key>)
+func (s *ObjectStore) SetObject(path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects["/"+path] = data
+}
+
+// SetMaxBodySize rejects requests putting an object or part larger than size, like S3 rejects single uploads over 5 GiB
+func (s *ObjectStore) SetMaxBodySize(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxBody = size
+}
+
+// FailNext fails the next count requests with the given method whose path contains pathMatch
+func (s *ObjectStore) FailNext(method, pathMatch string, count, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{method: method, pathMatch: pathMatch, status: status, remaining: count})
+}
+
+// Requests returns the number of requests received with the given method whose path and query contain pathMatch
+func (s *ObjectStore) Requests(method, pathMatch string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int
+	for _, req := range s.requests {
+		if strings.HasPrefix(req, method+" ") && strings.Contains(req, pathMatch) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *ObjectStore) Close() {
+	s.server.Close()
+}
+
+func (s *ObjectStore) serve(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req.Method+" "+req.URL.RequestURI())
+	for _, f := range s.faults {
+		if f.remaining > 0 && f.method == req.Method && strings.Contains(req.URL.Path, f.pathMatch) {
+			f.remaining--
+			s.mu.Unlock()
+			w.WriteHeader(f.status)
+			return
+		}
+	}
+	s.mu.Unlock()
+
+	if code := s.checkSignature(req); code != "" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	query := req.URL.Query()
+	switch {
+	case req.Method == http.MethodPost && query.Get("uploadId") != "":
+		s.completeUpload(w, req, path, query.Get("uploadId"))
+	case req.Method == http.MethodPost && query["uploads"] != nil:
+		s.mu.Lock()
+		s.uploadIDs++
+		uploadID := fmt.Sprintf("upload-%d", s.uploadIDs)
+		s.uploads[uploadID] = map[int][]byte{}
+		s.mu.Unlock()
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case req.Method == http.MethodPut && query.Get("uploadId") != "":
+		data, ok := s.readBody(w, req)
+		if !ok {
+			return
+		}
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		s.mu.Lock()
+		parts, found := s.uploads[query.Get("uploadId")]
+		if found && err == nil {
+			parts[number] = data
+		}
+		s.mu.Unlock()
+		if !found || err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etag(data))
+	case req.Method == http.MethodDelete && query.Get("uploadId") != "":
+		s.mu.Lock()
+		delete(s.uploads, query.Get("uploadId"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.serveObject(w, req, path)
+	}
+}
+
+func (s *ObjectStore) serveObject(w http.ResponseWriter, req *http.Request, path string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		data, ok := s.Object(path)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case http.MethodPut:
+		data, ok := s.readBody(w, req)
+		if !ok {
+			return
+		}
+		s.SetObject(path, data)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// readBody reads the body of req, it writes an error response and returns false if the body is too large
+func (s *ObjectStore) readBody(w http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	s.mu.Lock()
+	maxBody := s.maxBody
+	s.mu.Unlock()
+	if maxBody > 0 && req.ContentLength > maxBody {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("<Error><Code>EntityTooLarge</Code></Error>"))
+		return nil, false
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	return data, true
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+// completeUpload joins the parts listed in the request body into the object at path
+func (s *ObjectStore) completeUpload(w http.ResponseWriter, req *http.Request, path, uploadID string) {
+	var complete completeMultipartUpload
+	if err := xml.NewDecoder(req.Body).Decode(&complete); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	parts, found := s.uploads[uploadID]
+	delete(s.uploads, uploadID)
+	s.mu.Unlock()
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var object bytes.Buffer
+	for i, part := range complete.Parts {
+		data, ok := parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 || part.ETag != etag(data) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("<Error><Code>InvalidPart</Code></Error>"))
+			return
+		}
+		_, _ = object.Write(data)
+	}
+	s.SetObject(path, object.Bytes())
+	_, _ = io.WriteString(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+}
+
+// checkSignature recomputes the AWS Signature Version 4 signature of req from the credentials of the store,
+// it returns the S3 error code when the signature is missing or does not match
+func (s *ObjectStore) checkSignature(req *http.Request) string {
+	if s.accessKey == "" {
+		return ""
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return "AccessDenied"
+	}
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		if parts := strings.SplitN(strings.TrimSpace(field), "=", 2); len(parts) == 2 {
+			fields[parts[0]] = parts[1]
+		}
+	}
+	credential := strings.Split(fields["Credential"], "/") // <access key>/<date>/<region>/s3/aws4_request
+	if len(credential) != 5 || credential[0] != s.accessKey {
+		return "InvalidAccessKeyId"
+	}
+	amzDate := req.Header.Get("X-Amz-Date")
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	if !strings.HasPrefix(amzDate, credential[1]) || credential[3] != "s3" || credential[4] != "aws4_request" ||
+		!contains(signedHeaders, "host") || !contains(signedHeaders, "x-amz-date") {
+		return "AuthorizationHeaderMalformed"
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		strings.Join(credential[1:], "/"),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range append(credential[1:], stringToSign) {
+		mac := hmac.New(sha256.New, key)
+		_, _ = mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(key)), []byte(fields["Signature"])) {
+		return "SignatureDoesNotMatch"
+	}
+	return ""
+}
+
+// canonicalQuery returns the query sorted by name and value, with each URI encoded as SigV4 requires
+func canonicalQuery(query url.Values) string {
+	var params [][2]string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, [2]string{uriEncode(name), uriEncode(value)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	encoded := make([]string, len(params))
+	for i, param := range params {
+		encoded[i] = param[0] + "=" + param[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data) // #nosec G401
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,102 @@
+package testhelpers
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+// FaultyRegistry is an in-process registry that can be told to fail requests
+type FaultyRegistry struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	faults   []*fault
+	auth     string
+	requests []string
+}
+
+type fault struct {
+	method    string
+	pathMatch string
+	status    int
+	remaining int
+}
+
+func NewFaultyRegistry() *FaultyRegistry {
+	r := &FaultyRegistry{}
+	handler := registry.New(registry.Logger(log.New(ioutil.Discard, "", 0)))
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !r.authorized(req) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if status, ok := r.record(req); ok {
+			w.WriteHeader(status)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	return r
+}
+
+// Host returns the host and port of the registry, suitable for use in image references
+func (r *FaultyRegistry) Host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+// FailNext fails the next count requests with the given method whose path contains pathMatch
+func (r *FaultyRegistry) FailNext(method, pathMatch string, count, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faults = append(r.faults, &fault{method: method, pathMatch: pathMatch, status: status, remaining: count})
+}
+
+// Requests returns the number of requests received with the given method whose path contains pathMatch
+func (r *FaultyRegistry) Requests(method, pathMatch string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int
+	for _, req := range r.requests {
+		if strings.HasPrefix(req, method+" ") && strings.Contains(req, pathMatch) {
+			count++
+		}
+	}
+	return count
+}
+
+// RequireAuth rejects requests without the given Authorization header with a basic auth challenge
+func (r *FaultyRegistry) RequireAuth(authHeader string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.auth = authHeader
+}
+
+func (r *FaultyRegistry) Close() {
+	r.server.Close()
+}
+
+func (r *FaultyRegistry) authorized(req *http.Request) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.auth == "" || req.Header.Get("Authorization") == r.auth
+}
+
+func (r *FaultyRegistry) record(req *http.Request) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	for _, f := range r.faults {
+		if f.remaining > 0 && f.method == req.Method && strings.Contains(req.URL.Path, f.pathMatch) {
+			f.remaining--
+			return f.status, true
+		}
+	}
+	return 0, false
+}
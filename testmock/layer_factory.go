@@ -36,6 +36,21 @@ func (m *MockLayerFactory) EXPECT() *MockLayerFactoryMockRecorder {
 	return m.recorder
 }
 
+// AppIndexLayer mocks base method
+func (m *MockLayerFactory) AppIndexLayer(arg0 []layers.SliceIndex) (layers.Layer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppIndexLayer", arg0)
+	ret0, _ := ret[0].(layers.Layer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AppIndexLayer indicates an expected call of AppIndexLayer
+func (mr *MockLayerFactoryMockRecorder) AppIndexLayer(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppIndexLayer", reflect.TypeOf((*MockLayerFactory)(nil).AppIndexLayer), arg0)
+}
+
 // DirLayer mocks base method
 func (m *MockLayerFactory) DirLayer(arg0, arg1 string) (layers.Layer, error) {
 	m.ctrl.T.Helper()
@@ -81,17 +96,18 @@ func (mr *MockLayerFactoryMockRecorder) ProcessTypesLayer(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessTypesLayer", reflect.TypeOf((*MockLayerFactory)(nil).ProcessTypesLayer), arg0)
 }
 
-// SliceLayers mocks base method
-func (m *MockLayerFactory) SliceLayers(arg0 string, arg1 []layers.Slice) ([]layers.Layer, error) {
+// SliceLayersWithIndex mocks base method
+func (m *MockLayerFactory) SliceLayersWithIndex(arg0 string, arg1 []layers.Slice, arg2 []layers.SliceIndex) ([]layers.Layer, []layers.SliceIndex, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SliceLayers", arg0, arg1)
+	ret := m.ctrl.Call(m, "SliceLayersWithIndex", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]layers.Layer)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].([]layers.SliceIndex)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
-// SliceLayers indicates an expected call of SliceLayers
-func (mr *MockLayerFactoryMockRecorder) SliceLayers(arg0, arg1 interface{}) *gomock.Call {
+// SliceLayersWithIndex indicates an expected call of SliceLayersWithIndex
+func (mr *MockLayerFactoryMockRecorder) SliceLayersWithIndex(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SliceLayers", reflect.TypeOf((*MockLayerFactory)(nil).SliceLayers), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SliceLayersWithIndex", reflect.TypeOf((*MockLayerFactory)(nil).SliceLayersWithIndex), arg0, arg1, arg2)
 }
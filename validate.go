@@ -0,0 +1,410 @@
+package lifecycle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/env"
+	"github.com/buildpacks/lifecycle/image"
+	"github.com/buildpacks/lifecycle/launch"
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+// validateLaunch checks the processes and launch environment of the image being exported.
+// It checks that each process references a buildpack in the group, that each direct command can be found
+// in the PATH assembled from the launch layers, and that no two buildpacks set the same launch environment variable.
+func (e *Exporter) validateLaunch(opts ExportOptions, launchMD launch.Metadata) ([]platform.ValidationFinding, error) {
+	var findings []platform.ValidationFinding
+	for _, proc := range launchMD.Processes {
+		if proc.BuildpackID != "" && !e.inGroup(proc.BuildpackID) {
+			findings = append(findings, platform.ValidationFinding{
+				Type:        platform.ValidationUnknownBuildpack,
+				ProcessType: proc.Type,
+				Buildpacks:  []string{proc.BuildpackID},
+				Message:     fmt.Sprintf("process type '%s' references buildpack '%s' which is not in the group", proc.Type, proc.BuildpackID),
+			})
+		}
+	}
+
+	layers, err := e.launchLayers(opts)
+	if err != nil {
+		return nil, err
+	}
+	commandFindings, err := e.validateCommands(opts, launchMD, layers)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, commandFindings...)
+
+	envFindings, err := validateEnv(launchMD, layers)
+	if err != nil {
+		return nil, err
+	}
+	return append(findings, envFindings...), nil
+}
+
+func (e *Exporter) inGroup(bpID string) bool {
+	for _, bp := range e.Buildpacks {
+		if bp.ID == bpID {
+			return true
+		}
+	}
+	return false
+}
+
+// launchLayer is a launch layer and the buildpack that provided it
+type launchLayer struct {
+	bpLayer
+	buildpackID string
+}
+
+func (e *Exporter) launchLayers(opts ExportOptions) ([]launchLayer, error) {
+	var launchLayers []launchLayer
+	for _, bp := range e.Buildpacks {
+		bpDir, err := readBuildpackLayersDir(opts.LayersDir, bp, e.Logger)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading layers for buildpack '%s'", bp.ID)
+		}
+		for _, layer := range bpDir.findLayers(forLaunch) {
+			launchLayers = append(launchLayers, launchLayer{bpLayer: layer, buildpackID: bp.ID})
+		}
+	}
+	return launchLayers, nil
+}
+
+// validateCommands checks that the command of each direct process can be found.
+// Commands in launch layers or the app directory are found on disk,
+// commands in the run image are found in its layers when they are known and are otherwise not checked.
+// Commands that may be in a reused layer, which is not on disk, are not checked.
+func (e *Exporter) validateCommands(opts ExportOptions, launchMD launch.Metadata, layers []launchLayer) ([]platform.ValidationFinding, error) {
+	if imageOS, err := opts.WorkingImage.OS(); err != nil || imageOS == "windows" {
+		return nil, nil
+	}
+	runImagePath, err := opts.WorkingImage.Env("PATH")
+	if err != nil {
+		return nil, errors.Wrap(err, "get run image PATH")
+	}
+	// reused layers are not on disk, so only commands that would be in them are not checked
+	var reusedLayers []launchLayer
+	for _, layer := range layers {
+		if !layer.hasLocalContents() {
+			reusedLayers = append(reusedLayers, layer)
+		}
+	}
+	reusedLayer := func(path string) (launchLayer, bool) {
+		for _, layer := range reusedLayers {
+			if isWithin(path, layer.path) {
+				return layer, true
+			}
+		}
+		return launchLayer{}, false
+	}
+
+	type unresolved struct {
+		proc       launch.Process
+		candidates []string
+	}
+	var (
+		pending       []unresolved
+		runImagePaths []string
+		findings      []platform.ValidationFinding
+	)
+	for _, proc := range launchMD.Processes {
+		if !proc.Direct {
+			continue
+		}
+		path, err := launchPath(proc.Type, runImagePath, layers)
+		if err != nil {
+			return nil, errors.Wrapf(err, "assemble PATH for process type '%s'", proc.Type)
+		}
+		var candidates []string
+		switch {
+		case filepath.IsAbs(proc.Command):
+			candidates = []string{proc.Command}
+		case strings.Contains(proc.Command, "/"):
+			candidates = []string{filepath.Join(opts.AppDir, proc.Command)}
+		default:
+			for _, dir := range filepath.SplitList(path) {
+				if dir != "" {
+					candidates = append(candidates, filepath.Join(dir, proc.Command))
+				}
+			}
+			// the launcher adds the bin dir of a reused layer to the PATH if the layer has one
+			for _, layer := range reusedLayers {
+				candidates = append(candidates, filepath.Join(layer.path, "bin", proc.Command))
+			}
+		}
+		found := false
+		var inRunImage, unchecked []string
+		for _, candidate := range candidates {
+			if layer, ok := reusedLayer(candidate); ok {
+				unchecked = append(unchecked, layer.Identifier())
+				continue
+			}
+			if isWithin(candidate, opts.LayersDir) || isWithin(candidate, opts.AppDir) {
+				if isExecutable(candidate) {
+					found = true
+					break
+				}
+				continue
+			}
+			inRunImage = append(inRunImage, candidate)
+		}
+		if found {
+			continue
+		}
+		if len(unchecked) > 0 {
+			e.Logger.Debugf("Unable to check command '%s' for process type '%s', it may be in reused layer(s) '%s'", proc.Command, proc.Type, strings.Join(unchecked, "', '"))
+			continue
+		}
+		if len(inRunImage) > 0 {
+			if len(opts.RunImageDiffIDs) == 0 {
+				e.Logger.Debugf("Unable to check command '%s' for process type '%s', the run image layers are not known", proc.Command, proc.Type)
+				continue
+			}
+			if !opts.StrictValidation {
+				// reading the run image layers is expensive, especially from a daemon
+				e.Logger.Debugf("Not checking command '%s' for process type '%s' in the run image layers, validation is not strict", proc.Command, proc.Type)
+				continue
+			}
+			pending = append(pending, unresolved{proc: proc, candidates: inRunImage})
+			runImagePaths = append(runImagePaths, inRunImage...)
+			continue
+		}
+		findings = append(findings, missingCommand(proc))
+	}
+
+	if len(pending) > 0 {
+		found, err := image.FindPaths(opts.WorkingImage, opts.RunImageDiffIDs, runImagePaths)
+		if err != nil {
+			e.Logger.Warnf("Unable to check commands in run image '%s': %s", opts.RunImageRef, err)
+			return findings, nil
+		}
+		for _, p := range pending {
+			ok := false
+			for _, candidate := range p.candidates {
+				ok = ok || found[candidate]
+			}
+			if !ok {
+				findings = append(findings, missingCommand(p.proc))
+			}
+		}
+	}
+	return findings, nil
+}
+
+func missingCommand(proc launch.Process) platform.ValidationFinding {
+	return platform.ValidationFinding{
+		Type:        platform.ValidationMissingCommand,
+		ProcessType: proc.Type,
+		Name:        proc.Command,
+		Buildpacks:  nonEmpty(proc.BuildpackID),
+		Message:     fmt.Sprintf("command '%s' for direct process type '%s' was not found in the launch PATH", proc.Command, proc.Type),
+	}
+}
+
+// launchPath returns the PATH the launcher assembles from the launch layers for the process type
+func launchPath(procType, runImagePath string, layers []launchLayer) (string, error) {
+	lenv := env.NewLaunchEnv([]string{"PATH=" + runImagePath}, launch.ProcessDir, launch.LifecycleDir)
+	for start := 0; start < len(layers); {
+		// like the launcher, add the root dirs of each buildpack's layers before their env dirs
+		end := start
+		for end < len(layers) && layers[end].buildpackID == layers[start].buildpackID {
+			end++
+		}
+		for _, layer := range layers[start:end] {
+			if err := lenv.AddRootDir(layer.path); err != nil {
+				return "", err
+			}
+		}
+		for _, layer := range layers[start:end] {
+			action := env.DefaultActionType(api.MustParse(layerAPI(layer)))
+			for _, dir := range envDirs(layer.path, procType) {
+				if err := lenv.AddEnvDir(dir, action); err != nil {
+					return "", err
+				}
+			}
+		}
+		start = end
+	}
+	return lenv.Get("PATH"), nil
+}
+
+// envSetter is a buildpack that sets a launch environment variable with an override or default action
+type envSetter struct {
+	buildpackID string
+	action      env.ActionType
+}
+
+// validateEnv finds launch environment variables set by more than one buildpack, where only one value is used
+func validateEnv(launchMD launch.Metadata, layers []launchLayer) ([]platform.ValidationFinding, error) {
+	// setters are recorded in the order the launcher applies the env dirs
+	setters := map[string]map[string][]envSetter{} // process type -> variable -> setters
+	procVars := map[string]map[string]bool{}       // process type -> variables set in its own env dirs, or the shared env dirs for ""
+	record := func(procType, dir, bpID string, defaultAction env.ActionType) ([]string, error) {
+		fis, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "read env dir '%s'", dir)
+		}
+		var names []string
+		for _, fi := range fis {
+			if fi.IsDir() {
+				continue
+			}
+			parts := strings.SplitN(fi.Name(), ".", 2)
+			action := defaultAction
+			if len(parts) > 1 {
+				action = env.ActionType(parts[1])
+			}
+			if action != env.ActionTypeOverride && action != env.ActionTypeDefault {
+				continue
+			}
+			if setters[procType] == nil {
+				setters[procType] = map[string][]envSetter{}
+			}
+			setters[procType][parts[0]] = append(setters[procType][parts[0]], envSetter{buildpackID: bpID, action: action})
+			names = append(names, parts[0])
+		}
+		return names, nil
+	}
+	for _, layer := range layers {
+		action := env.DefaultActionType(api.MustParse(layerAPI(layer)))
+		for _, dir := range envDirs(layer.path, "") {
+			names, err := record("", dir, layer.buildpackID, action)
+			if err != nil {
+				return nil, err
+			}
+			addAll(procVars, "", names)
+		}
+		for _, proc := range launchMD.Processes {
+			dirs := envDirs(layer.path, proc.Type)
+			for _, dir := range dirs {
+				names, err := record(proc.Type, dir, layer.buildpackID, action)
+				if err != nil {
+					return nil, err
+				}
+				if dir == dirs[len(dirs)-1] {
+					addAll(procVars, proc.Type, names)
+				}
+			}
+		}
+	}
+
+	var findings []platform.ValidationFinding
+	conflict := func(procType, name string, vars map[string][]envSetter) {
+		var bps []string
+		for _, setter := range vars[name] {
+			bps = appendUnique(bps, setter.buildpackID)
+		}
+		if len(bps) < 2 {
+			return
+		}
+		msg := fmt.Sprintf("environment variable '%s' is set by buildpacks %s, only the value from '%s' is used", name, quoteAll(bps), envWinner(vars[name]))
+		if procType != "" {
+			msg = fmt.Sprintf("%s for process type '%s'", msg, procType)
+		}
+		findings = append(findings, platform.ValidationFinding{
+			Type:        platform.ValidationEnvConflict,
+			ProcessType: procType,
+			Name:        name,
+			Buildpacks:  bps,
+			Message:     msg,
+		})
+	}
+	for _, name := range sortedKeys(procVars[""]) {
+		conflict("", name, setters[""])
+	}
+	for _, proc := range launchMD.Processes {
+		for _, name := range sortedKeys(procVars[proc.Type]) {
+			conflict(proc.Type, name, setters[proc.Type])
+		}
+	}
+	return findings, nil
+}
+
+// envWinner returns the buildpack whose value is used: the last override or, without overrides, the first default
+func envWinner(setters []envSetter) string {
+	var winner string
+	for _, setter := range setters {
+		if setter.action == env.ActionTypeOverride || winner == "" {
+			winner = setter.buildpackID
+		}
+	}
+	return winner
+}
+
+func envDirs(layerDir, procType string) []string {
+	dirs := []string{filepath.Join(layerDir, "env"), filepath.Join(layerDir, "env.launch")}
+	if procType != "" {
+		dirs = append(dirs, filepath.Join(layerDir, "env.launch", procType))
+	}
+	return dirs
+}
+
+func layerAPI(layer launchLayer) string {
+	if layer.api == "" {
+		return "0.2"
+	}
+	return layer.api
+}
+
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isExecutable(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func quoteAll(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = "'" + s + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func addAll(sets map[string]map[string]bool, key string, items []string) {
+	if sets[key] == nil {
+		sets[key] = map[string]bool{}
+	}
+	for _, item := range items {
+		sets[key][item] = true
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}